@@ -75,6 +75,7 @@ def generate_workflow(image_name, workflow_name):
 #
 
 name: (deploy) {workflow_name}
+run-name: "(deploy) {workflow_name}: ${{{{ github.event.inputs.service }}}}${{{{ github.event.inputs.dispatch_id && format(' [{{0}}]', github.event.inputs.dispatch_id) || '' }}}}"
 
 on:
   workflow_dispatch:
@@ -88,6 +89,10 @@ on:
         type: string
         description: SHA256 to deploy (include "sha256:" prefix)
         required: true
+      dispatch_id:
+        type: string
+        description: Correlation ID set by dwtool so it can find this run (leave empty)
+        required: false
 
 env:
   REGION: us-east-1
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"dreamwidth.org/dwtool/internal/config"
+)
+
+// useCatalog loads the service catalog (see config.ReadCatalog) and makes it
+// the one every command uses, exiting if it's missing or invalid.
+func useCatalog(path string) {
+	catalog, err := config.ReadCatalog(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if problems := catalog.Validate(); len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid service catalog %s: %s\n(run 'dwtool catalog check' for details)\n", catalog.Path, strings.Join(problems, "; "))
+		os.Exit(1)
+	}
+	config.UseCatalog(catalog)
+}
+
+// serviceCatalog returns the service catalog, exiting if there isn't a valid one.
+func serviceCatalog() *config.Catalog {
+	catalog, err := config.Services()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return catalog
+}
+
+// catalogFinding is one thing `catalog check` found wrong.
+type catalogFinding struct {
+	Level   string `json:"level"` // "error" or "warning"
+	Service string `json:"service,omitempty"`
+	Message string `json:"message"`
+}
+
+// catalogService is how the catalog classifies one ECS service.
+type catalogService struct {
+	Name        string   `json:"name"`
+	Group       string   `json:"group"`
+	WorkflowSvc string   `json:"workflow_service,omitempty"`
+	Targets     []string `json:"targets,omitempty"`
+	LogGroup    string   `json:"log_group,omitempty"`
+	TargetGroup string   `json:"target_group,omitempty"`
+}
+
+type catalogReport struct {
+	Catalog  string           `json:"catalog"` // path
+	Services []catalogService `json:"services"`
+	Findings []catalogFinding `json:"findings"`
+}
+
+// runCatalog implements `dwtool catalog`.
+func runCatalog(args []string) {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintf(os.Stderr, "Usage: dwtool catalog check [options]\n\n")
+		fmt.Fprintf(os.Stderr, "The service catalog (config/services.json, next to workers.json) says\n")
+		fmt.Fprintf(os.Stderr, "which dashboard group each ECS service is in, what it deploys with, and\n")
+		fmt.Fprintf(os.Stderr, "its log group and ALB target group. 'check' validates it and compares it\n")
+		fmt.Fprintf(os.Stderr, "with the cluster. Run 'dwtool catalog check --help' for options.\n")
+		os.Exit(1)
+	}
+	runCatalogCheck(args[1:])
+}
+
+// runCatalogCheck validates the service catalog and cross-checks it against
+// ECS, CloudWatch Logs, the ALB and workers.json.
+func runCatalogCheck(args []string) {
+	fs := flag.NewFlagSet("catalog check", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "output JSON")
+	region := fs.String("region", config.DefaultRegion, "AWS region")
+	cluster := fs.String("cluster", config.DefaultCluster, "ECS cluster name")
+	catalogPath := fs.String("catalog", "", "path to config/services.json (auto-detected from $DWTOOL_CATALOG or $LJHOME if empty)")
+	workersJSON := fs.String("workers-json", "", "path to config/workers.json (auto-detected from $LJHOME if empty)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dwtool catalog check [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Validate the service catalog, check that every target's workflow is in the\n")
+		fmt.Fprintf(os.Stderr, "checkout's .github/workflows, then compare it with the cluster: every ECS\n")
+		fmt.Fprintf(os.Stderr, "service should match an entry, every named entry should have a service,\n")
+		fmt.Fprintf(os.Stderr, "and the log groups and ALB target groups it names should exist. Workers\n")
+		fmt.Fprintf(os.Stderr, "are also compared with workers.json. Exits non-zero if there are errors.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  dwtool catalog check\n")
+		fmt.Fprintf(os.Stderr, "  dwtool catalog check --catalog config/services.json --json\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+
+	catalog, err := config.ReadCatalog(*catalogPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	report := catalogReport{Catalog: catalog.Path}
+	add := func(level, service, format string, args ...any) {
+		report.Findings = append(report.Findings, catalogFinding{Level: level, Service: service, Message: fmt.Sprintf(format, args...)})
+	}
+	problems := catalog.Validate()
+	for _, p := range problems {
+		add("error", "", "%s", p)
+	}
+
+	// Each target's workflow must be one the repository has. The catalog
+	// lives in <checkout>/config, so the workflows are next door.
+	workflowDir := filepath.Join(filepath.Dir(filepath.Dir(catalog.Path)), ".github", "workflows")
+	if _, err := os.Stat(workflowDir); err != nil {
+		add("warning", "", "not checking workflow names: %v", err)
+	} else {
+		for _, label := range catalog.TargetLabels() {
+			wf := catalog.Targets[label].Workflow
+			if _, err := os.Stat(filepath.Join(workflowDir, wf)); err != nil {
+				add("error", "", "target %q: workflow %s isn't in %s", label, wf, workflowDir)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		// Lookups on an invalid catalog would only add noise.
+		finishCatalogCheck(report, *jsonOut)
+	}
+	config.UseCatalog(catalog)
+
+	client := newAWSClient(*region, *cluster)
+	ctx := context.Background()
+	names, err := client.ListServices(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	running := make(map[string]bool)
+	prefixUsed := make(map[string]bool)
+	inOrder := make(map[string]bool)
+	for _, name := range catalog.DeployOrder {
+		inOrder[name] = true
+	}
+	for _, name := range names {
+		info, ok := catalog.Lookup(name)
+		running[info.Key] = true
+		svc := catalogService{Name: name, Group: info.Group, WorkflowSvc: info.WorkflowSvc, LogGroup: info.LogGroup, TargetGroup: info.TargetGroup}
+		for _, t := range info.Targets {
+			svc.Targets = append(svc.Targets, t.Label)
+		}
+		report.Services = append(report.Services, svc)
+		if !ok {
+			add("error", name, "not in the catalog; dwtool shows it under Other and can't deploy it")
+			continue
+		}
+		for _, entry := range catalog.Services {
+			if entry.Prefix != "" && entry.Name == "" && strings.HasPrefix(info.Key, entry.Prefix) {
+				prefixUsed[entry.Prefix] = true
+			}
+		}
+		if info.Group == "web" && len(info.Targets) > 0 && !inOrder[info.Key] {
+			add("warning", name, "web service isn't in deploy_order, so rollouts skip it")
+		}
+	}
+	for _, entry := range catalog.Services {
+		switch {
+		case entry.Name != "" && !running[entry.Name]:
+			add("error", entry.Name+"-service", "in the catalog but not in cluster %q", *cluster)
+		case entry.Prefix != "" && !prefixUsed[entry.Prefix]:
+			add("warning", "", "prefix %q matches no service in cluster %q", entry.Prefix, *cluster)
+		}
+	}
+
+	// Log groups and target groups the catalog names must exist.
+	checkedLogs := make(map[string]bool)
+	var targetGroups map[string]bool
+	for _, svc := range report.Services {
+		if lg := svc.LogGroup; lg != "" && !checkedLogs[lg] {
+			checkedLogs[lg] = true
+			groups, err := client.ListLogGroups(ctx, lg)
+			if err != nil {
+				add("error", svc.Name, "checking log group %s: %v", lg, err)
+			} else if !slices.Contains(groups, lg) {
+				add("error", svc.Name, "log group %s doesn't exist", lg)
+			}
+		}
+		if svc.TargetGroup == "" {
+			continue
+		}
+		if targetGroups == nil {
+			targetGroups = make(map[string]bool)
+			tgs, err := client.ListTargetGroups(ctx, catalog.ALB)
+			if err != nil {
+				add("error", "", "listing target groups on %s: %v", catalog.ALB, err)
+			}
+			for _, tg := range tgs {
+				targetGroups[tg] = true
+			}
+		}
+		if len(targetGroups) > 0 && !targetGroups[svc.TargetGroup] {
+			add("error", svc.Name, "target group %s isn't attached to ALB %s", svc.TargetGroup, catalog.ALB)
+		}
+	}
+
+	// Workers come and go through workers.json; the catalog and it should
+	// agree on which exist.
+	workers, err := config.LoadWorkers(*workersJSON)
+	if err != nil {
+		add("warning", "", "not comparing workers with workers.json: %v", err)
+	} else {
+		ecsWorkers := make(map[string]bool)
+		for _, svc := range report.Services {
+			if svc.Group != "worker" {
+				continue
+			}
+			ecsWorkers[svc.WorkflowSvc] = true
+			if _, ok := workers.Workers[svc.WorkflowSvc]; !ok {
+				add("warning", svc.Name, "worker isn't in workers.json, so it has no category")
+			}
+		}
+		var listed []string
+		for name := range workers.Workers {
+			listed = append(listed, name)
+		}
+		sort.Strings(listed)
+		for _, name := range listed {
+			if !ecsWorkers[name] {
+				add("warning", name, "in workers.json but no catalog worker service runs it in cluster %q", *cluster)
+			}
+		}
+	}
+
+	finishCatalogCheck(report, *jsonOut)
+}
+
+// finishCatalogCheck prints the report and exits, non-zero if it has errors.
+func finishCatalogCheck(report catalogReport, jsonOut bool) {
+	errs, warnings := 0, 0
+	for _, f := range report.Findings {
+		if f.Level == "error" {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+
+	if jsonOut {
+		emitJSON(report)
+	} else {
+		fmt.Printf("Catalog: %s\n", report.Catalog)
+		if len(report.Services) > 0 {
+			fmt.Println()
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "SERVICE\tGROUP\tTARGETS\tLOG GROUP\tTARGET GROUP")
+			for _, svc := range report.Services {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", svc.Name, svc.Group, dash(strings.Join(svc.Targets, ", ")), dash(svc.LogGroup), dash(svc.TargetGroup))
+			}
+			w.Flush()
+		}
+		if len(report.Findings) > 0 {
+			fmt.Println()
+		}
+		for _, f := range report.Findings {
+			prefix := "ERROR"
+			if f.Level != "error" {
+				prefix = "warn "
+			}
+			if f.Service != "" {
+				fmt.Printf("  %s  %s: %s\n", prefix, f.Service, f.Message)
+			} else {
+				fmt.Printf("  %s  %s\n", prefix, f.Message)
+			}
+		}
+		fmt.Printf("\n%d errors, %d warnings\n", errs, warnings)
+	}
+	if errs > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -9,6 +10,8 @@ import (
 	"strings"
 	"time"
 
+	"dreamwidth.org/dwtool/internal/audit"
+	dwaws "dreamwidth.org/dwtool/internal/aws"
 	"dreamwidth.org/dwtool/internal/config"
 	"dreamwidth.org/dwtool/internal/github"
 	"dreamwidth.org/dwtool/internal/model"
@@ -87,50 +90,173 @@ func resolveDigest(repo, imageBase, userDigest string, limit int) (model.Image,
 	}
 }
 
-// waitForRun finds the workflow run created after `since` and polls it to
-// completion, printing status transitions. Returns the final conclusion
-// ("success", "failure", "cancelled", ...).
-func waitForRun(repo, workflow string, since time.Time) (string, error) {
-	var runID int
-	findDeadline := time.Now().Add(2 * time.Minute)
-	for {
-		id, err := github.FindWorkflowRun(repo, workflow, since)
-		if err != nil {
-			return "", fmt.Errorf("finding workflow run: %w", err)
-		}
-		if id != 0 {
-			runID = id
-			break
-		}
-		if time.Now().After(findDeadline) {
-			return "", fmt.Errorf("timed out waiting for the run to appear (it may still be starting; check GitHub Actions)")
-		}
-		time.Sleep(3 * time.Second)
+// waitForRun finds the run started by dispatch d and polls it to completion,
+// printing status and step transitions, and the failed step's log tail if it
+// fails. Returns the run ID (0 if it was never found) and the final
+// conclusion ("success", "failure", "cancelled", ...).
+func waitForRun(repo string, d github.Dispatch) (int, string, error) {
+	runID, err := findRun(repo, d, 2*time.Minute)
+	if err != nil {
+		return 0, "", err
 	}
 	fmt.Printf("  run id:   %d\n", runID)
 	fmt.Printf("  run url:  https://github.com/%s/actions/runs/%d\n", repo, runID)
 
 	lastStatus := ""
+	steps := stepPrinter{}
 	pollDeadline := time.Now().Add(30 * time.Minute)
 	for {
 		status, conclusion, err := github.GetWorkflowRun(repo, runID)
 		if err != nil {
-			return "", fmt.Errorf("polling run %d: %w", runID, err)
+			return runID, "", fmt.Errorf("polling run %d: %w", runID, err)
 		}
 		if status != lastStatus {
 			fmt.Printf("  status:   %s\n", status)
 			lastStatus = status
 		}
+		// Step progress is a nicety; a failed jobs fetch just skips a beat.
+		jobs, jerr := github.ListRunJobs(repo, runID)
+		if jerr == nil {
+			steps.update(jobs)
+		}
 		if status == "completed" {
-			return conclusion, nil
+			if conclusion != "success" {
+				printFailedStep(repo, runID, jobs, "  ")
+			}
+			return runID, conclusion, nil
 		}
 		if time.Now().After(pollDeadline) {
-			return "", fmt.Errorf("timed out after 30m polling run %d (still %s); check GitHub Actions", runID, status)
+			return runID, "", fmt.Errorf("timed out after 30m polling run %d (still %s); check GitHub Actions", runID, status)
 		}
 		time.Sleep(5 * time.Second)
 	}
 }
 
+// ecsRolloutTimeout bounds how long we follow an ECS deployment once its
+// workflow run has succeeded.
+const ecsRolloutTimeout = 30 * time.Minute
+
+// waitForSteadyState follows the ECS deployment a deploy started (created at
+// or after since) until its RolloutState is COMPLETED, then checks that every
+// running task is on digest. A FAILED or stuck rollout is returned as an error
+// after printing the service events that explain it.
+func waitForSteadyState(ctx context.Context, client *dwaws.Client, service, digest string, since time.Time, timeout time.Duration) error {
+	lastState := ""
+	deadline := time.Now().Add(timeout)
+	for {
+		st, err := client.CheckRollout(ctx, service, since)
+		if err != nil {
+			return fmt.Errorf("checking ECS rollout of %s: %w", service, err)
+		}
+
+		state := "waiting for new deployment"
+		if st.State != "" {
+			state = st.State + " " + dwaws.TaskCount(st.Running, st.Desired)
+		}
+		if state != lastState {
+			fmt.Printf("  ecs:      %s\n", state)
+			lastState = state
+		}
+
+		switch {
+		case st.State == "COMPLETED":
+			tasks, err := client.VerifyImage(ctx, service, digest)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("  image:    all %d tasks on %s\n", tasks, shortDigest(digest))
+			return nil
+		case st.State == "FAILED":
+			printServiceEvents(st.Events, "  ")
+			return fmt.Errorf("ECS rollout of %s FAILED (task definition %s)", service, dash(st.TaskDef))
+		case time.Now().After(deadline):
+			printServiceEvents(st.Events, "  ")
+			return fmt.Errorf("timed out after %s waiting for %s to finish rolling out (%s)", timeout, service, state)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// printServiceEvents prints up to the ten most recent ECS service events,
+// oldest first so they read in order.
+func printServiceEvents(events []model.ServiceEvent, indent string) {
+	if len(events) > 10 {
+		events = events[:10]
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		fmt.Printf("%sevent:    %s %s\n", indent, events[i].CreatedAt.Local().Format("15:04:05"), events[i].Message)
+	}
+}
+
+// stepPrinter prints each workflow step as it starts and finishes, keyed by
+// job ID and step number so repeated polls don't repeat lines.
+type stepPrinter map[string]string
+
+func (p stepPrinter) update(jobs []model.WorkflowJob) {
+	for _, j := range jobs {
+		for _, s := range j.Steps {
+			state := s.Status
+			if s.Status == "completed" {
+				state = s.Conclusion
+			}
+			key := fmt.Sprintf("%d/%d", j.ID, s.Number)
+			if p[key] == state || state == "queued" || state == "pending" || state == "skipped" {
+				continue
+			}
+			p[key] = state
+			if s.Status == "in_progress" {
+				fmt.Printf("  step:     %s / %s ...\n", j.Name, s.Name)
+			} else {
+				fmt.Printf("  step:     %s / %s: %s (%s)\n", j.Name, s.Name, state, stepDuration(s))
+			}
+		}
+	}
+}
+
+// stepDuration formats how long a finished step took.
+func stepDuration(s model.WorkflowStep) string {
+	if s.StartedAt.IsZero() || s.CompletedAt.IsZero() {
+		return "-"
+	}
+	return s.CompletedAt.Sub(s.StartedAt).Round(time.Second).String()
+}
+
+// failedStepLogLines is how much of a failed step's log we print.
+const failedStepLogLines = 30
+
+// printFailedStep names the step that failed a run and prints the tail of
+// its log, each line prefixed with indent, and returns "job / step" (or "" if
+// no step failed). jobs may be nil to fetch them.
+func printFailedStep(repo string, runID int, jobs []model.WorkflowJob, indent string) string {
+	if jobs == nil {
+		var err error
+		if jobs, err = github.ListRunJobs(repo, runID); err != nil {
+			fmt.Fprintf(os.Stderr, "%swarn: listing jobs of run %d: %v\n", indent, runID, err)
+			return ""
+		}
+	}
+	job, step, ok := github.FailedStep(jobs)
+	if !ok {
+		for _, j := range jobs {
+			if j.Conclusion != "" && j.Conclusion != "success" && j.Conclusion != "skipped" {
+				fmt.Printf("%sjob:      %s: %s\n", indent, j.Name, j.Conclusion)
+			}
+		}
+		return ""
+	}
+	failed := job.Name + " / " + step.Name
+	fmt.Printf("%sfailed:   %s\n", indent, failed)
+	lines, err := github.StepLogTail(repo, job, step, failedStepLogLines)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%swarn: fetching log: %v\n", indent, err)
+		return failed
+	}
+	for _, line := range lines {
+		fmt.Printf("%s  | %s\n", indent, line)
+	}
+	return failed
+}
+
 // runDeploy implements `dwtool deploy <service> <digest>`.
 func runDeploy(args []string) {
 	service, rest := peelPositional(args)
@@ -142,21 +268,28 @@ func runDeploy(args []string) {
 	repo := fs.String("repo", config.DefaultRepo, "GitHub repository (owner/name)")
 	target := fs.String("target", "", "deploy target label when a service has more than one (e.g. worker22)")
 	limit := fs.Int("limit", 50, "how many recent GHCR images to search when resolving the digest")
-	wait := fs.Bool("wait", false, "block until the GitHub Actions run completes; exit non-zero on failure")
+	wait := fs.Bool("wait", false, "block until the GitHub Actions run completes and ECS is steady on the new image; exit non-zero on failure")
 	yes := fs.Bool("yes", false, "actually trigger the deploy (without this flag the command is a dry run)")
+	guard := addGuardFlags(fs, region)
+	allowUnverified := addProvenanceFlag(fs)
 
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: dwtool deploy <service> <digest> [options]\n\n")
-		fmt.Fprintf(os.Stderr, "Deploy a specific image digest to one ECS service by triggering its\n")
-		fmt.Fprintf(os.Stderr, "GitHub Actions deploy workflow. The digest must be an explicit image\n")
-		fmt.Fprintf(os.Stderr, "digest (full or abbreviated) that exists in GHCR -- there is no 'latest'\n")
-		fmt.Fprintf(os.Stderr, "shortcut. Without --yes this is a DRY RUN that only prints the plan.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: dwtool deploy <service> <image> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Deploy a specific image to one ECS service by triggering its GitHub\n")
+		fmt.Fprintf(os.Stderr, "Actions deploy workflow. <image> is a digest (full or abbreviated), a\n")
+		fmt.Fprintf(os.Stderr, "git SHA, an image tag, 'latest', or current:<service> for whatever that\n")
+		fmt.Fprintf(os.Stderr, "service is running; it must match exactly one image in GHCR, and the\n")
+		fmt.Fprintf(os.Stderr, "plan shows the full digest it resolved to. Without --yes this is a DRY\n")
+		fmt.Fprintf(os.Stderr, "RUN that only prints the plan.\n")
+		fmt.Fprintf(os.Stderr, "The service's deploy lock is taken first (see dwtool lock), and deploys\n")
+		fmt.Fprintf(os.Stderr, "during a freeze window need --force-freeze --reason.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  dwtool deploy web-stable-service 110ddd7f52bd             # dry run\n")
 		fmt.Fprintf(os.Stderr, "  dwtool deploy web-stable-service 110ddd7f52bd --yes       # execute\n")
 		fmt.Fprintf(os.Stderr, "  dwtool deploy web-stable-service 110ddd7f52bd --yes --wait\n")
+		fmt.Fprintf(os.Stderr, "  dwtool deploy web-stable-service current:web-canary       # promote canary\n")
 	}
 	if err := fs.Parse(rest); err != nil {
 		os.Exit(1)
@@ -169,7 +302,7 @@ func runDeploy(args []string) {
 		digest, leftover = leftover[0], leftover[1:]
 	}
 	if service == "" || digest == "" {
-		fmt.Fprintf(os.Stderr, "Error: both <service> and <digest> are required\n\n")
+		fmt.Fprintf(os.Stderr, "Error: both <service> and <image> are required\n\n")
 		fs.Usage()
 		os.Exit(1)
 	}
@@ -197,17 +330,37 @@ func runDeploy(args []string) {
 		os.Exit(1)
 	}
 
-	img, err := resolveDigest(*repo, tgt.ImageBase, digest, *limit)
+	img, err := resolveImageRef(*repo, *region, *cluster, tgt.ImageBase, digest, *limit)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Deploy plan for %s\n", svc.Name)
+	printDeployPlan("Deploy plan for "+svc.Name, svc, tgt, img, refNote(digest, img))
+	provNote := verifyProvenance(*repo, tgt.ImageBase, img, *allowUnverified, *guard.reason, !*yes)
+
+	if !*yes {
+		printGuardStatus(*region, []string{svc.Name})
+		fmt.Printf("\n[dry run] no deploy triggered. Re-run with --yes to execute.\n")
+		return
+	}
+
+	entry := audit.New("cli", "deploy", svc.Name)
+	entry.Detail = joinNotes(provNote, guardDeploy(guard, []string{svc.Name}, "deploy "+shortDigest(img.Digest)))
+	executeDeploy(ctx, client, *repo, tgt, img, *wait, entry)
+}
+
+// printDeployPlan prints what a single-service deploy of img would do. ref
+// is the symbolic reference img was resolved from, if any.
+func printDeployPlan(title string, svc model.Service, tgt model.DeployTarget, img model.Image, ref string) {
+	fmt.Printf("%s\n", title)
 	fmt.Printf("  workflow: %s (service=%s)\n", tgt.Workflow, tgt.WorkflowSvc)
 	fmt.Printf("  source:   %s\n", tgt.ImageBase)
 	fmt.Printf("  current:  %s\n", dash(svc.ImageDigest))
-	fmt.Printf("  deploy:   %s\n", shortDigest(img.Digest))
+	if ref != "" {
+		fmt.Printf("  ref:      %s\n", ref)
+	}
+	fmt.Printf("  deploy:   %s\n", img.Digest)
 	if len(img.Tags) > 0 {
 		fmt.Printf("  tags:     %s\n", strings.Join(img.Tags, ", "))
 	}
@@ -217,38 +370,104 @@ func runDeploy(args []string) {
 	if isDeployed(img, svc.ImageDigest) {
 		fmt.Printf("  note:     this digest is already the running image\n")
 	}
+}
 
-	if !*yes {
-		fmt.Printf("\n[dry run] no deploy triggered. Re-run with --yes to execute.\n")
-		return
+// findRun polls for the run started by dispatch d until it appears or
+// timeout passes. The error says plainly when the run couldn't be correlated.
+func findRun(repo string, d github.Dispatch, timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		id, err := github.FindDispatchedRun(repo, d)
+		var uerr *github.UncorrelatedError
+		if errors.As(err, &uerr) {
+			return 0, err
+		}
+		if err != nil {
+			return 0, fmt.Errorf("finding workflow run: %w", err)
+		}
+		if id != 0 {
+			return id, nil
+		}
+		if time.Now().After(deadline) {
+			if d.ID == "" {
+				return 0, fmt.Errorf("no %s run appeared within %s (it may still be starting; check GitHub Actions)", d.Workflow, timeout)
+			}
+			return 0, fmt.Errorf("no %s run with dispatch ID %s appeared within %s (it may still be starting; check GitHub Actions)", d.Workflow, d.ID, timeout)
+		}
+		time.Sleep(3 * time.Second)
+	}
+}
+
+// dispatchDetail appends to an audit detail the dispatch ID that ties the
+// trigger to its run, or a note that the workflow doesn't take one.
+func dispatchDetail(detail string, d github.Dispatch) string {
+	note := "dispatch " + d.ID
+	if d.ID == "" {
+		note = "uncorrelated dispatch"
+	}
+	if detail == "" {
+		return note
 	}
+	return detail + "; " + note
+}
 
+// dispatchNote is the suffix printed after "triggered."
+func dispatchNote(d github.Dispatch) string {
+	if d.ID == "" {
+		return " (workflow has no " + github.DispatchInput + " input; run matching is best-effort)"
+	}
+	return " (dispatch " + d.ID + ")"
+}
+
+// executeDeploy triggers the deploy workflow for one target and, with wait,
+// blocks on the run and then on the service's ECS rollout. The trigger and
+// outcome are recorded in the audit log under entry, whose Service is the ECS
+// service being deployed. Deploy locks taken beforehand are released (or,
+// without wait, left to lapse). It exits non-zero on any failure.
+func executeDeploy(ctx context.Context, client *dwaws.Client, repo string, tgt model.DeployTarget, img model.Image, wait bool, entry audit.Entry) {
 	inputs := map[string]string{
 		"service": tgt.WorkflowSvc,
 		"tag":     img.Digest, // full sha256:... digest, as the workflow expects
 	}
-	since := time.Now()
+	entry.Workflow = tgt.Workflow
+	entry.Digest = img.Digest
 	fmt.Printf("\nTriggering %s ...\n", tgt.Workflow)
-	if err := github.TriggerWorkflow(*repo, tgt.Workflow, inputs); err != nil {
+	d, err := github.DispatchWorkflow(repo, tgt.Workflow, inputs)
+	if err != nil {
+		recordAudit(entry, "error", err.Error())
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
-	fmt.Printf("  triggered.\n")
+	recordAudit(entry, "triggered", dispatchDetail(entry.Detail, d))
+	fmt.Printf("  triggered.%s\n", dispatchNote(d))
 
-	if !*wait {
+	if !wait {
 		fmt.Printf("Deploy started on GitHub Actions (%s). Use --wait to block on completion.\n", tgt.Workflow)
+		finishLocks(false)
 		return
 	}
 
-	conclusion, err := waitForRun(*repo, tgt.Workflow, since)
+	runID, conclusion, err := waitForRun(repo, d)
+	entry.RunID = runID
 	if err != nil {
+		recordAudit(entry, "error", err.Error())
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	fmt.Printf("  result:   %s\n", conclusion)
 	if conclusion != "success" {
-		os.Exit(1)
+		recordAudit(entry, conclusion, "")
+		exit(1)
 	}
+
+	refreshLocks()
+	if err := waitForSteadyState(ctx, client, entry.Service, img.Digest, d.Since, ecsRolloutTimeout); err != nil {
+		recordAudit(entry, "failure", err.Error())
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	recordAudit(entry, "success", "")
+	finishLocks(true)
 }
 
 // runDeployCategory implements `dwtool deploy-category <category> <digest>`,
@@ -258,17 +477,25 @@ func runDeployCategory(args []string) {
 	digest, rest := peelPositional(rest)
 
 	fs := flag.NewFlagSet("deploy-category", flag.ExitOnError)
+	region := fs.String("region", config.DefaultRegion, "AWS region")
+	cluster := fs.String("cluster", config.DefaultCluster, "ECS cluster name")
 	repo := fs.String("repo", config.DefaultRepo, "GitHub repository (owner/name)")
 	workersJSON := fs.String("workers-json", "", "path to config/workers.json (auto-detected from $LJHOME if empty)")
-	target := fs.String("target", "worker22", "worker deploy target: worker22 (default) or worker")
+	target := addWorkerTargetFlag(fs)
 	limit := fs.Int("limit", 50, "how many recent GHCR images to search when resolving the digest")
-	wait := fs.Bool("wait", false, "block until all triggered runs complete; exit non-zero on any failure")
+	wait := fs.Bool("wait", false, "block until all triggered runs complete and ECS is steady on the new image; exit non-zero on any failure")
 	yes := fs.Bool("yes", false, "actually trigger the deploys (without this flag the command is a dry run)")
+	guard := addGuardFlags(fs, region)
+	allowUnverified := addProvenanceFlag(fs)
 
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: dwtool deploy-category <category> <digest> [options]\n\n")
-		fmt.Fprintf(os.Stderr, "Deploy one image digest to every worker in a workers.json category.\n")
-		fmt.Fprintf(os.Stderr, "Without --yes this is a DRY RUN that only prints the plan.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: dwtool deploy-category <category> <image> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Deploy one image to every worker in a workers.json category. <image>\n")
+		fmt.Fprintf(os.Stderr, "takes the same forms as for deploy (digest, git SHA, tag, latest or\n")
+		fmt.Fprintf(os.Stderr, "current:<service>).\n")
+		fmt.Fprintf(os.Stderr, "Every worker's deploy lock is taken first, and deploys during a freeze\n")
+		fmt.Fprintf(os.Stderr, "window need --force-freeze --reason. Without --yes this is a DRY RUN\n")
+		fmt.Fprintf(os.Stderr, "that only prints the plan.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
@@ -286,21 +513,17 @@ func runDeployCategory(args []string) {
 		digest, leftover = leftover[0], leftover[1:]
 	}
 	if category == "" || digest == "" {
-		fmt.Fprintf(os.Stderr, "Error: both <category> and <digest> are required\n\n")
+		fmt.Fprintf(os.Stderr, "Error: both <category> and <image> are required\n\n")
 		fs.Usage()
 		os.Exit(1)
 	}
 
-	var workflow, imageBase string
-	switch *target {
-	case "worker22":
-		workflow, imageBase = config.WorkflowWorker22, config.ImageBaseWorker22
-	case "worker":
-		workflow, imageBase = config.WorkflowWorker, config.ImageBaseWorker
-	default:
-		fmt.Fprintf(os.Stderr, "Error: unknown --target %q; use worker22 or worker\n", *target)
+	tgt, ok := serviceCatalog().Target(*target)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown --target %q; use one of %s\n", *target, strings.Join(serviceCatalog().TargetLabels(), ", "))
 		os.Exit(1)
 	}
+	workflow, imageBase := tgt.Workflow, tgt.ImageBase
 
 	workers, err := config.LoadWorkers(*workersJSON)
 	if err != nil {
@@ -320,7 +543,7 @@ func runDeployCategory(args []string) {
 	}
 	sort.Strings(names)
 
-	img, err := resolveDigest(*repo, imageBase, digest, *limit)
+	img, err := resolveImageRef(*repo, *region, *cluster, imageBase, digest, *limit)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -329,67 +552,146 @@ func runDeployCategory(args []string) {
 	fmt.Printf("Deploy plan for category %q (%d workers)\n", category, len(names))
 	fmt.Printf("  workflow: %s\n", workflow)
 	fmt.Printf("  source:   %s\n", imageBase)
-	fmt.Printf("  deploy:   %s\n", shortDigest(img.Digest))
+	if ref := refNote(digest, img); ref != "" {
+		fmt.Printf("  ref:      %s\n", ref)
+	}
+	fmt.Printf("  deploy:   %s\n", img.Digest)
 	if img.CommitMsg != "" {
 		fmt.Printf("  commit:   %s\n", img.CommitMsg)
 	}
 	fmt.Printf("  workers:  %s\n", strings.Join(names, ", "))
+	provNote := verifyProvenance(*repo, imageBase, img, *allowUnverified, *guard.reason, !*yes)
 
+	services := workerServices(names)
 	if !*yes {
+		printGuardStatus(*region, services)
 		fmt.Printf("\n[dry run] no deploys triggered. Re-run with --yes to execute.\n")
 		return
 	}
 
-	// Trigger each worker sequentially. When --wait is set we find each
-	// worker's run immediately after triggering it (before the next trigger),
-	// so "most recent run of this workflow after `since`" reliably maps to the
-	// worker we just triggered -- the worker deploy workflow is shared, so the
-	// run can only be disambiguated by trigger order.
+	client := newAWSClient(*region, *cluster)
+	note := joinNotes(provNote, guardDeploy(guard, services, "deploy-category "+category+" "+shortDigest(img.Digest)))
+	results := deployWorkers(context.Background(), client, *repo, workflow, "deploy-category", category, names, img.Digest, *wait, note)
+	finishLocks(*wait)
+	if anyFailed(results) {
+		os.Exit(1)
+	}
+	if *wait {
+		fmt.Printf("\nAll deploys succeeded.\n")
+	}
+}
+
+// addWorkerTargetFlag registers --target on fs, listing the catalog's deploy
+// targets and defaulting to the workers' default one.
+func addWorkerTargetFlag(fs *flag.FlagSet) *string {
+	catalog := serviceCatalog()
+	labels := catalog.TargetLabels()
+	def := ""
+	// Every worker matches the same entry, so any name will do.
+	if info, ok := catalog.Lookup(catalog.WorkerService("")); ok && len(info.Targets) > 0 {
+		def = info.Targets[0].Label
+	} else if len(labels) > 0 {
+		def = labels[0]
+	}
+	return fs.String("target", def, "worker deploy target: one of "+strings.Join(labels, ", "))
+}
+
+// workerServices maps worker names to their ECS service names.
+func workerServices(names []string) []string {
+	catalog := serviceCatalog()
+	services := make([]string, len(names))
+	for i, name := range names {
+		services[i] = catalog.WorkerService(name)
+	}
+	return services
+}
+
+// workerResult is how one worker's deploy ended.
+type workerResult struct {
+	Name   string `json:"name"`
+	RunID  int    `json:"run_id,omitempty"`
+	Result string `json:"result"` // triggered, success, failure, cancelled, error, skipped
+	Detail string `json:"detail,omitempty"`
+}
+
+// ok reports whether the deploy went (or, unwaited, is going) fine.
+func (r workerResult) ok() bool {
+	return r.Result == "success" || r.Result == "triggered"
+}
+
+// anyFailed reports whether any worker's deploy didn't go fine.
+func anyFailed(results []workerResult) bool {
+	for _, r := range results {
+		if !r.ok() {
+			return true
+		}
+	}
+	return false
+}
+
+// deployWorkers triggers workflow once per worker with the given tag and,
+// with wait, polls every run to completion and follows each successful
+// worker's ECS rollout, recording each worker's deploy in the audit log as
+// action. It returns each worker's result in names order; a trigger error,
+// a missing run, a non-success conclusion, or an ECS rollout that failed or
+// didn't land tag all count as failures. note, if set, is added to each
+// worker's audit detail. Deploy locks are left to the caller.
+func deployWorkers(ctx context.Context, client *dwaws.Client, repo, workflow, action, category string, names []string, tag string, wait bool, note string) []workerResult {
+	// Trigger each worker sequentially. Every dispatch carries its own
+	// dispatch ID, so each worker's run is found exactly even though the
+	// worker deploy workflow is shared.
 	type runRef struct {
-		name  string
-		runID int
+		idx     int // into results
+		since   time.Time
+		findErr error
+		entry   audit.Entry
 	}
+	results := make([]workerResult, len(names))
 	var runs []runRef
-	failed := false
 
-	for _, name := range names {
-		inputs := map[string]string{"service": name, "tag": img.Digest}
-		since := time.Now()
+	for i, name := range names {
+		results[i].Name = name
+		inputs := map[string]string{"service": name, "tag": tag}
+		entry := audit.New("cli", action, serviceCatalog().WorkerService(name))
+		entry.Workflow = workflow
+		entry.Digest = tag
+		entry.Detail = "category " + category
+		if note != "" {
+			entry.Detail += "; " + note
+		}
 		fmt.Printf("\nTriggering %s for %s ...\n", workflow, name)
-		if err := github.TriggerWorkflow(*repo, workflow, inputs); err != nil {
+		d, err := github.DispatchWorkflow(repo, workflow, inputs)
+		if err != nil {
+			recordAudit(entry, "error", err.Error())
 			fmt.Fprintf(os.Stderr, "  error triggering %s: %v\n", name, err)
-			failed = true
+			results[i].Result, results[i].Detail = "error", err.Error()
 			continue
 		}
-		fmt.Printf("  triggered.\n")
-
-		if *wait {
-			id := 0
-			deadline := time.Now().Add(90 * time.Second)
-			for id == 0 && time.Now().Before(deadline) {
-				time.Sleep(3 * time.Second)
-				found, ferr := github.FindWorkflowRun(*repo, workflow, since)
-				if ferr != nil {
-					fmt.Fprintf(os.Stderr, "  warn: finding run for %s: %v\n", name, ferr)
-					break
-				}
-				id = found
-			}
-			if id == 0 {
-				fmt.Fprintf(os.Stderr, "  warn: could not find run for %s (it may still appear on GitHub)\n", name)
+		recordAudit(entry, "triggered", dispatchDetail(entry.Detail, d))
+		fmt.Printf("  triggered.%s\n", dispatchNote(d))
+		results[i].Result = "triggered"
+
+		if wait {
+			// Without a dispatch ID the only way to tell the shared
+			// workflow's runs apart is trigger order, so find this run
+			// before sending the next dispatch.
+			id, err := findRun(repo, d, 90*time.Second)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  warn: %s: %v\n", name, err)
 			} else {
 				fmt.Printf("  run id:   %d\n", id)
 			}
-			runs = append(runs, runRef{name, id})
+			entry.RunID = id
+			results[i].RunID = id
+			runs = append(runs, runRef{i, d.Since, err, entry})
 		}
 	}
 
-	if !*wait {
-		if failed {
-			os.Exit(1)
+	if !wait {
+		if !anyFailed(results) {
+			fmt.Printf("\nAll triggers sent. Use --wait to block on completion.\n")
 		}
-		fmt.Printf("\nAll triggers sent. Use --wait to block on completion.\n")
-		return
+		return results
 	}
 
 	fmt.Printf("\nWaiting for %d runs to complete ...\n", len(runs))
@@ -401,22 +703,26 @@ func runDeployCategory(args []string) {
 			if done[i] {
 				continue
 			}
-			if runs[i].runID == 0 {
+			r := &results[runs[i].idx]
+			if r.RunID == 0 {
+				recordAudit(runs[i].entry, "error", runs[i].findErr.Error())
+				r.Result, r.Detail = "error", runs[i].findErr.Error()
 				done[i] = true
-				failed = true
 				continue
 			}
-			status, conclusion, gerr := github.GetWorkflowRun(*repo, runs[i].runID)
+			status, conclusion, gerr := github.GetWorkflowRun(repo, r.RunID)
 			if gerr != nil {
-				fmt.Fprintf(os.Stderr, "  warn: polling %s: %v\n", runs[i].name, gerr)
+				fmt.Fprintf(os.Stderr, "  warn: polling %s: %v\n", r.Name, gerr)
 				allDone = false
 				continue
 			}
 			if status == "completed" {
 				done[i] = true
-				fmt.Printf("  %s: %s\n", runs[i].name, conclusion)
+				fmt.Printf("  %s: %s\n", r.Name, conclusion)
 				if conclusion != "success" {
-					failed = true
+					recordAudit(runs[i].entry, conclusion, "")
+					r.Result = conclusion
+					r.Detail = printFailedStep(repo, r.RunID, nil, "    ")
 				}
 			} else {
 				allDone = false
@@ -427,14 +733,36 @@ func runDeployCategory(args []string) {
 		}
 		if time.Now().After(pollDeadline) {
 			fmt.Fprintf(os.Stderr, "  timed out waiting for some runs; check GitHub Actions\n")
-			failed = true
+			for i := range runs {
+				if !done[i] {
+					r := &results[runs[i].idx]
+					recordAudit(runs[i].entry, "error", "timed out waiting for the run")
+					r.Result, r.Detail = "error", "timed out waiting for the run"
+				}
+			}
 			break
 		}
 		time.Sleep(5 * time.Second)
 	}
 
-	if failed {
-		os.Exit(1)
+	// The workers roll out concurrently, so following them one at a time
+	// costs little more than the slowest.
+	refreshLocks()
+	for _, run := range runs {
+		r := &results[run.idx]
+		if r.Result != "triggered" {
+			continue
+		}
+		fmt.Printf("\nECS rollout of %s ...\n", run.entry.Service)
+		if err := waitForSteadyState(ctx, client, run.entry.Service, tag, run.since, ecsRolloutTimeout); err != nil {
+			recordAudit(run.entry, "failure", err.Error())
+			fmt.Fprintf(os.Stderr, "  error: %v\n", err)
+			r.Result, r.Detail = "failure", err.Error()
+			continue
+		}
+		recordAudit(run.entry, "success", "")
+		r.Result = "success"
 	}
-	fmt.Printf("\nAll deploys succeeded.\n")
+
+	return results
 }
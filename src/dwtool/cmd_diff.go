@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"dreamwidth.org/dwtool/internal/config"
+	"dreamwidth.org/dwtool/internal/github"
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// resolveRunningImage finds the GHCR image a service is running, trying the
+// preferred deploy target's image base first and then the service's others,
+// since a service can be running an image from a source it's no longer
+// deployed from by default.
+func resolveRunningImage(repo string, svc model.Service, preferred model.DeployTarget, limit int) (model.Image, error) {
+	if svc.ImageDigest == "" {
+		return model.Image{}, fmt.Errorf("can't tell which image %s is running", svc.Name)
+	}
+	bases := []string{preferred.ImageBase}
+	for _, t := range svc.DeployTargets {
+		if t.ImageBase != preferred.ImageBase {
+			bases = append(bases, t.ImageBase)
+		}
+	}
+	var firstErr error
+	for _, base := range bases {
+		img, err := resolveDigest(repo, base, svc.ImageDigest, limit)
+		if err == nil {
+			return img, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return model.Image{}, fmt.Errorf("running image: %w", firstErr)
+}
+
+// releaseDiffBetween resolves both images' git SHAs and diffs them.
+func releaseDiffBetween(repo string, running, candidate model.Image) (model.ReleaseDiff, error) {
+	base, head := github.CommitSHA(running), github.CommitSHA(candidate)
+	switch {
+	case base == "":
+		return model.ReleaseDiff{}, fmt.Errorf("running image %s has no git SHA tag", shortDigest(running.Digest))
+	case head == "":
+		return model.ReleaseDiff{}, fmt.Errorf("image %s has no git SHA tag", shortDigest(candidate.Digest))
+	}
+	return github.ReleaseDiff(repo, base, head)
+}
+
+// runDiff implements `dwtool diff <service> <image>`: the commits between
+// what a service is running and a candidate image.
+func runDiff(args []string) {
+	service, rest := peelPositional(args)
+	digest, rest := peelPositional(rest)
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "output JSON")
+	region := fs.String("region", config.DefaultRegion, "AWS region")
+	cluster := fs.String("cluster", config.DefaultCluster, "ECS cluster name")
+	repo := fs.String("repo", config.DefaultRepo, "GitHub repository (owner/name)")
+	target := fs.String("target", "", "deploy target label when a service has more than one (e.g. web22)")
+	limit := fs.Int("limit", 100, "how many recent GHCR images to search when resolving digests")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dwtool diff <service> <image> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "List the commits between the image a service is running and a candidate\n")
+		fmt.Fprintf(os.Stderr, "image, with PR numbers and authors. Uses the local git checkout when it\n")
+		fmt.Fprintf(os.Stderr, "has both commits, else the GitHub compare API. Changes to bin/upgrading\n")
+		fmt.Fprintf(os.Stderr, "and the DB schema (update-db*.pl) are called out.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  dwtool diff web-stable-service 110ddd7f52bd\n")
+		fmt.Fprintf(os.Stderr, "  dwtool diff worker-esn-process-sub-service 8bffde07b265 --json\n")
+		fmt.Fprintf(os.Stderr, "  dwtool diff web-stable-service current:web-canary\n")
+	}
+	if err := fs.Parse(rest); err != nil {
+		os.Exit(1)
+	}
+	leftover := fs.Args()
+	if service == "" && len(leftover) > 0 {
+		service, leftover = leftover[0], leftover[1:]
+	}
+	if digest == "" && len(leftover) > 0 {
+		digest = leftover[0]
+	}
+	if service == "" || digest == "" {
+		fmt.Fprintf(os.Stderr, "Error: both <service> and <image> are required\n\n")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	client := newAWSClient(*region, *cluster)
+	ctx := context.Background()
+
+	services, err := client.DescribeServices(ctx, []string{service})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(services) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: service %q not found in cluster %q\n", service, *cluster)
+		os.Exit(1)
+	}
+	svc := services[0]
+	if updated, _ := client.FetchServiceImages(ctx, []model.Service{svc}); len(updated) > 0 {
+		svc = updated[0]
+	}
+
+	tgt, err := resolveDeployTarget(svc, *target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	candidate, err := resolveImageRef(*repo, *region, *cluster, tgt.ImageBase, digest, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	running, err := resolveRunningImage(*repo, svc, tgt, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	diff, err := releaseDiffBetween(*repo, running, candidate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOut {
+		emitJSON(diff)
+		return
+	}
+
+	fmt.Printf("Release diff for %s\n", svc.Name)
+	fmt.Printf("  running:  %s (%s)\n", shortDigest(running.Digest), shortSHA(diff.Base))
+	if ref := refNote(digest, candidate); ref != "" {
+		fmt.Printf("  ref:      %s\n", ref)
+	}
+	fmt.Printf("  deploy:   %s (%s)\n", candidate.Digest, shortSHA(diff.Head))
+	fmt.Printf("  source:   %s\n", diff.Source)
+	printReleaseDiff(diff)
+}
+
+// printReleaseDiff prints a diff's commits and flagged files.
+func printReleaseDiff(diff model.ReleaseDiff) {
+	n := fmt.Sprintf("%d", len(diff.Commits))
+	if diff.Truncated {
+		n += "+"
+	}
+	switch {
+	case len(diff.Commits) == 0:
+		fmt.Printf("  commits:  none (same commit)\n")
+		return
+	case diff.Rollback:
+		fmt.Printf("  commits:  %s, REMOVED by this deploy (the image is older than what's running)\n", n)
+	default:
+		fmt.Printf("  commits:  %s\n", n)
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  SHA\tPR\tAUTHOR\tSUBJECT")
+	for _, c := range diff.Commits {
+		pr := "-"
+		if c.PR != 0 {
+			pr = fmt.Sprintf("#%d", c.PR)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", shortSHA(c.SHA), pr, dash(c.Author), c.Subject)
+	}
+	w.Flush()
+
+	if len(diff.Flagged) > 0 {
+		fmt.Println()
+		for _, f := range diff.Flagged {
+			label := "bin/upgrading change"
+			if f.Kind == "schema" {
+				label = "DB SCHEMA change"
+			}
+			fmt.Printf("  ! %s: %s\n", label, f.Path)
+		}
+	}
+}
+
+// shortSHA abbreviates a git SHA to the usual 7 characters.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return dash(sha)
+}
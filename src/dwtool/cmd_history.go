@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"dreamwidth.org/dwtool/internal/audit"
+	"dreamwidth.org/dwtool/internal/config"
+)
+
+// recordAudit appends entry to the audit log with the given conclusion. A
+// failure to record is reported but never stops the deploy it describes.
+func recordAudit(entry audit.Entry, conclusion, detail string) {
+	entry.Conclusion = conclusion
+	if detail != "" {
+		entry.Detail = detail
+	}
+	if err := audit.Record(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "  warn: audit log: %v\n", err)
+	}
+}
+
+// runHistory implements `dwtool history`, listing past deploys, rollbacks and
+// traffic changes from the local audit log.
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "output JSON")
+	service := fs.String("service", "", "only actions on this service (with or without the -service suffix)")
+	action := fs.String("action", "", "only this action: deploy, deploy-category, deploy-workers, rollback, rollout, traffic, images-prune")
+	limit := fs.Int("limit", 50, "max entries to show (0 for all)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dwtool history [options]\n\n")
+		fmt.Fprintf(os.Stderr, "List deploys, rollbacks and traffic changes made with dwtool, newest\n")
+		fmt.Fprintf(os.Stderr, "first, from the audit log at %s.\n\n", config.AuditLogPath())
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  dwtool history\n")
+		fmt.Fprintf(os.Stderr, "  dwtool history --service web-stable\n")
+		fmt.Fprintf(os.Stderr, "  dwtool history --action traffic --json\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+
+	entries, err := audit.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	entries = audit.Collapse(entries)
+
+	want := strings.TrimSuffix(*service, "-service")
+	var out []audit.Entry
+	for _, e := range entries {
+		if want != "" && strings.TrimSuffix(e.Service, "-service") != want {
+			continue
+		}
+		if *action != "" && e.Action != *action {
+			continue
+		}
+		out = append(out, e)
+		if *limit > 0 && len(out) >= *limit {
+			break
+		}
+	}
+
+	if *jsonOut {
+		emitJSON(out)
+		return
+	}
+	if len(out) == 0 {
+		fmt.Fprintln(os.Stderr, "No history.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTOR\tACTION\tSERVICE\tDIGEST\tRUN\tRESULT\tDETAIL")
+	for _, e := range out {
+		run := "-"
+		if e.RunID != 0 {
+			run = strconv.Itoa(e.RunID)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Local().Format("2006-01-02 15:04"),
+			e.Actor,
+			e.Action,
+			dash(e.Service),
+			dash(shortDigest(e.Digest)),
+			run,
+			dash(e.Conclusion),
+			e.Detail,
+		)
+	}
+	w.Flush()
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"dreamwidth.org/dwtool/internal/audit"
+	"dreamwidth.org/dwtool/internal/config"
+	"dreamwidth.org/dwtool/internal/lock"
+)
+
+// Deploys take an advisory lock on every service they touch for as long as
+// dwtool is following them, and refuse to start during a freeze window
+// unless --force-freeze is given with a --reason. Without --wait dwtool stops
+// following a deploy once it's triggered, so the lock is left to lapse after
+// noWaitLockHold instead, long enough for the rollout to land.
+
+// noWaitLockHold is how long a deploy's locks outlive a run without --wait.
+const noWaitLockHold = 15 * time.Minute
+
+// guardOptions are the lock and freeze flags the deploy commands share.
+type guardOptions struct {
+	region      *string
+	reason      *string
+	forceFreeze *bool
+}
+
+// addGuardFlags registers --reason and --force-freeze on fs. region is the
+// command's --region, where the SSM lock backend lives.
+func addGuardFlags(fs *flag.FlagSet, region *string) guardOptions {
+	return guardOptions{
+		region:      region,
+		reason:      fs.String("reason", "", "why you're deploying; recorded on the lock and required with --force-freeze"),
+		forceFreeze: fs.Bool("force-freeze", false, "deploy despite an active freeze window (needs --reason)"),
+	}
+}
+
+var (
+	locksMu    sync.Mutex
+	locker     *lock.Locker
+	heldLocks  []lock.Lock
+	signalOnce sync.Once
+)
+
+// guardDeploy checks services against the freeze windows and takes their
+// deploy locks, exiting if either stops the deploy. It returns a note for
+// the audit detail when a freeze was overridden. defaultReason describes the
+// deploy on the lock when --reason isn't given.
+func guardDeploy(g guardOptions, services []string, defaultReason string) string {
+	note, err := checkFreeze(services, *g.forceFreeze, *g.reason)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if note != "" {
+		fmt.Printf("  freeze:   overridden (%s)\n", note)
+	}
+
+	reason := *g.reason
+	if reason == "" {
+		reason = defaultReason
+	}
+	if err := acquireLocks(*g.region, services, reason); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	return note
+}
+
+// checkFreeze returns an error if any of services is in an active freeze
+// window, unless force is set with a reason, in which case it returns a note
+// naming the window and the reason.
+func checkFreeze(services []string, force bool, reason string) (string, error) {
+	if force && strings.TrimSpace(reason) == "" {
+		return "", fmt.Errorf("--force-freeze needs a --reason")
+	}
+	err := lock.CheckFreeze(services)
+	var frozen *lock.FreezeError
+	if !errors.As(err, &frozen) {
+		return "", err
+	}
+	if !force {
+		return "", fmt.Errorf("%v; re-run with --force-freeze --reason \"...\" to deploy anyway", err)
+	}
+	return fmt.Sprintf("freeze %s overridden: %s", frozen.Window.Name, reason), nil
+}
+
+// printGuardStatus adds the lock and freeze state of services to a dry-run
+// plan, so a blocked deploy is visible before --yes. Problems reading either
+// are only warnings here.
+func printGuardStatus(region string, services []string) {
+	if err := lock.CheckFreeze(services); err != nil {
+		fmt.Printf("  freeze:   %v\n", err)
+	}
+	lk, err := lock.Open(region)
+	if err != nil {
+		fmt.Printf("  lock:     %v\n", err)
+		return
+	}
+	for _, svc := range services {
+		l, err := lk.Get(svc)
+		if err != nil {
+			fmt.Printf("  lock:     %v\n", err)
+			return
+		}
+		if l != nil && !l.Expired() {
+			fmt.Printf("  lock:     %v\n", &lock.HeldError{Lock: *l})
+		}
+	}
+}
+
+// acquireLocks takes the deploy lock on each service, releasing any already
+// taken if one is held by someone else. Locks are released by releaseLocks,
+// exit, or an interrupt.
+func acquireLocks(region string, services []string, reason string) error {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if locker == nil {
+		lk, err := lock.Open(region)
+		if err != nil {
+			return err
+		}
+		locker = lk
+	}
+	signalOnce.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-ch
+			fmt.Fprintf(os.Stderr, "\nInterrupted; releasing deploy locks.\n")
+			exit(130)
+		}()
+	})
+
+	var taken []lock.Lock
+	for _, svc := range services {
+		l, err := locker.Acquire(svc, reason, locker.TTL())
+		if err != nil {
+			for _, t := range taken {
+				locker.Release(t)
+			}
+			var held *lock.HeldError
+			if errors.As(err, &held) {
+				return fmt.Errorf("%v; wait for it, or ask them to run: dwtool lock %s --release", err, svc)
+			}
+			return fmt.Errorf("locking %s: %w", svc, err)
+		}
+		taken = append(taken, l)
+	}
+	heldLocks = append(heldLocks, taken...)
+	return nil
+}
+
+// extendLocks pushes the expiry of every held lock d into the future.
+func extendLocks(d time.Duration) {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	for i, l := range heldLocks {
+		extended, err := locker.Extend(l, d)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  warn: lock: %v\n", err)
+			continue
+		}
+		heldLocks[i] = extended
+	}
+}
+
+// refreshLocks resets the expiry of every held lock to the lock TTL from
+// now, for deploys that outlast it (rollouts, long ECS rollouts).
+func refreshLocks() {
+	if locker != nil {
+		extendLocks(locker.TTL())
+	}
+}
+
+// releaseLocks releases every lock this process holds.
+func releaseLocks() {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	for _, l := range heldLocks {
+		if err := locker.Release(l); err != nil {
+			fmt.Fprintf(os.Stderr, "  warn: releasing lock on %s: %v\n", l.Service, err)
+		}
+	}
+	heldLocks = nil
+}
+
+// finishLocks releases held locks after a deploy dwtool followed to the end,
+// or leaves them to lapse after noWaitLockHold when it didn't wait.
+func finishLocks(waited bool) {
+	if waited {
+		releaseLocks()
+		return
+	}
+	extendLocks(noWaitLockHold)
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if len(heldLocks) > 0 {
+		fmt.Printf("Deploy lock held until %s while the rollout lands (dwtool lock <service> --release to free it sooner).\n",
+			time.Now().Add(noWaitLockHold).Format("15:04"))
+	}
+	heldLocks = nil
+}
+
+// exit releases any deploy locks held and exits with code.
+func exit(code int) {
+	releaseLocks()
+	os.Exit(code)
+}
+
+// runLock implements `dwtool lock`: list deploy locks, or take or release
+// one by hand.
+func runLock(args []string) {
+	service, rest := peelPositional(args)
+
+	fs := flag.NewFlagSet("lock", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "output JSON")
+	region := fs.String("region", config.DefaultRegion, "AWS region (for the SSM lock backend)")
+	reason := fs.String("reason", "", "why the service is locked (required to take a lock)")
+	ttl := fs.Duration("ttl", 0, "how long to hold the lock (default: the configured lock TTL)")
+	release := fs.Bool("release", false, "release the service's lock instead of taking it")
+	force := fs.Bool("force", false, "with --release, release a lock held by someone else")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dwtool lock [<service>] [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Without a service, list deploy locks. With one, take its lock (e.g. to\n")
+		fmt.Fprintf(os.Stderr, "hold off deploys while investigating), or release it with --release.\n")
+		fmt.Fprintf(os.Stderr, "deploy, deploy-category, rollback, rollout and the TUI take these locks\n")
+		fmt.Fprintf(os.Stderr, "themselves and refuse to deploy a service someone else holds.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  dwtool lock\n")
+		fmt.Fprintf(os.Stderr, "  dwtool lock web-stable-service --reason \"investigating 500s\" --ttl 2h\n")
+		fmt.Fprintf(os.Stderr, "  dwtool lock web-stable-service --release\n")
+	}
+	if err := fs.Parse(rest); err != nil {
+		os.Exit(1)
+	}
+	if service == "" && fs.NArg() > 0 {
+		service = fs.Arg(0)
+	}
+
+	lk, err := lock.Open(*region)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case service == "":
+		locks, err := lk.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *jsonOut {
+			emitJSON(locks)
+			return
+		}
+		if len(locks) == 0 {
+			fmt.Fprintln(os.Stderr, "No deploy locks.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SERVICE\tOWNER\tEXPIRES\tREASON")
+		for _, l := range locks {
+			expires := l.Expires.Local().Format("2006-01-02 15:04")
+			if l.Expired() {
+				expires += " (expired)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", l.Service, l.Owner, expires, dash(l.Reason))
+		}
+		w.Flush()
+
+	case *release:
+		cur, err := lk.Get(service)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if cur == nil {
+			fmt.Printf("%s is not locked.\n", service)
+			return
+		}
+		if !*force && !cur.Expired() && cur.Owner != audit.Actor() {
+			fmt.Fprintf(os.Stderr, "Error: %v; use --force to release it anyway\n", &lock.HeldError{Lock: *cur})
+			os.Exit(1)
+		}
+		if err := lk.ForceRelease(service); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Released the lock on %s (held by %s).\n", service, cur.Owner)
+
+	default:
+		if strings.TrimSpace(*reason) == "" {
+			fmt.Fprintf(os.Stderr, "Error: --reason is required to take a lock\n")
+			os.Exit(1)
+		}
+		d := *ttl
+		if d <= 0 {
+			d = lk.TTL()
+		}
+		l, err := lk.Acquire(service, *reason, d)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *jsonOut {
+			emitJSON(l)
+			return
+		}
+		fmt.Printf("Locked %s until %s.\n", service, l.Expires.Local().Format("2006-01-02 15:04"))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"dreamwidth.org/dwtool/internal/github"
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// Before a deploy, dwtool checks the image's provenance: it must have a
+// signed build provenance attestation, fetched from GitHub's attestations
+// API and checked against its signing certificate, saying it was built by
+// our CI from a commit that is on the default branch. Images without one,
+// built from forks or unmerged branches, or whose provenance can't be read
+// (including when GitHub can't be asked for the attestation, which is
+// reported as such rather than as a missing one) are refused unless
+// --allow-unverified is given with a --reason. Rollbacks skip the check: the
+// image being restored has already run in production.
+
+// addProvenanceFlag registers --allow-unverified on fs.
+func addProvenanceFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("allow-unverified", false, "deploy an image whose provenance can't be verified (fork, unmerged branch, not built by CI); needs --reason")
+}
+
+// verifyProvenance adds where img was built to a deploy plan and refuses an
+// unverified image, exiting unless allow is set with a reason, in which case
+// it returns a note for the audit detail. On a dry run a refusal is only
+// reported.
+func verifyProvenance(repo, imageBase string, img model.Image, allow bool, reason string, dryRun bool) string {
+	p, err := github.ImageProvenance(repo, imageBase, img.Digest)
+	if err != nil {
+		p.Problems = append(p.Problems, fmt.Sprintf("can't read provenance: %v", err))
+	}
+	printProvenance(p)
+	if p.Verified() {
+		return ""
+	}
+
+	problems := strings.Join(p.Problems, "; ")
+	switch {
+	case allow && strings.TrimSpace(reason) != "":
+		fmt.Printf("  verify:   overridden (%s)\n", reason)
+		return fmt.Sprintf("unverified image (%s) allowed: %s", problems, reason)
+	case dryRun:
+		fmt.Printf("  verify:   would be refused; deploying it needs --allow-unverified --reason \"...\"\n")
+		return ""
+	case allow:
+		fmt.Fprintf(os.Stderr, "Error: --allow-unverified needs a --reason\n")
+	default:
+		fmt.Fprintf(os.Stderr, "Error: image %s failed provenance checks: %s; re-run with --allow-unverified --reason \"...\" to deploy anyway\n",
+			shortDigest(img.Digest), problems)
+	}
+	os.Exit(1)
+	return ""
+}
+
+// printProvenance prints the plan lines for p.
+func printProvenance(p model.Provenance) {
+	built := shortSHA(p.Revision)
+	if p.Branch != "" {
+		built += " on " + p.Branch
+	}
+	if src := strings.TrimPrefix(p.Source, "https://"); src != "" {
+		built += " from " + src
+	}
+	fmt.Printf("  built:    %s\n", built)
+	if p.Attested {
+		fmt.Printf("  builder:  %s\n", dash(p.Builder))
+	} else {
+		fmt.Printf("  builder:  unverified (no signed attestation; commit is from image labels)\n")
+	}
+	if p.Ref != "" {
+		fmt.Printf("  git ref:  %s\n", p.Ref)
+	}
+	for _, problem := range p.Problems {
+		fmt.Printf("  UNVERIFIED: %s\n", problem)
+	}
+}
+
+// joinNotes joins the non-empty audit notes with "; ".
+func joinNotes(notes ...string) string {
+	var out []string
+	for _, n := range notes {
+		if n != "" {
+			out = append(out, n)
+		}
+	}
+	return strings.Join(out, "; ")
+}
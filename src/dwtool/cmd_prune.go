@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dreamwidth.org/dwtool/internal/audit"
+	"dreamwidth.org/dwtool/internal/config"
+	"dreamwidth.org/dwtool/internal/github"
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// prunePlan is what `images prune` keeps and deletes in one package.
+type prunePlan struct {
+	ImageBase string        `json:"image_base"`
+	Versions  int           `json:"versions"`
+	Truncated bool          `json:"truncated"` // more versions exist than --scan looked at
+	Keep      []prunedImage `json:"keep"`
+	Delete    []prunedImage `json:"delete"`
+	Deleted   int           `json:"deleted"`
+	Failed    int           `json:"failed"`
+}
+
+type prunedImage struct {
+	model.Image
+	Reasons []string `json:"reasons,omitempty"`
+	Child   bool     `json:"child,omitempty"` // a manifest of a kept image index
+}
+
+// runImagesPrune implements `dwtool images prune`: delete old GHCR image
+// versions, keeping the newest, anything deployed now, and anything
+// deployed recently.
+func runImagesPrune(args []string) {
+	fs := flag.NewFlagSet("images prune", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "output JSON")
+	region := fs.String("region", config.DefaultRegion, "AWS region")
+	cluster := fs.String("cluster", config.DefaultCluster, "ECS cluster name")
+	repo := fs.String("repo", config.DefaultRepo, "GitHub repository (owner/name)")
+	bases := fs.String("image", "", "comma-separated image bases (or package names, e.g. worker22) to prune (default: every deploy target's)")
+	keep := fs.Int("keep", 20, "keep this many of the most recent tagged images")
+	keepDays := fs.Int("keep-days", 30, "keep anything deployed to a service in this many days, per ECS task definition history")
+	scan := fs.Int("scan", 5000, "most versions to look at per package, newest first")
+	yes := fs.Bool("yes", false, "actually delete (without this flag the command is a dry run)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dwtool images prune [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Delete old GHCR image versions. Keeps the --keep most recent tagged\n")
+		fmt.Fprintf(os.Stderr, "images, every image a service in the cluster is running or rolling out\n")
+		fmt.Fprintf(os.Stderr, "to, and every image a service's task definitions pointed at in the last\n")
+		fmt.Fprintf(os.Stderr, "--keep-days days, along with the per-platform and attestation manifests\n")
+		fmt.Fprintf(os.Stderr, "of each image kept. Everything else, tagged or not, is deleted. Without\n")
+		fmt.Fprintf(os.Stderr, "--yes this is a DRY RUN. Deleting needs a token with delete:packages.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  dwtool images prune                                  # dry run\n")
+		fmt.Fprintf(os.Stderr, "  dwtool images prune --image worker22 --keep 50 --yes\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+	if *keep < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --keep must be at least 1\n")
+		os.Exit(1)
+	}
+
+	if *bases == "" {
+		*bases = strings.Join(serviceCatalog().ImageBases(), ",")
+	}
+	var imageBases []string
+	for _, b := range strings.Split(*bases, ",") {
+		b = strings.TrimSpace(b)
+		if b == "" {
+			continue
+		}
+		if !strings.Contains(b, "/") {
+			b = "ghcr.io/" + strings.SplitN(*repo, "/", 2)[0] + "/" + b
+		}
+		imageBases = append(imageBases, b)
+	}
+
+	client := newAWSClient(*region, *cluster)
+	ctx := context.Background()
+
+	// Anything ECS runs or ran recently is off limits. If that can't be
+	// worked out for every service, nothing is deleted.
+	since := time.Now().AddDate(0, 0, -*keepDays)
+	names, err := client.ListServices(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	deployed := make(map[string][]string) // digest -> reasons
+	for _, name := range names {
+		current, recent, err := client.DeployedImages(ctx, name, since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		// A task definition that names its image by tag could be running
+		// any version of it, so none of that package's images can be
+		// judged safe to delete.
+		for _, rev := range append(slices.Clone(current), recent...) {
+			if rev.Digest == "" && (rev.ImageBase == "" || slices.Contains(imageBases, rev.ImageBase)) {
+				fmt.Fprintf(os.Stderr, "Error: %s: task definition %s uses %s by tag, not digest, so the images it ran can't be identified; nothing was pruned (leave that image out with --image)\n",
+					name, rev.TaskDef, dash(rev.ImageBase))
+				os.Exit(1)
+			}
+		}
+		for _, rev := range current {
+			deployed[rev.Digest] = appendReason(deployed[rev.Digest], "running on "+name)
+		}
+		for _, rev := range recent {
+			deployed[rev.Digest] = appendReason(deployed[rev.Digest], fmt.Sprintf("deployed to %s %s", name, rev.RegisteredAt.Format("2006-01-02")))
+		}
+	}
+
+	var plans []prunePlan
+	for _, base := range imageBases {
+		plan, err := planPrune(*repo, base, *keep, *scan, deployed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", base, err)
+			os.Exit(1)
+		}
+		plans = append(plans, plan)
+	}
+
+	failed := false
+	for i := range plans {
+		plan := &plans[i]
+		if !*jsonOut {
+			printPrunePlan(*plan, *keepDays)
+		}
+		if !*yes || len(plan.Delete) == 0 {
+			continue
+		}
+		for _, img := range plan.Delete {
+			if err := github.DeleteImage(*repo, plan.ImageBase, img.Image); err != nil {
+				plan.Failed++
+				fmt.Fprintf(os.Stderr, "  warn: deleting %s: %v\n", shortDigest(img.Digest), err)
+				continue
+			}
+			plan.Deleted++
+			if !*jsonOut && plan.Deleted%100 == 0 {
+				fmt.Printf("  deleted %d/%d ...\n", plan.Deleted, len(plan.Delete))
+			}
+		}
+		entry := audit.New("cli", "images-prune", plan.ImageBase)
+		conclusion := "success"
+		if plan.Failed > 0 {
+			conclusion = "failure"
+			failed = true
+		}
+		recordAudit(entry, conclusion, fmt.Sprintf("deleted %d of %d versions (%d failed), kept %d", plan.Deleted, plan.Versions, plan.Failed, len(plan.Keep)))
+		if !*jsonOut {
+			fmt.Printf("  deleted %d versions, %d failed\n", plan.Deleted, plan.Failed)
+		}
+	}
+
+	if *jsonOut {
+		emitJSON(plans)
+	} else if !*yes {
+		fmt.Printf("\n[dry run] nothing deleted. Re-run with --yes to delete.\n")
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// planPrune decides what to keep in one package. The newest keep tagged
+// images and any deployed image are kept, with the manifests they index;
+// the rest is deleted.
+func planPrune(repo, imageBase string, keep, scan int, deployed map[string][]string) (prunePlan, error) {
+	plan := prunePlan{ImageBase: imageBase}
+	images, err := github.FetchImages(repo, imageBase, scan)
+	if err != nil {
+		return plan, err
+	}
+	sort.SliceStable(images, func(i, j int) bool { return images[i].CreatedAt.After(images[j].CreatedAt) })
+	plan.Versions = len(images)
+	plan.Truncated = len(images) >= scan
+
+	reasons := make(map[string][]string, len(images))
+	tagged := 0
+	for _, img := range images {
+		if len(img.Tags) > 0 && tagged < keep {
+			tagged++
+			reasons[img.Digest] = append(reasons[img.Digest], fmt.Sprintf("%d most recent", keep))
+		}
+		if r, ok := deployed[img.Digest]; ok {
+			reasons[img.Digest] = append(reasons[img.Digest], r...)
+		}
+	}
+
+	// GHCR lists an index's platform images and attestations as versions
+	// of their own; deleting them would break the image that's kept.
+	children := make(map[string]string) // child digest -> parent digest
+	for _, img := range images {
+		if len(reasons[img.Digest]) == 0 {
+			continue
+		}
+		kids, err := github.ImageChildren(imageBase, img.Digest)
+		if err != nil {
+			return plan, fmt.Errorf("reading manifest of kept image %s: %w", shortDigest(img.Digest), err)
+		}
+		for _, kid := range kids {
+			children[kid] = img.Digest
+		}
+	}
+
+	for _, img := range images {
+		switch {
+		case len(reasons[img.Digest]) > 0:
+			plan.Keep = append(plan.Keep, prunedImage{Image: img, Reasons: reasons[img.Digest]})
+		case children[img.Digest] != "":
+			plan.Keep = append(plan.Keep, prunedImage{Image: img, Child: true, Reasons: []string{"part of " + shortDigest(children[img.Digest])}})
+		default:
+			plan.Delete = append(plan.Delete, prunedImage{Image: img})
+		}
+	}
+	return plan, nil
+}
+
+// printPrunePlan prints one package's plan: the images kept and why, and a
+// summary of what goes.
+func printPrunePlan(plan prunePlan, keepDays int) {
+	untagged, children := 0, 0
+	for _, img := range plan.Delete {
+		if len(img.Tags) == 0 {
+			untagged++
+		}
+	}
+	for _, img := range plan.Keep {
+		if img.Child {
+			children++
+		}
+	}
+
+	fmt.Printf("\n%s: %d versions, keeping %d, deleting %d (%d untagged)\n",
+		plan.ImageBase, plan.Versions, len(plan.Keep), len(plan.Delete), untagged)
+	if plan.Truncated {
+		fmt.Printf("  note: only the newest %d versions were looked at (--scan)\n", plan.Versions)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  DIGEST\tCREATED\tTAGS\tKEPT BECAUSE")
+	for _, img := range plan.Keep {
+		if img.Child {
+			continue
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", shortDigest(img.Digest), img.CreatedAt.Local().Format("2006-01-02 15:04"),
+			dash(strings.Join(img.Tags, ", ")), strings.Join(img.Reasons, "; "))
+	}
+	w.Flush()
+	if children > 0 {
+		fmt.Printf("  (+%d platform and attestation manifests of kept images)\n", children)
+	}
+	if n := len(plan.Delete); n > 0 {
+		oldest, newest := plan.Delete[n-1], plan.Delete[0]
+		fmt.Printf("  delete:   %d versions from %s to %s, none deployed in the last %d days\n", n,
+			oldest.CreatedAt.Local().Format("2006-01-02"), newest.CreatedAt.Local().Format("2006-01-02"), keepDays)
+	}
+}
+
+// appendReason adds r to reasons unless it's already there.
+func appendReason(reasons []string, r string) []string {
+	for _, have := range reasons {
+		if have == r {
+			return reasons
+		}
+	}
+	return append(reasons, r)
+}
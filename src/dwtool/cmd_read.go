@@ -143,17 +143,21 @@ func runServices(args []string) {
 	w.Flush()
 }
 
-// runStatus shows a single service's deployments and running tasks.
+// runStatus shows a single service's deployments, running and recently
+// stopped tasks, and recent ECS service events.
 func runStatus(args []string) {
 	name, rest := peelPositional(args)
 	fs := flag.NewFlagSet("status", flag.ExitOnError)
 	jsonOut := fs.Bool("json", false, "output JSON")
 	region := fs.String("region", config.DefaultRegion, "AWS region")
 	cluster := fs.String("cluster", config.DefaultCluster, "ECS cluster name")
+	events := fs.Int("events", 10, "how many recent service events to show")
+	stopped := fs.Int("stopped", 5, "how many recently stopped tasks to show")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: dwtool status <service> [options]\n\n")
-		fmt.Fprintf(os.Stderr, "Show a service's deployments and running tasks.\n\n")
+		fmt.Fprintf(os.Stderr, "Show a service's deployments, running tasks with their health, recently\n")
+		fmt.Fprintf(os.Stderr, "stopped tasks with why they stopped, and recent ECS service events.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
@@ -194,12 +198,23 @@ func runStatus(args []string) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: could not list tasks: %v\n", err)
 	}
+	var stoppedTasks []model.Task
+	if *stopped > 0 {
+		stoppedTasks, err = client.ListStoppedTasks(ctx, name, *stopped)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not list stopped tasks: %v\n", err)
+		}
+	}
+	if *events >= 0 && len(svc.Events) > *events {
+		svc.Events = svc.Events[:*events]
+	}
 
 	if *jsonOut {
 		emitJSON(struct {
-			Service model.Service `json:"service"`
-			Tasks   []model.Task  `json:"tasks"`
-		}{svc, tasks})
+			Service      model.Service `json:"service"`
+			Tasks        []model.Task  `json:"tasks"`
+			StoppedTasks []model.Task  `json:"stopped_tasks"`
+		}{svc, tasks, stoppedTasks})
 		return
 	}
 
@@ -238,17 +253,39 @@ func runStatus(args []string) {
 	if len(tasks) > 0 {
 		fmt.Println("\n  running tasks:")
 		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
-		fmt.Fprintln(w, "    TASK\tSTATUS\tCONTAINER\tIP\tSTARTED")
+		fmt.Fprintln(w, "    TASK\tSTATUS\tHEALTH\tCONTAINER\tIP\tSTARTED")
 		for _, t := range tasks {
+			fmt.Fprintf(w, "    %s\t%s\t%s\t%s\t%s\t%s\n",
+				t.ID, t.Status, dash(t.Health), dash(t.ContainerName), dash(t.PrivateIP), dwaws.RelativeTime(t.StartedAt))
+		}
+		w.Flush()
+	}
+
+	if len(stoppedTasks) > 0 {
+		fmt.Println("\n  stopped tasks:")
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "    TASK\tSTOPPED\tCODE\tREASON\tEXITS")
+		for _, t := range stoppedTasks {
 			fmt.Fprintf(w, "    %s\t%s\t%s\t%s\t%s\n",
-				t.ID, t.Status, dash(t.ContainerName), dash(t.PrivateIP), dwaws.RelativeTime(t.StartedAt))
+				t.ID, dwaws.RelativeTime(t.StoppedAt), dash(t.StopCode), dash(t.StoppedReason), dash(dwaws.ContainerExits(t)))
 		}
 		w.Flush()
 	}
+
+	if len(svc.Events) > 0 {
+		fmt.Println("\n  events:")
+		for _, e := range svc.Events {
+			fmt.Printf("    %s  %s\n", e.CreatedAt.Local().Format("2006-01-02 15:04:05"), e.Message)
+		}
+	}
 }
 
 // runImages lists deployable GHCR images for a service's image base.
 func runImages(args []string) {
+	if len(args) > 0 && args[0] == "prune" {
+		runImagesPrune(args[1:])
+		return
+	}
 	name, rest := peelPositional(args)
 	fs := flag.NewFlagSet("images", flag.ExitOnError)
 	jsonOut := fs.Bool("json", false, "output JSON")
@@ -261,7 +298,8 @@ func runImages(args []string) {
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: dwtool images <service> [options]\n\n")
 		fmt.Fprintf(os.Stderr, "List recent GHCR images deployable to a service, newest first.\n")
-		fmt.Fprintf(os.Stderr, "The currently-deployed image is marked with '*'.\n\n")
+		fmt.Fprintf(os.Stderr, "The currently-deployed image is marked with '*'.\n")
+		fmt.Fprintf(os.Stderr, "See 'dwtool images prune --help' for deleting old images.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
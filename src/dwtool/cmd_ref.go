@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	dwaws "dreamwidth.org/dwtool/internal/aws"
+	"dreamwidth.org/dwtool/internal/github"
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// The deploy commands take an image reference, not just a digest:
+//
+//	110ddd7f52bd, sha256:110d...   an image digest, full or abbreviated
+//	3f9c2e1                        a git commit SHA (from the image's sha-<hex> tag)
+//	main, release-2026-10          any other image tag, e.g. a branch tag
+//	latest                         the image tagged latest
+//	current:web-canary             whatever that service is running now
+//
+// A bare hex string could be a digest prefix or a git SHA, so it is matched
+// as both. Whatever the form, exactly one image must match; an ambiguous
+// reference is refused rather than guessed at, and the plan always shows the
+// full digest it resolved to.
+
+// currentRefPrefix marks a reference to the image a service is running.
+const currentRefPrefix = "current:"
+
+// resolveImageRef resolves ref to one of the recent GHCR images for
+// imageBase. region and cluster are only used for current:<service>.
+func resolveImageRef(repo, region, cluster, imageBase, ref string, limit int) (model.Image, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return model.Image{}, fmt.Errorf("an image reference is required (digest, git SHA, tag, latest or current:<service>)")
+	}
+	if name, ok := strings.CutPrefix(ref, currentRefPrefix); ok {
+		return resolveCurrentRef(repo, region, cluster, imageBase, name, limit)
+	}
+
+	images, err := github.FetchImages(repo, imageBase, limit)
+	if err != nil {
+		return model.Image{}, fmt.Errorf("listing images for %s: %w", imageBase, err)
+	}
+	matches := matchImageRef(images, ref)
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		if ref == "latest" {
+			// The newest build isn't necessarily one anyone meant to ship.
+			return model.Image{}, fmt.Errorf("no image among the last %d of %s is tagged latest; pass a digest, git SHA or tag instead", limit, imageBase)
+		}
+		return model.Image{}, fmt.Errorf("%q matches no digest, git SHA or tag among the last %d images of %s (try a larger --limit, or recheck it)", ref, limit, imageBase)
+	default:
+		var found []string
+		for _, img := range matches {
+			found = append(found, shortDigest(img.Digest))
+		}
+		return model.Image{}, fmt.Errorf("%q is ambiguous: it matches %d images in %s (%s); pass a full digest", ref, len(matches), imageBase, strings.Join(found, ", "))
+	}
+}
+
+// matchImageRef returns every image that ref could mean, without duplicates.
+func matchImageRef(images []model.Image, ref string) []model.Image {
+	bareRef := strings.TrimPrefix(ref, "sha256:")
+	digestOnly := bareRef != ref
+	hex := isHexRef(bareRef)
+
+	var matches []model.Image
+	for _, img := range images {
+		if imageMatchesRef(img, bareRef, hex, digestOnly) {
+			matches = append(matches, img)
+		}
+	}
+	return matches
+}
+
+func imageMatchesRef(img model.Image, ref string, hex, digestOnly bool) bool {
+	if hex && strings.HasPrefix(strings.TrimPrefix(img.Digest, "sha256:"), ref) {
+		return true
+	}
+	if digestOnly {
+		return false
+	}
+	// A git SHA tag may be shorter or longer than the SHA given.
+	if sha := github.CommitSHA(img); hex && len(ref) >= 7 && sha != "" &&
+		(strings.HasPrefix(sha, ref) || strings.HasPrefix(ref, sha)) {
+		return true
+	}
+	for _, tag := range img.Tags {
+		if tag == ref {
+			return true
+		}
+	}
+	return false
+}
+
+func isHexRef(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveCurrentRef finds the image service is running on ECS, which must
+// also be one of imageBase's images for it to be deployable from there.
+func resolveCurrentRef(repo, region, cluster, imageBase, service string, limit int) (model.Image, error) {
+	service = strings.TrimSpace(service)
+	if service == "" {
+		return model.Image{}, fmt.Errorf("%s needs a service name, e.g. %sweb-canary", currentRefPrefix, currentRefPrefix)
+	}
+	if !strings.HasSuffix(service, "-service") {
+		service += "-service"
+	}
+	client, err := dwaws.NewClient(region, cluster)
+	if err != nil {
+		return model.Image{}, fmt.Errorf("initializing AWS client: %w", err)
+	}
+	ctx := context.Background()
+	services, err := client.DescribeServices(ctx, []string{service})
+	if err != nil {
+		return model.Image{}, err
+	}
+	if len(services) == 0 {
+		return model.Image{}, fmt.Errorf("service %q not found in cluster %q", service, cluster)
+	}
+	if updated, _ := client.FetchServiceImages(ctx, services); len(updated) > 0 {
+		services = updated
+	}
+	svc := services[0]
+	if svc.ImageDigest == "" {
+		return model.Image{}, fmt.Errorf("can't tell which image %s is running", svc.Name)
+	}
+	img, err := resolveDigest(repo, imageBase, svc.ImageDigest, limit)
+	if err != nil {
+		return model.Image{}, fmt.Errorf("%s is running %s, which isn't deployable from %s: %w", svc.Name, shortDigest(svc.ImageDigest), imageBase, err)
+	}
+	return img, nil
+}
+
+// refNote is the plan line explaining what a symbolic reference resolved
+// to, or "" when ref was already a digest.
+func refNote(ref string, img model.Image) string {
+	bare := strings.TrimPrefix(ref, "sha256:")
+	if isHexRef(bare) && strings.HasPrefix(strings.TrimPrefix(img.Digest, "sha256:"), bare) {
+		return ""
+	}
+	return ref
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"dreamwidth.org/dwtool/internal/audit"
+	dwaws "dreamwidth.org/dwtool/internal/aws"
+	"dreamwidth.org/dwtool/internal/config"
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// `dwtool rollback` redeploys whatever a service was running before its
+// current image. The previous image comes from ECS itself (a superseded
+// deployment, else the task definition family's history), not from GHCR
+// ordering, so it's correct even when the bad image wasn't the newest build.
+// Like deploy, it's a dry run unless --yes is given.
+
+// targetForImageBase returns the service's deploy target that builds from
+// imageBase, so a rollback goes back through the same workflow the previous
+// image was deployed with.
+func targetForImageBase(svc model.Service, imageBase string) (model.DeployTarget, bool) {
+	for _, t := range svc.DeployTargets {
+		if t.ImageBase == imageBase {
+			return t, true
+		}
+	}
+	if svc.ImageBase == imageBase && svc.Workflow != "" {
+		return model.DeployTarget{Workflow: svc.Workflow, WorkflowSvc: svc.WorkflowSvc, ImageBase: svc.ImageBase}, true
+	}
+	return model.DeployTarget{}, false
+}
+
+// runRollback implements `dwtool rollback <service>` and
+// `dwtool rollback --category <category>`.
+func runRollback(args []string) {
+	service, rest := peelPositional(args)
+
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	region := fs.String("region", config.DefaultRegion, "AWS region")
+	cluster := fs.String("cluster", config.DefaultCluster, "ECS cluster name")
+	repo := fs.String("repo", config.DefaultRepo, "GitHub repository (owner/name)")
+	category := fs.String("category", "", "roll back every worker in this workers.json category instead of one service")
+	workersJSON := fs.String("workers-json", "", "path to config/workers.json (auto-detected from $LJHOME if empty)")
+	target := fs.String("target", "", "deploy target label, if it can't be inferred from the previous image")
+	limit := fs.Int("limit", 100, "how many recent GHCR images to search when resolving the previous digest")
+	wait := fs.Bool("wait", false, "block until the GitHub Actions run(s) complete and ECS is steady on the previous image; exit non-zero on failure")
+	yes := fs.Bool("yes", false, "actually trigger the rollback (without this flag the command is a dry run)")
+	guard := addGuardFlags(fs, region)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dwtool rollback <service> [options]\n")
+		fmt.Fprintf(os.Stderr, "       dwtool rollback --category <category> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Redeploy the image a service was running before its current one, found\n")
+		fmt.Fprintf(os.Stderr, "from ECS deployment and task definition history. Without --yes this is\n")
+		fmt.Fprintf(os.Stderr, "a DRY RUN that only prints the plan.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  dwtool rollback web-canary-service                  # dry run\n")
+		fmt.Fprintf(os.Stderr, "  dwtool rollback web-canary-service --yes --wait\n")
+		fmt.Fprintf(os.Stderr, "  dwtool rollback --category search --yes\n")
+	}
+	if err := fs.Parse(rest); err != nil {
+		os.Exit(1)
+	}
+	if service == "" && fs.NArg() > 0 {
+		service = fs.Arg(0)
+	}
+	if (service == "") == (*category == "") {
+		fmt.Fprintf(os.Stderr, "Error: give either a <service> or --category\n\n")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	client := newAWSClient(*region, *cluster)
+	ctx := context.Background()
+
+	if *category != "" {
+		rollbackCategory(ctx, client, *repo, *category, *workersJSON, *target, *limit, *wait, *yes, guard)
+		return
+	}
+
+	services, err := client.DescribeServices(ctx, []string{service})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(services) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: service %q not found in cluster %q\n", service, *cluster)
+		os.Exit(1)
+	}
+	svc := services[0]
+	if updated, _ := client.FetchServiceImages(ctx, []model.Service{svc}); len(updated) > 0 {
+		svc = updated[0]
+	}
+
+	current, prev, err := client.PreviousImage(ctx, svc.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	tgt, ok := targetForImageBase(svc, prev.ImageBase)
+	if *target != "" || !ok {
+		tgt, err = resolveDeployTarget(svc, *target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	img, err := resolveDigest(*repo, tgt.ImageBase, prev.Digest, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: previous image %s (from %s): %v\n", shortDigest(prev.Digest), prev.TaskDef, err)
+		os.Exit(1)
+	}
+
+	printDeployPlan("Rollback plan for "+svc.Name, svc, tgt, img, "")
+	fmt.Printf("  from:     %s (task definition %s)\n", shortDigest(current.Digest), current.TaskDef)
+	fmt.Printf("  to:       %s (task definition %s)\n", shortDigest(prev.Digest), prev.TaskDef)
+
+	if !*yes {
+		printGuardStatus(*region, []string{svc.Name})
+		fmt.Printf("\n[dry run] no rollback triggered. Re-run with --yes to execute.\n")
+		return
+	}
+
+	entry := audit.New("cli", "rollback", svc.Name)
+	entry.Detail = "from " + current.TaskDef + " to " + prev.TaskDef
+	if note := guardDeploy(guard, []string{svc.Name}, "rollback to "+prev.TaskDef); note != "" {
+		entry.Detail += "; " + note
+	}
+	executeDeploy(ctx, client, *repo, tgt, img, *wait, entry)
+}
+
+// rollbackCategory rolls every worker in a category back to its previous
+// image. The workers must agree on what that image was -- a category deploy
+// put one digest everywhere, so disagreement means the history is mixed and
+// a human should pick the digest with deploy-category instead. A non-empty
+// target overrides the one inferred from the previous image, as it does for a
+// single service.
+func rollbackCategory(ctx context.Context, client *dwaws.Client, repo, category, workersJSON, target string, limit int, wait, yes bool, guard guardOptions) {
+	workers, err := config.LoadWorkers(workersJSON)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	names := workers.WorkersByCategory()[category]
+	if len(names) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no workers in category %q\n", category)
+		os.Exit(1)
+	}
+	sort.Strings(names)
+
+	byPrev := make(map[string][]string) // "imageBase@digest" -> workers
+	for _, name := range names {
+		_, prev, err := client.PreviousImage(ctx, serviceCatalog().WorkerService(name))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		key := prev.ImageBase + "@" + prev.Digest
+		byPrev[key] = append(byPrev[key], name)
+	}
+	if len(byPrev) != 1 {
+		fmt.Fprintf(os.Stderr, "Error: workers in %q don't share a previous image:\n", category)
+		for key, ws := range byPrev {
+			base, digest, _ := strings.Cut(key, "@")
+			fmt.Fprintf(os.Stderr, "  %s %s: %s\n", base, shortDigest(digest), strings.Join(ws, ", "))
+		}
+		fmt.Fprintf(os.Stderr, "Use deploy-category with an explicit digest instead.\n")
+		os.Exit(1)
+	}
+	var imageBase, digest string
+	for key := range byPrev {
+		imageBase, digest, _ = strings.Cut(key, "@")
+	}
+
+	catalog := serviceCatalog()
+	tgt, ok := catalog.TargetFor(imageBase)
+	if target != "" {
+		tgt, ok = catalog.Target(target)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: unknown deploy target %q (valid: %s)\n", target, strings.Join(catalog.TargetLabels(), ", "))
+			os.Exit(1)
+		}
+		for _, name := range names {
+			info, _ := catalog.Lookup(catalog.WorkerService(name))
+			if !slices.ContainsFunc(info.Targets, func(t config.TargetInfo) bool { return t.Label == target }) {
+				fmt.Fprintf(os.Stderr, "Error: worker %s can't be deployed with target %q\n", name, target)
+				os.Exit(1)
+			}
+		}
+		imageBase = tgt.ImageBase
+	} else if !ok {
+		fmt.Fprintf(os.Stderr, "Error: previous image source %q isn't deployed by any target in the service catalog; pass --target\n", imageBase)
+		os.Exit(1)
+	}
+	workflow := tgt.Workflow
+
+	img, err := resolveDigest(repo, imageBase, digest, limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Rollback plan for category %q (%d workers)\n", category, len(names))
+	fmt.Printf("  workflow: %s\n", workflow)
+	fmt.Printf("  source:   %s\n", imageBase)
+	fmt.Printf("  deploy:   %s\n", img.Digest)
+	if img.CommitMsg != "" {
+		fmt.Printf("  commit:   %s\n", img.CommitMsg)
+	}
+	fmt.Printf("  workers:  %s\n", strings.Join(names, ", "))
+
+	services := workerServices(names)
+	if !yes {
+		printGuardStatus(*guard.region, services)
+		fmt.Printf("\n[dry run] no rollback triggered. Re-run with --yes to execute.\n")
+		return
+	}
+
+	note := guardDeploy(guard, services, "rollback "+category+" to "+shortDigest(img.Digest))
+	results := deployWorkers(ctx, client, repo, workflow, "rollback", category, names, img.Digest, wait, note)
+	finishLocks(wait)
+	if anyFailed(results) {
+		os.Exit(1)
+	}
+	if wait {
+		fmt.Printf("\nAll rollbacks succeeded.\n")
+	}
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"dreamwidth.org/dwtool/internal/audit"
+	dwaws "dreamwidth.org/dwtool/internal/aws"
+	"dreamwidth.org/dwtool/internal/config"
+	"dreamwidth.org/dwtool/internal/github"
+	"dreamwidth.org/dwtool/internal/loki"
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// `dwtool rollout` automates the progressive web release: it deploys one
+// digest to each service in the catalog's deploy_order in turn, and only
+// moves on once the previous step's workflow has succeeded, its ECS
+// deployment has reached COMPLETED, and every health gate passes. Progress is written to a
+// state file after each transition so an interrupted rollout (Ctrl-C, laptop
+// lid, paused gate) can be picked up again with --resume.
+
+// Rollout step states, in the order a step moves through them.
+const (
+	stepPending   = "pending"   // not started
+	stepTriggered = "triggered" // workflow dispatched, waiting for run + ECS
+	stepDeployed  = "deployed"  // ECS rollout COMPLETED, gates not yet passed
+	stepPassed    = "passed"    // gates passed; the chain may continue
+	stepFailed    = "failed"    // workflow or ECS rollout failed
+)
+
+// Overall rollout statuses.
+const (
+	rolloutRunning   = "running"
+	rolloutPaused    = "paused"
+	rolloutAborted   = "aborted"
+	rolloutCompleted = "completed"
+)
+
+// rolloutStep is one service in the chain.
+type rolloutStep struct {
+	Service   string           `json:"service"` // ECS service name, e.g. web-canary-service
+	State     string           `json:"state"`
+	Triggered time.Time        `json:"triggered,omitempty"`
+	Dispatch  *github.Dispatch `json:"dispatch,omitempty"` // so a resumed rollout finds the same run
+	Deployed  time.Time        `json:"deployed,omitempty"`
+	Note      string           `json:"note,omitempty"`
+	AuditID   string           `json:"audit_id,omitempty"`
+}
+
+// rolloutState is the resumable state file.
+type rolloutState struct {
+	Digest  string        `json:"digest"` // full sha256:... digest
+	Repo    string        `json:"repo"`
+	Cluster string        `json:"cluster"`
+	Started time.Time     `json:"started"`
+	Status  string        `json:"status"`
+	Steps   []rolloutStep `json:"steps"`
+
+	path string
+}
+
+// loadRolloutState reads a state file; a missing file returns (nil, nil).
+func loadRolloutState(path string) (*rolloutState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var st rolloutState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	st.path = path
+	return &st, nil
+}
+
+// save writes the state file atomically so a crash mid-write can't leave a
+// truncated file that blocks --resume.
+func (st *rolloutState) save() error {
+	if err := os.MkdirAll(filepath.Dir(st.path), 0o755); err != nil {
+		return fmt.Errorf("creating state dir: %w", err)
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, st.path)
+}
+
+// mustSave saves the state or exits; continuing a rollout whose progress
+// can't be recorded would make --resume repeat or skip steps.
+func (st *rolloutState) mustSave() {
+	if err := st.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: saving rollout state: %v\n", err)
+		exit(1)
+	}
+}
+
+// unfinished reports whether the state describes a rollout that can be resumed.
+func (st *rolloutState) unfinished() bool {
+	return st.Status == rolloutRunning || st.Status == rolloutPaused
+}
+
+// runGate evaluates one health gate for a service that finished deploying at
+// deployedAt. It returns whether the gate passed and a one-line detail.
+func runGate(ctx context.Context, client *dwaws.Client, lk *loki.Client, gate config.HealthGate, service string, deployedAt time.Time, soak time.Duration) (bool, string, error) {
+	switch gate.Type {
+	case "tasks":
+		services, err := client.DescribeServices(ctx, []string{service})
+		if err != nil {
+			return false, "", fmt.Errorf("describing %s: %w", service, err)
+		}
+		if len(services) == 0 {
+			return false, "", fmt.Errorf("service %s not found", service)
+		}
+		s := services[0]
+		detail := fmt.Sprintf("%s running, %d pending, %d deployment(s)",
+			dwaws.TaskCount(s.RunningCount, s.DesiredCount), s.PendingCount, len(s.Deployments))
+		ok := s.DesiredCount > 0 && s.RunningCount == s.DesiredCount && s.PendingCount == 0 && len(s.Deployments) == 1
+		return ok, detail, nil
+
+	case "loki":
+		window := soak
+		if gate.Window != "" {
+			window, _ = time.ParseDuration(gate.Window) // validated in LoadRolloutConfig
+		}
+		end := time.Now()
+		start := end.Add(-window)
+		// Never count errors logged by the previous image.
+		if start.Before(deployedAt) {
+			start = deployedAt
+		}
+		query := gate.ExpandQuery(strings.TrimSuffix(service, "-service"))
+		events, err := lk.Search(query, start, end, gate.MaxMatches+1)
+		if err != nil {
+			return false, "", fmt.Errorf("querying loki: %w", err)
+		}
+		detail := fmt.Sprintf("%d match(es) in %s (max %d)", len(events), end.Sub(start).Round(time.Second), gate.MaxMatches)
+		if len(events) > gate.MaxMatches {
+			detail = fmt.Sprintf("%d+ match(es) in %s (max %d)", gate.MaxMatches+1, end.Sub(start).Round(time.Second), gate.MaxMatches)
+		}
+		return len(events) <= gate.MaxMatches, detail, nil
+	}
+	return false, "", fmt.Errorf("unknown gate type %q", gate.Type)
+}
+
+// runGates evaluates every gate, printing each result. It returns the names
+// of the gates that failed (or errored).
+func runGates(ctx context.Context, client *dwaws.Client, lk *loki.Client, gates []config.HealthGate, service string, deployedAt time.Time, soak time.Duration) []string {
+	var failed []string
+	for _, g := range gates {
+		ok, detail, err := runGate(ctx, client, lk, g, service, deployedAt, soak)
+		switch {
+		case err != nil:
+			fmt.Printf("  gate:     %-12s ERROR  %v\n", g.Name, err)
+			failed = append(failed, g.Name)
+		case ok:
+			fmt.Printf("  gate:     %-12s pass   %s\n", g.Name, detail)
+		default:
+			fmt.Printf("  gate:     %-12s FAIL   %s\n", g.Name, detail)
+			failed = append(failed, g.Name)
+		}
+	}
+	return failed
+}
+
+// promptGateFailure asks the operator what to do about a failed gate. It
+// returns "retry", "continue" or "abort"; when stdin isn't a terminal it
+// returns "" so the caller pauses instead of guessing.
+func promptGateFailure() string {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return ""
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("\nGate failed. [r]etry gates, [c]ontinue anyway, [p]ause, [a]bort? ")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return ""
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "r", "retry":
+			return "retry"
+		case "c", "continue":
+			return "continue"
+		case "p", "pause":
+			return ""
+		case "a", "abort":
+			return "abort"
+		}
+	}
+}
+
+// runRollout implements `dwtool rollout <image>`.
+func runRollout(args []string) {
+	digest, rest := peelPositional(args)
+
+	fs := flag.NewFlagSet("rollout", flag.ExitOnError)
+	region := fs.String("region", config.DefaultRegion, "AWS region")
+	cluster := fs.String("cluster", config.DefaultCluster, "ECS cluster name")
+	repo := fs.String("repo", config.DefaultRepo, "GitHub repository (owner/name)")
+	limit := fs.Int("limit", 50, "how many recent GHCR images to search when resolving the digest")
+	from := fs.String("from", "", "start the chain at this web service (e.g. web-unauthenticated)")
+	statePath := fs.String("state", config.RolloutStatePath(), "path to the resumable rollout state file")
+	resume := fs.Bool("resume", false, "continue the rollout recorded in the state file")
+	restart := fs.Bool("restart", false, "discard an unfinished rollout in the state file and start over")
+	onFail := fs.String("on-gate-fail", "pause", "what to do when a health gate fails: pause or abort")
+	yes := fs.Bool("yes", false, "actually run the rollout (without this flag the command is a dry run)")
+	guard := addGuardFlags(fs, region)
+	allowUnverified := addProvenanceFlag(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dwtool rollout <image> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Deploy one image (digest, git SHA, tag, latest or current:<service>)\n")
+		fmt.Fprintf(os.Stderr, "to each web service in order\n")
+		fmt.Fprintf(os.Stderr, "(%s), waiting for the workflow run and the\n", strings.Join(serviceCatalog().DeployOrder, " -> "))
+		fmt.Fprintf(os.Stderr, "ECS rollout to complete and running health gates before each next step.\n")
+		fmt.Fprintf(os.Stderr, "Gates and soak time come from the \"rollout\" section of\n")
+		fmt.Fprintf(os.Stderr, "~/.config/dwtool/config.json. The web services' deploy locks are held\n")
+		fmt.Fprintf(os.Stderr, "while it runs, and a freeze window needs --force-freeze --reason.\n")
+		fmt.Fprintf(os.Stderr, "Without --yes this is a DRY RUN.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  dwtool rollout 110ddd7f52bd                    # dry run\n")
+		fmt.Fprintf(os.Stderr, "  dwtool rollout 110ddd7f52bd --yes\n")
+		fmt.Fprintf(os.Stderr, "  dwtool rollout --resume --yes                  # continue after an interruption\n")
+	}
+	if err := fs.Parse(rest); err != nil {
+		os.Exit(1)
+	}
+	if digest == "" && fs.NArg() > 0 {
+		digest = fs.Arg(0)
+	}
+	if *onFail != "pause" && *onFail != "abort" {
+		fmt.Fprintf(os.Stderr, "Error: unknown --on-gate-fail %q; use pause or abort\n", *onFail)
+		os.Exit(1)
+	}
+
+	existing, err := loadRolloutState(*statePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var st *rolloutState
+	if *resume {
+		if existing == nil || !existing.unfinished() {
+			fmt.Fprintf(os.Stderr, "Error: no unfinished rollout in %s\n", *statePath)
+			os.Exit(1)
+		}
+		if digest != "" && refNote(digest, model.Image{Digest: existing.Digest}) != "" {
+			fmt.Fprintf(os.Stderr, "Error: state file is for %s, not %s\n", shortDigest(existing.Digest), digest)
+			os.Exit(1)
+		}
+		st = existing
+		*repo, *cluster = st.Repo, st.Cluster
+	} else {
+		if digest == "" {
+			fmt.Fprintf(os.Stderr, "Error: <image> is required (or use --resume)\n\n")
+			fs.Usage()
+			os.Exit(1)
+		}
+		if existing != nil && existing.unfinished() && !*restart {
+			fmt.Fprintf(os.Stderr, "Error: an unfinished rollout of %s (%s) is recorded in %s;\n", shortDigest(existing.Digest), existing.Status, *statePath)
+			fmt.Fprintf(os.Stderr, "use --resume to continue it or --restart to discard it\n")
+			os.Exit(1)
+		}
+	}
+
+	rcfg, err := config.LoadRolloutConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	soak, _ := rcfg.SoakDuration()
+	var lk *loki.Client
+	if rcfg.NeedsLoki() {
+		lk = lokiClient()
+	}
+
+	client := newAWSClient(*region, *cluster)
+	ctx := context.Background()
+
+	// Work out the chain.
+	order := serviceCatalog().DeployOrder
+	if *from != "" && st == nil {
+		start := -1
+		for i, name := range order {
+			if name == strings.TrimSuffix(*from, "-service") {
+				start = i
+			}
+		}
+		if start < 0 {
+			fmt.Fprintf(os.Stderr, "Error: --from %q is not in the web deploy order (%s)\n", *from, strings.Join(order, ", "))
+			os.Exit(1)
+		}
+		order = order[start:]
+	}
+	var names []string
+	if st != nil {
+		for _, step := range st.Steps {
+			names = append(names, step.Service)
+		}
+	} else {
+		for _, name := range order {
+			names = append(names, name+"-service")
+		}
+	}
+
+	services, err := client.DescribeServices(ctx, names)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if updated, _ := client.FetchServiceImages(ctx, services); len(updated) > 0 {
+		services = updated
+	}
+	byName := make(map[string]model.Service, len(services))
+	for _, s := range services {
+		byName[s.Name] = s
+	}
+
+	// Resolve each step's target and check the image exists for it.
+	ref := digest
+	targets := make(map[string]model.DeployTarget, len(names))
+	images := make(map[string]model.Image) // by image base
+	var img model.Image
+	for _, name := range names {
+		svc, ok := byName[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: service %q not found in cluster %q\n", name, *cluster)
+			os.Exit(1)
+		}
+		tgt, err := resolveDeployTarget(svc, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		targets[name] = tgt
+		if _, ok := images[tgt.ImageBase]; !ok {
+			want := digest
+			if st != nil {
+				want = st.Digest
+			}
+			resolved, err := resolveImageRef(*repo, *region, *cluster, tgt.ImageBase, want, *limit)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			images[tgt.ImageBase] = resolved
+			// Every service gets the image the reference first resolved to,
+			// even if it would mean another (e.g. latest) in another source.
+			digest = resolved.Digest
+		}
+		img = images[tgt.ImageBase]
+	}
+
+	if st == nil {
+		st = &rolloutState{
+			Digest:  img.Digest,
+			Repo:    *repo,
+			Cluster: *cluster,
+			Status:  rolloutRunning,
+		}
+		for _, name := range names {
+			st.Steps = append(st.Steps, rolloutStep{Service: name, State: stepPending})
+		}
+	}
+	st.path = *statePath
+
+	fmt.Printf("Rollout plan for %s\n", st.Digest)
+	if note := refNote(ref, model.Image{Digest: st.Digest}); note != "" && st.Started.IsZero() {
+		fmt.Printf("  ref:      %s\n", note)
+	}
+	if len(img.Tags) > 0 {
+		fmt.Printf("  tags:     %s\n", strings.Join(img.Tags, ", "))
+	}
+	if img.CommitMsg != "" {
+		fmt.Printf("  commit:   %s\n", img.CommitMsg)
+	}
+	for i, step := range st.Steps {
+		svc := byName[step.Service]
+		fmt.Printf("  %d. %-28s current %-12s  %s\n", i+1, step.Service, dash(svc.ImageDigest), step.State)
+	}
+	var gateNames []string
+	for _, g := range rcfg.Gates {
+		gateNames = append(gateNames, g.Name+" ("+g.Type+")")
+	}
+	fmt.Printf("  gates:    %s after %s soak\n", strings.Join(gateNames, ", "), soak)
+	fmt.Printf("  on fail:  %s\n", *onFail)
+	fmt.Printf("  state:    %s\n", st.path)
+	var bases, provNotes []string
+	for base := range images {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+	for _, base := range bases {
+		if len(images) > 1 {
+			fmt.Printf("  source:   %s\n", base)
+		}
+		provNotes = append(provNotes, verifyProvenance(*repo, base, images[base], *allowUnverified, *guard.reason, !*yes))
+	}
+
+	if !*yes {
+		printGuardStatus(*region, names)
+		fmt.Printf("\n[dry run] no deploys triggered. Re-run with --yes to execute.\n")
+		return
+	}
+
+	freezeNote := joinNotes(append(provNotes, guardDeploy(guard, names, "rollout "+shortDigest(st.Digest)))...)
+
+	if st.Started.IsZero() {
+		st.Started = time.Now()
+	}
+	st.Status = rolloutRunning
+	st.mustSave()
+
+	for i := range st.Steps {
+		step := &st.Steps[i]
+		if step.State == stepPassed {
+			continue
+		}
+		tgt := targets[step.Service]
+		fmt.Printf("\n[%d/%d] %s\n", i+1, len(st.Steps), step.Service)
+		refreshLocks()
+
+		if step.State == stepPending || step.State == stepFailed {
+			inputs := map[string]string{
+				"service": tgt.WorkflowSvc,
+				"tag":     st.Digest,
+			}
+			entry := audit.New("cli", "rollout", step.Service)
+			step.AuditID = entry.ID
+			step.Triggered = time.Now()
+			fmt.Printf("  trigger:  %s (service=%s)\n", tgt.Workflow, tgt.WorkflowSvc)
+			d, err := github.DispatchWorkflow(st.Repo, tgt.Workflow, inputs)
+			if err != nil {
+				failRollout(st, step, fmt.Sprintf("triggering workflow: %v", err))
+			}
+			step.Dispatch = &d
+			entry.Workflow = tgt.Workflow
+			entry.Digest = st.Digest
+			recordAudit(entry, "triggered", dispatchDetail(freezeNote, d))
+			step.State = stepTriggered
+			step.Note = ""
+			st.mustSave()
+		}
+
+		if step.State == stepTriggered {
+			d := github.Dispatch{Workflow: tgt.Workflow, Since: step.Triggered}
+			if step.Dispatch != nil {
+				d = *step.Dispatch
+			}
+			runID, conclusion, err := waitForRun(st.Repo, d)
+			if err != nil {
+				failRollout(st, step, err.Error())
+			}
+			recordAudit(audit.Entry{ID: step.AuditID, Actor: audit.Actor(), Source: "cli", Action: "rollout", Service: step.Service, RunID: runID}, conclusion, "")
+			fmt.Printf("  result:   %s\n", conclusion)
+			if conclusion != "success" {
+				failRollout(st, step, "workflow run "+conclusion)
+			}
+			if err := waitForSteadyState(ctx, client, step.Service, st.Digest, step.Triggered, ecsRolloutTimeout); err != nil {
+				failRollout(st, step, err.Error())
+			}
+			step.State = stepDeployed
+			step.Deployed = time.Now()
+			st.mustSave()
+		}
+
+		// Gates: soak first (whatever is left of it, when resuming), then check.
+		for {
+			if wait := time.Until(step.Deployed.Add(soak)); wait > 0 {
+				fmt.Printf("  soak:     %s\n", wait.Round(time.Second))
+				time.Sleep(wait)
+			}
+			failed := runGates(ctx, client, lk, rcfg.Gates, step.Service, step.Deployed, soak)
+			if len(failed) == 0 {
+				break
+			}
+			step.Note = "gates failed: " + strings.Join(failed, ", ")
+
+			action := "abort"
+			if *onFail == "pause" {
+				action = promptGateFailure()
+			}
+			switch action {
+			case "retry":
+				continue
+			case "continue":
+				fmt.Printf("  override: continuing despite failed gates\n")
+				step.Note += " (overridden)"
+			case "abort":
+				st.Status = rolloutAborted
+				st.mustSave()
+				fmt.Fprintf(os.Stderr, "\nRollout aborted at %s: %s\n", step.Service, step.Note)
+				exit(1)
+			default:
+				st.Status = rolloutPaused
+				st.mustSave()
+				fmt.Fprintf(os.Stderr, "\nRollout paused at %s: %s\n", step.Service, step.Note)
+				fmt.Fprintf(os.Stderr, "Re-run with --resume --yes to re-check the gates and continue.\n")
+				exit(2)
+			}
+			break
+		}
+		step.State = stepPassed
+		st.mustSave()
+	}
+
+	st.Status = rolloutCompleted
+	st.mustSave()
+	releaseLocks()
+	fmt.Printf("\nRollout of %s complete.\n", shortDigest(st.Digest))
+}
+
+// failRollout records a failed deploy step and exits. Unlike a gate failure
+// there's nothing to retry in place: the operator investigates, then either
+// --resume (which re-triggers the failed step) or rolls back.
+func failRollout(st *rolloutState, step *rolloutStep, reason string) {
+	if step.AuditID != "" {
+		recordAudit(audit.Entry{ID: step.AuditID, Actor: audit.Actor(), Source: "cli", Action: "rollout", Service: step.Service}, "error", reason)
+	}
+	step.State = stepFailed
+	step.Note = reason
+	st.Status = rolloutPaused
+	st.mustSave()
+	fmt.Fprintf(os.Stderr, "\nError: %s: %s\n", step.Service, reason)
+	fmt.Fprintf(os.Stderr, "Rollout stopped; fix the problem and re-run with --resume --yes to retry this step.\n")
+	exit(1)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dreamwidth.org/dwtool/internal/config"
+)
+
+// runDeployWorkers implements `dwtool deploy-workers <image>`, deploying one
+// image to every worker category in waves.
+func runDeployWorkers(args []string) {
+	digest, rest := peelPositional(args)
+
+	fs := flag.NewFlagSet("deploy-workers", flag.ExitOnError)
+	region := fs.String("region", config.DefaultRegion, "AWS region")
+	cluster := fs.String("cluster", config.DefaultCluster, "ECS cluster name")
+	repo := fs.String("repo", config.DefaultRepo, "GitHub repository (owner/name)")
+	workersJSON := fs.String("workers-json", "", "path to config/workers.json (auto-detected from $LJHOME if empty)")
+	target := addWorkerTargetFlag(fs)
+	limit := fs.Int("limit", 50, "how many recent GHCR images to search when resolving the digest")
+	order := fs.String("order", "", "comma-separated categories to deploy, in order (default: every category, in dashboard order)")
+	maxConcurrent := fs.Int("max-concurrent", config.DefaultWaveSize, "most workflow runs in flight at once; larger categories are split into several waves")
+	waveWait := fs.Duration("wave-wait", config.DefaultWaveWait, "pause between waves, after the previous wave is steady on ECS")
+	jsonOut := fs.Bool("json", false, "print the summary as JSON")
+	yes := fs.Bool("yes", false, "actually trigger the deploys (without this flag the command is a dry run)")
+	guard := addGuardFlags(fs, region)
+	allowUnverified := addProvenanceFlag(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dwtool deploy-workers <image> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Deploy one image (digest, git SHA, tag, latest or current:<service>)\n")
+		fmt.Fprintf(os.Stderr, "to every worker, one category at a time, in\n")
+		fmt.Fprintf(os.Stderr, "waves of at most --max-concurrent workers. Each wave's runs and ECS\n")
+		fmt.Fprintf(os.Stderr, "rollouts must succeed before the next wave starts; the first failure\n")
+		fmt.Fprintf(os.Stderr, "stops the deploy. Ends with a summary, and exits non-zero if anything\n")
+		fmt.Fprintf(os.Stderr, "failed or was skipped. Without --yes this is a DRY RUN.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  dwtool deploy-workers 8bffde07b265                      # dry run\n")
+		fmt.Fprintf(os.Stderr, "  dwtool deploy-workers 8bffde07b265 --yes --max-concurrent 6\n")
+		fmt.Fprintf(os.Stderr, "  dwtool deploy-workers 8bffde07b265 --order esn,email --yes\n")
+		fmt.Fprintf(os.Stderr, "  dwtool deploy-workers current:worker-esn-process-sub --yes\n")
+	}
+	if err := fs.Parse(rest); err != nil {
+		os.Exit(1)
+	}
+	if digest == "" && fs.NArg() > 0 {
+		digest = fs.Arg(0)
+	}
+	if digest == "" {
+		fmt.Fprintf(os.Stderr, "Error: <image> is required\n\n")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *maxConcurrent < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --max-concurrent must be at least 1\n")
+		os.Exit(1)
+	}
+
+	tgt, ok := serviceCatalog().Target(*target)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown --target %q; use one of %s\n", *target, strings.Join(serviceCatalog().TargetLabels(), ", "))
+		os.Exit(1)
+	}
+	workflow, imageBase := tgt.Workflow, tgt.ImageBase
+
+	workers, err := config.LoadWorkers(*workersJSON)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	waves, err := workers.DeployWaves(*order, *maxConcurrent)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(waves) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no workers to deploy\n")
+		os.Exit(1)
+	}
+
+	img, err := resolveImageRef(*repo, *region, *cluster, imageBase, digest, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var all []string
+	for _, w := range waves {
+		all = append(all, w.Workers...)
+	}
+	fmt.Printf("Wave deploy plan (%d workers in %d waves)\n", len(all), len(waves))
+	fmt.Printf("  workflow: %s\n", workflow)
+	fmt.Printf("  source:   %s\n", imageBase)
+	if ref := refNote(digest, img); ref != "" {
+		fmt.Printf("  ref:      %s\n", ref)
+	}
+	fmt.Printf("  deploy:   %s\n", img.Digest)
+	if img.CommitMsg != "" {
+		fmt.Printf("  commit:   %s\n", img.CommitMsg)
+	}
+	fmt.Printf("  waves:    at most %d runs at once, %s between waves\n", *maxConcurrent, *waveWait)
+	for i, w := range waves {
+		fmt.Printf("  %3d. %-12s %s\n", i+1, w.Category, strings.Join(w.Workers, ", "))
+	}
+	provNote := verifyProvenance(*repo, imageBase, img, *allowUnverified, *guard.reason, !*yes)
+
+	services := workerServices(all)
+	if !*yes {
+		printGuardStatus(*region, services)
+		fmt.Printf("\n[dry run] no deploys triggered. Re-run with --yes to execute.\n")
+		return
+	}
+
+	client := newAWSClient(*region, *cluster)
+	ctx := context.Background()
+	note := joinNotes(provNote, guardDeploy(guard, services, "deploy-workers "+shortDigest(img.Digest)))
+
+	type waveResult struct {
+		Wave     int    `json:"wave"`
+		Category string `json:"category"`
+		workerResult
+	}
+	var summary []waveResult
+	stopped := false
+	for i, w := range waves {
+		if stopped {
+			for _, name := range w.Workers {
+				summary = append(summary, waveResult{i + 1, w.Category, workerResult{Name: name, Result: "skipped"}})
+			}
+			continue
+		}
+		if i > 0 && *waveWait > 0 {
+			fmt.Printf("\nWaiting %s before the next wave ...\n", *waveWait)
+			time.Sleep(*waveWait)
+		}
+		fmt.Printf("\n=== Wave %d/%d: %s (%s) ===\n", i+1, len(waves), w.Category, strings.Join(w.Workers, ", "))
+		refreshLocks()
+		results := deployWorkers(ctx, client, *repo, workflow, "deploy-workers", w.Category, w.Workers, img.Digest, true, note)
+		for _, r := range results {
+			summary = append(summary, waveResult{i + 1, w.Category, r})
+		}
+		if anyFailed(results) {
+			fmt.Fprintf(os.Stderr, "\nWave %d failed; not starting the remaining waves.\n", i+1)
+			stopped = true
+		}
+	}
+	finishLocks(true)
+
+	var results []workerResult
+	for _, r := range summary {
+		results = append(results, r.workerResult)
+	}
+	if *jsonOut {
+		emitJSON(summary)
+	} else {
+		fmt.Printf("\nSummary\n")
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  WAVE\tCATEGORY\tWORKER\tRUN\tRESULT\tDETAIL")
+		for _, r := range summary {
+			run := "-"
+			if r.RunID != 0 {
+				run = strconv.Itoa(r.RunID)
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%s\t%s\n", r.Wave, r.Category, r.Name, run, r.Result, r.Detail)
+		}
+		tw.Flush()
+	}
+	if anyFailed(results) {
+		os.Exit(1)
+	}
+	if !*jsonOut {
+		fmt.Printf("\nAll %d workers deployed.\n", len(results))
+	}
+}
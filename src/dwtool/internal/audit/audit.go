@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"dreamwidth.org/dwtool/internal/config"
+)
+
+// Entry is one line of the audit log. An action is usually recorded twice
+// under the same ID -- once when it's triggered and again when its outcome is
+// known -- so the log stays append-only; Collapse merges them for display.
+type Entry struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	Source     string    `json:"source"` // "cli" or "tui"
+	Action     string    `json:"action"` // deploy, deploy-category, deploy-workers, rollback, rollout, traffic, images-prune
+	Service    string    `json:"service,omitempty"`
+	Workflow   string    `json:"workflow,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	RunID      int       `json:"run_id,omitempty"`
+	Conclusion string    `json:"conclusion,omitempty"` // triggered, success, failure, cancelled, error, ...
+	Detail     string    `json:"detail,omitempty"`
+}
+
+// New starts an entry for an action, filling in its ID and actor.
+func New(source, action, service string) Entry {
+	return Entry{
+		ID:      newID(),
+		Actor:   Actor(),
+		Source:  source,
+		Action:  action,
+		Service: service,
+	}
+}
+
+// Actor identifies who is running dwtool: $DWTOOL_ACTOR if set, else
+// user@host.
+func Actor() string {
+	if v := os.Getenv("DWTOOL_ACTOR"); v != "" {
+		return v
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		name += "@" + host
+	}
+	return name
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Record stamps the entry with the current time and appends it to the local
+// log, then forwards it to any configured shared sinks. A sink failure is
+// returned but never prevents the local write.
+func Record(e Entry) error {
+	e.Time = time.Now().UTC()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	path := config.AuditLogPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating audit log dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	_, werr := f.Write(append(line, '\n'))
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr != nil {
+		return fmt.Errorf("writing audit log: %w", werr)
+	}
+
+	cfg, err := config.LoadAuditConfig()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if cfg.Webhook != "" {
+		if err := postWebhook(cfg.Webhook, line); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.S3 != "" {
+		if err := putS3(cfg.S3, e, line); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postWebhook POSTs one entry as JSON.
+func postWebhook(url string, body []byte) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("audit webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// putS3 writes one entry as its own object under the configured prefix.
+// S3 objects can't be appended to, and one object per entry means concurrent
+// operators never overwrite each other. The bucket's region comes from the
+// usual AWS environment, falling back to config.DefaultRegion.
+func putS3(uri string, e Entry, body []byte) error {
+	bucket, prefix, ok := strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+	if !strings.HasPrefix(uri, "s3://") || bucket == "" {
+		return fmt.Errorf("audit s3: %q is not an s3://bucket/prefix URI", uri)
+	}
+	key := fmt.Sprintf("%s-%s.json", e.Time.Format("20060102T150405.000Z"), e.ID)
+	if prefix = strings.Trim(prefix, "/"); ok && prefix != "" {
+		key = prefix + "/" + key
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithDefaultRegion(config.DefaultRegion))
+	if err != nil {
+		return fmt.Errorf("audit s3: loading AWS config: %w", err)
+	}
+	_, err = s3.NewFromConfig(awsCfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("audit s3 upload: %w", err)
+	}
+	return nil
+}
+
+// Load reads every entry from the local log. A missing log is not an error.
+func Load() ([]Entry, error) {
+	f, err := os.Open(config.AuditLogPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // tolerate a torn line from a crashed write
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Collapse merges entries sharing an ID into one, later non-empty fields
+// winning, and keeps the time the action started. The result is sorted
+// newest first.
+func Collapse(entries []Entry) []Entry {
+	byID := make(map[string]*Entry)
+	var order []string
+	for _, e := range entries {
+		cur, ok := byID[e.ID]
+		if !ok {
+			copied := e
+			byID[e.ID] = &copied
+			order = append(order, e.ID)
+			continue
+		}
+		if e.Workflow != "" {
+			cur.Workflow = e.Workflow
+		}
+		if e.Digest != "" {
+			cur.Digest = e.Digest
+		}
+		if e.RunID != 0 {
+			cur.RunID = e.RunID
+		}
+		if e.Conclusion != "" {
+			cur.Conclusion = e.Conclusion
+		}
+		if e.Detail != "" {
+			cur.Detail = e.Detail
+		}
+	}
+	out := make([]Entry, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byID[id])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out
+}
@@ -14,23 +14,6 @@ import (
 	"dreamwidth.org/dwtool/internal/model"
 )
 
-// LogGroupForService returns the CloudWatch log group name for a service.
-// Each service has its own log group: /dreamwidth/web/{key} for web services,
-// /dreamwidth/worker/{name} for workers.
-// Web WorkflowSvc values have a "web-" prefix (e.g. "web-canary") but the
-// log group key is just "canary".
-func LogGroupForService(svc model.Service) string {
-	switch svc.Group {
-	case "web":
-		key := strings.TrimPrefix(svc.WorkflowSvc, "web-")
-		return "/dreamwidth/web/" + key
-	case "worker":
-		return "/dreamwidth/worker/" + svc.WorkflowSvc
-	default:
-		return ""
-	}
-}
-
 // FetchLogs retrieves recent log events from a CloudWatch log group.
 // It returns events sorted by timestamp, limited to the most recent logs within the given duration.
 func (c *Client) FetchLogs(ctx context.Context, logGroup string, since time.Duration, limit int) ([]model.LogEvent, error) {
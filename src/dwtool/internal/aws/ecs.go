@@ -157,6 +157,10 @@ func pickAppContainerIndex(names []string) int {
 	return -1
 }
 
+// maxServiceEvents caps how many of a service's events (ECS keeps the last
+// 100, newest first) we carry around.
+const maxServiceEvents = 20
+
 func ecsServiceToModel(svc ecstypes.Service) model.Service {
 	name := aws.ToString(svc.ServiceName)
 	s := model.Service{
@@ -189,6 +193,16 @@ func ecsServiceToModel(svc ecstypes.Service) model.Service {
 		}
 		s.Deployments = append(s.Deployments, d)
 	}
+	for i, ev := range svc.Events {
+		if i == maxServiceEvents {
+			break
+		}
+		e := model.ServiceEvent{Message: aws.ToString(ev.Message)}
+		if ev.CreatedAt != nil {
+			e.CreatedAt = *ev.CreatedAt
+		}
+		s.Events = append(s.Events, e)
+	}
 	if len(svc.Deployments) > 0 && svc.Deployments[0].CreatedAt != nil {
 		s.DeployedAt = *svc.Deployments[0].CreatedAt
 	}
@@ -199,7 +213,7 @@ func ecsServiceToModel(svc ecstypes.Service) model.Service {
 	}
 
 	// Classify the service
-	s.Group, s.Workflow, s.WorkflowSvc, s.ImageBase, s.DeployTargets = classifyService(name)
+	ClassifyService(&s)
 
 	return s
 }
@@ -221,6 +235,25 @@ func ecsTaskToModel(t ecstypes.Task, serviceName string) model.Task {
 	if t.StartedAt != nil {
 		task.StartedAt = *t.StartedAt
 	}
+	task.Health = string(t.HealthStatus)
+	if t.StoppedAt != nil {
+		task.StoppedAt = *t.StoppedAt
+	}
+	task.StopCode = string(t.StopCode)
+	task.StoppedReason = aws.ToString(t.StoppedReason)
+	for _, c := range t.Containers {
+		cs := model.ContainerState{
+			Name:   aws.ToString(c.Name),
+			Status: aws.ToString(c.LastStatus),
+			Health: string(c.HealthStatus),
+			Reason: aws.ToString(c.Reason),
+		}
+		if c.ExitCode != nil {
+			code := int(*c.ExitCode)
+			cs.ExitCode = &code
+		}
+		task.Containers = append(task.Containers, cs)
+	}
 
 	// Surface the right container name on the model — see pickAppContainerIndex.
 	if len(t.Containers) > 0 {
@@ -242,45 +275,30 @@ func ecsTaskToModel(t ecstypes.Task, serviceName string) model.Task {
 	return task
 }
 
-// classifyService determines the group, workflow, workflow input, image base,
-// and all available deploy targets for a service.
-// ECS service names have a "-service" suffix (e.g. "web-canary-service",
-// "worker-birthday-notify-service") that we strip before matching.
-func classifyService(name string) (group, workflow, workflowSvc, imageBase string, targets []model.DeployTarget) {
-	// Strip the "-service" suffix that ECS service names carry
-	svc := strings.TrimSuffix(name, "-service")
-
-	switch svc {
-	case "web-canary":
-		return "web", config.WorkflowWeb22, "web-canary", config.ImageBaseWeb22, []model.DeployTarget{
-			{Label: "web22", Workflow: config.WorkflowWeb22, WorkflowSvc: "web-canary", ImageBase: config.ImageBaseWeb22},
-		}
-	case "web-stable":
-		return "web", config.WorkflowWeb22, "web-stable", config.ImageBaseWeb22, []model.DeployTarget{
-			{Label: "web22", Workflow: config.WorkflowWeb22, WorkflowSvc: "web-stable", ImageBase: config.ImageBaseWeb22},
-		}
-	case "web-unauthenticated":
-		return "web", config.WorkflowWeb22, "web-unauthenticated", config.ImageBaseWeb22, []model.DeployTarget{
-			{Label: "web22", Workflow: config.WorkflowWeb22, WorkflowSvc: "web-unauthenticated", ImageBase: config.ImageBaseWeb22},
-		}
-	case "web-shop":
-		return "web", config.WorkflowWeb22, "web-shop", config.ImageBaseWeb22, []model.DeployTarget{
-			{Label: "web22", Workflow: config.WorkflowWeb22, WorkflowSvc: "web-shop", ImageBase: config.ImageBaseWeb22},
-		}
-	case "proxy":
-		return "proxy", "", "", "", nil
+// ClassifyService looks s up in the service catalog for its group,
+// workflow, workflow input, image base, deploy targets, log group and ALB
+// target group. Services the catalog doesn't know, or every service if there
+// is no catalog, are in the "other" group.
+func ClassifyService(s *model.Service) {
+	catalog, err := config.Services()
+	if err != nil {
+		catalog = &config.Catalog{}
 	}
-
-	// Workers: strip "worker-" prefix for the workflow service input
-	if strings.HasPrefix(svc, "worker-") {
-		workerName := strings.TrimPrefix(svc, "worker-")
-		return "worker", config.WorkflowWorker, workerName, config.ImageBaseWorker, []model.DeployTarget{
-			{Label: "worker", Workflow: config.WorkflowWorker, WorkflowSvc: workerName, ImageBase: config.ImageBaseWorker},
-			{Label: "worker22", Workflow: config.WorkflowWorker22, WorkflowSvc: workerName, ImageBase: config.ImageBaseWorker22},
-		}
+	info, _ := catalog.Lookup(s.Name)
+	s.Group = info.Group
+	s.WorkflowSvc = info.WorkflowSvc
+	s.LogGroup = info.LogGroup
+	s.TargetGroup = info.TargetGroup
+	s.DeployTargets = nil
+	for _, t := range info.Targets {
+		s.DeployTargets = append(s.DeployTargets, model.DeployTarget{
+			Label: t.Label, Workflow: t.Workflow, WorkflowSvc: info.WorkflowSvc, ImageBase: t.ImageBase,
+		})
+	}
+	s.Workflow, s.ImageBase = "", ""
+	if len(s.DeployTargets) > 0 {
+		s.Workflow, s.ImageBase = s.DeployTargets[0].Workflow, s.DeployTargets[0].ImageBase
 	}
-
-	return "other", "", "", "", nil
 }
 
 // extractDigestFromTaskDef extracts the image digest from a task definition ARN.
@@ -308,37 +326,31 @@ func (c *Client) FetchServiceImages(ctx context.Context, services []model.Servic
 			continue
 		}
 
-		// Prefer Container.Image which has the task definition's image reference
-		// (e.g. "ghcr.io/dreamwidth/web22@sha256:DIGEST") — this is the GHCR
-		// manifest digest and will match GHCR package versions.
-		// Container.ImageDigest is the platform-specific runtime digest and
-		// won't match GHCR for multi-arch images.
-		if container.Image != nil {
-			img := aws.ToString(container.Image)
-			if idx := strings.Index(img, "sha256:"); idx >= 0 {
-				digest := img[idx+7:]
-				if len(digest) > 12 {
-					digest = digest[:12]
-				}
-				services[i].ImageDigest = digest
-				continue
-			}
-		}
-		// Fallback to ImageDigest if Image doesn't have a sha256 reference
-		if container.ImageDigest != nil {
-			digest := aws.ToString(container.ImageDigest)
-			if strings.HasPrefix(digest, "sha256:") {
-				digest = digest[7:]
-			}
-			if len(digest) > 12 {
-				digest = digest[:12]
-			}
-			services[i].ImageDigest = digest
+		digest := strings.TrimPrefix(containerDigest(*container), "sha256:")
+		if len(digest) > 12 {
+			digest = digest[:12]
 		}
+		services[i].ImageDigest = digest
 	}
 	return services, nil
 }
 
+// containerDigest returns the full "sha256:..." digest a container runs.
+// It prefers Container.Image, which has the task definition's image reference
+// (e.g. "ghcr.io/dreamwidth/web22@sha256:DIGEST") — this is the GHCR
+// manifest digest and will match GHCR package versions.
+// Container.ImageDigest is the platform-specific runtime digest and
+// won't match GHCR for multi-arch images, so it's only a fallback.
+func containerDigest(container ecstypes.Container) string {
+	if container.Image != nil {
+		img := aws.ToString(container.Image)
+		if idx := strings.Index(img, "sha256:"); idx >= 0 {
+			return img[idx:]
+		}
+	}
+	return aws.ToString(container.ImageDigest)
+}
+
 // findAppContainer returns the application container from a task's
 // container list, using pickAppContainerIndex's selection policy.
 func findAppContainer(containers []ecstypes.Container) *ecstypes.Container {
@@ -358,6 +370,60 @@ func containerNames(containers []ecstypes.Container) []string {
 	return names
 }
 
+// ListStoppedTasks returns up to limit of a service's recently stopped tasks,
+// most recently stopped first. ECS only keeps stopped tasks for about an hour,
+// which is usually enough to see why a service is crash-looping.
+func (c *Client) ListStoppedTasks(ctx context.Context, serviceName string, limit int) ([]model.Task, error) {
+	listOut, err := c.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+		Cluster:       aws.String(c.cluster),
+		ServiceName:   aws.String(serviceName),
+		DesiredStatus: ecstypes.DesiredStatusStopped,
+		MaxResults:    aws.Int32(100),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing stopped tasks: %w", err)
+	}
+	if len(listOut.TaskArns) == 0 {
+		return nil, nil
+	}
+
+	descOut, err := c.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(c.cluster),
+		Tasks:   listOut.TaskArns,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing stopped tasks: %w", err)
+	}
+
+	var tasks []model.Task
+	for _, t := range descOut.Tasks {
+		tasks = append(tasks, ecsTaskToModel(t, serviceName))
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].StoppedAt.After(tasks[j].StoppedAt) })
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
+}
+
+// ContainerExits summarizes how a stopped task's containers exited, e.g.
+// "web=137 (OutOfMemoryError: ...), log-router=0". Containers that never
+// started are listed by their reason alone.
+func ContainerExits(t model.Task) string {
+	var parts []string
+	for _, c := range t.Containers {
+		switch {
+		case c.ExitCode != nil && c.Reason != "":
+			parts = append(parts, fmt.Sprintf("%s=%d (%s)", c.Name, *c.ExitCode, c.Reason))
+		case c.ExitCode != nil:
+			parts = append(parts, fmt.Sprintf("%s=%d", c.Name, *c.ExitCode))
+		case c.Reason != "":
+			parts = append(parts, fmt.Sprintf("%s: %s", c.Name, c.Reason))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
 // listTasksRaw returns raw ECS task descriptions (limited to maxTasks).
 func (c *Client) listTasksRaw(ctx context.Context, serviceName string, maxTasks int) ([]ecstypes.Task, error) {
 	listOut, err := c.ecs.ListTasks(ctx, &ecs.ListTasksInput{
@@ -13,18 +13,25 @@ import (
 	"dreamwidth.org/dwtool/internal/model"
 )
 
-// FetchTrafficRule discovers the ALB listener rule for a given web service
-// and returns the current target group weights.
-func (c *Client) FetchTrafficRule(ctx context.Context, serviceKey string) (model.TrafficRule, error) {
+// FetchTrafficRule discovers the ALB listener rule forwarding to a service's
+// target group (from the service catalog) and returns the current target
+// group weights.
+func (c *Client) FetchTrafficRule(ctx context.Context, serviceKey, targetGroup string) (model.TrafficRule, error) {
+	catalog, err := config.Services()
+	if err != nil {
+		return model.TrafficRule{}, err
+	}
+
 	// 1. Find ALB by name
+	albName := catalog.ALB
 	lbs, err := c.elbv2.DescribeLoadBalancers(ctx, &elbv2.DescribeLoadBalancersInput{
-		Names: []string{config.ALBName},
+		Names: []string{albName},
 	})
 	if err != nil {
 		return model.TrafficRule{}, fmt.Errorf("describing ALB: %w", err)
 	}
 	if len(lbs.LoadBalancers) == 0 {
-		return model.TrafficRule{}, fmt.Errorf("ALB %q not found", config.ALBName)
+		return model.TrafficRule{}, fmt.Errorf("ALB %q not found", albName)
 	}
 	albARN := aws.ToString(lbs.LoadBalancers[0].LoadBalancerArn)
 
@@ -43,7 +50,7 @@ func (c *Client) FetchTrafficRule(ctx context.Context, serviceKey string) (model
 		}
 	}
 	if listenerARN == "" {
-		return model.TrafficRule{}, fmt.Errorf("no HTTPS listener found on %s", config.ALBName)
+		return model.TrafficRule{}, fmt.Errorf("no HTTPS listener found on %s", albName)
 	}
 
 	// 3. Get all rules for this listener
@@ -55,14 +62,13 @@ func (c *Client) FetchTrafficRule(ctx context.Context, serviceKey string) (model
 	}
 
 	// 4. Find the matching rule
-	tgPrefix := serviceKey + "-tg"
 	for _, rule := range rules.Rules {
 		isDefault := aws.ToBool(rule.IsDefault)
 		targets := extractTargets(rule.Actions)
 
-		// Match by TG name: look for a TG whose name is exactly serviceKey + "-tg"
+		// Match by TG name
 		for _, t := range targets {
-			if t.Name == tgPrefix {
+			if t.Name == targetGroup {
 				label := fmt.Sprintf("Rule %s", aws.ToString(rule.Priority))
 				if isDefault {
 					label = "Default"
@@ -79,7 +85,36 @@ func (c *Client) FetchTrafficRule(ctx context.Context, serviceKey string) (model
 		}
 	}
 
-	return model.TrafficRule{}, fmt.Errorf("no ALB rule found for %s", serviceKey)
+	return model.TrafficRule{}, fmt.Errorf("no ALB rule on %s forwards to %s", albName, targetGroup)
+}
+
+// ListTargetGroups returns the names of the target groups attached to the
+// named ALB.
+func (c *Client) ListTargetGroups(ctx context.Context, albName string) ([]string, error) {
+	lbs, err := c.elbv2.DescribeLoadBalancers(ctx, &elbv2.DescribeLoadBalancersInput{
+		Names: []string{albName},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing ALB: %w", err)
+	}
+	if len(lbs.LoadBalancers) == 0 {
+		return nil, fmt.Errorf("ALB %q not found", albName)
+	}
+
+	var names []string
+	paginator := elbv2.NewDescribeTargetGroupsPaginator(c.elbv2, &elbv2.DescribeTargetGroupsInput{
+		LoadBalancerArn: lbs.LoadBalancers[0].LoadBalancerArn,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describing target groups: %w", err)
+		}
+		for _, tg := range page.TargetGroups {
+			names = append(names, aws.ToString(tg.TargetGroupName))
+		}
+	}
+	return names, nil
 }
 
 // UpdateTrafficWeights applies new target group weights to an ALB rule.
@@ -0,0 +1,113 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// A workflow run succeeding only means the new task definition was registered
+// and the service updated; ECS still has to start the new tasks, pass health
+// checks and drain the old ones, and can fail (or trip the deployment circuit
+// breaker) well after GitHub reports success. These helpers follow that last
+// stretch.
+
+// RolloutStatus is one look at the deployment a deploy started.
+type RolloutStatus struct {
+	State   string // IN_PROGRESS, COMPLETED or FAILED; "" until the new deployment appears
+	Running int
+	Desired int
+	TaskDef string               // family:revision of the new deployment
+	Events  []model.ServiceEvent // service events since the deploy began, newest first
+}
+
+// CheckRollout reports on service's PRIMARY deployment if it was created at or
+// after since (less a minute for clock skew between us and ECS); before that
+// the State is empty.
+func (c *Client) CheckRollout(ctx context.Context, service string, since time.Time) (RolloutStatus, error) {
+	services, err := c.DescribeServices(ctx, []string{service})
+	if err != nil {
+		return RolloutStatus{}, err
+	}
+	if len(services) == 0 {
+		return RolloutStatus{}, fmt.Errorf("service %s not found", service)
+	}
+	svc := services[0]
+	cutoff := since.Add(-time.Minute)
+
+	var st RolloutStatus
+	for _, ev := range svc.Events {
+		if ev.CreatedAt.Before(cutoff) {
+			break
+		}
+		st.Events = append(st.Events, ev)
+	}
+	for _, d := range svc.Deployments {
+		if d.Status != "PRIMARY" || d.CreatedAt.Before(cutoff) {
+			continue
+		}
+		st.State = d.RolloutState
+		if st.State == "" {
+			st.State = "IN_PROGRESS"
+		}
+		st.Running, st.Desired, st.TaskDef = d.RunningCount, d.DesiredCount, d.TaskDef
+	}
+	return st, nil
+}
+
+// RunningDigests counts a service's running tasks by the full image digest
+// of their app container.
+func (c *Client) RunningDigests(ctx context.Context, service string) (map[string]int, error) {
+	tasks, err := c.listTasksRaw(ctx, service, 100)
+	if err != nil {
+		return nil, fmt.Errorf("listing tasks for %s: %w", service, err)
+	}
+	counts := make(map[string]int)
+	for _, t := range tasks {
+		container := findAppContainer(t.Containers)
+		if container == nil {
+			counts[""]++
+			continue
+		}
+		counts[containerDigest(*container)]++
+	}
+	return counts, nil
+}
+
+// VerifyImage checks that every running task of service runs digest (the full
+// "sha256:..." form) and returns how many tasks it checked.
+func (c *Client) VerifyImage(ctx context.Context, service, digest string) (int, error) {
+	counts, err := c.RunningDigests(ctx, service)
+	if err != nil {
+		return 0, err
+	}
+	if len(counts) == 0 {
+		return 0, fmt.Errorf("%s has no running tasks", service)
+	}
+	total := 0
+	var others []string
+	for d, n := range counts {
+		total += n
+		if d == digest {
+			continue
+		}
+		short := strings.TrimPrefix(d, "sha256:")
+		if len(short) > 12 {
+			short = short[:12]
+		}
+		if short == "" {
+			short = "unknown"
+		}
+		others = append(others, fmt.Sprintf("%d on %s", n, short))
+	}
+	if len(others) > 0 {
+		sort.Strings(others)
+		return total, fmt.Errorf("%s is not fully on the deployed image: %d of %d tasks differ (%s)",
+			service, total-counts[digest], total, strings.Join(others, ", "))
+	}
+	return total, nil
+}
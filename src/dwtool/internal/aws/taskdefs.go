@@ -0,0 +1,209 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// ImageHistory returns the images a service's task definition family has
+// pointed at, newest revision first, up to max revisions. Revisions whose app
+// container isn't pinned to a digest are skipped.
+func (c *Client) ImageHistory(ctx context.Context, serviceName string, max int) ([]model.ImageRevision, error) {
+	svc, err := c.describeService(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return c.imageHistory(ctx, svc, false, func(history []model.ImageRevision) bool {
+		return len(history) >= max
+	})
+}
+
+// DeployedImages returns the images a service is running or rolling out to
+// (one per current ECS deployment), and, newest first, every image its task
+// definition family has pointed at since since: each revision registered
+// after it, and the one that was current when the window opened. Revisions
+// that reference their image by tag are included with an empty Digest, so
+// callers can tell that they don't know which image ran.
+func (c *Client) DeployedImages(ctx context.Context, serviceName string, since time.Time) (current, recent []model.ImageRevision, err error) {
+	svc, err := c.describeService(ctx, serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, dep := range svc.Deployments {
+		rev, err := c.describeImageRevision(ctx, aws.ToString(dep.TaskDefinition))
+		if err != nil {
+			return nil, nil, err
+		}
+		current = append(current, rev)
+	}
+	recent, err = c.imageHistory(ctx, svc, true, func(history []model.ImageRevision) bool {
+		return history[len(history)-1].RegisteredAt.Before(since)
+	})
+	return current, recent, err
+}
+
+func (c *Client) describeService(ctx context.Context, serviceName string) (ecstypes.Service, error) {
+	out, err := c.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(c.cluster),
+		Services: []string{serviceName},
+	})
+	if err != nil {
+		return ecstypes.Service{}, fmt.Errorf("describing service: %w", err)
+	}
+	if len(out.Services) == 0 {
+		return ecstypes.Service{}, fmt.Errorf("service %s not found", serviceName)
+	}
+	return out.Services[0], nil
+}
+
+// imageHistory walks svc's task definition family from the newest revision
+// back, collecting pinned images (and, with unpinned, the revisions that
+// reference their image by tag) until done says the history is long enough.
+func (c *Client) imageHistory(ctx context.Context, svc ecstypes.Service, unpinned bool, done func([]model.ImageRevision) bool) ([]model.ImageRevision, error) {
+	family, _ := splitTaskDef(aws.ToString(svc.TaskDefinition))
+	if family == "" {
+		return nil, fmt.Errorf("service %s has no task definition", aws.ToString(svc.ServiceName))
+	}
+
+	var history []model.ImageRevision
+	paginator := ecs.NewListTaskDefinitionsPaginator(c.ecs, &ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: aws.String(family),
+		Sort:         ecstypes.SortOrderDesc,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing task definitions: %w", err)
+		}
+		for _, arn := range page.TaskDefinitionArns {
+			// FamilyPrefix is a prefix match; "web-canary" would also list
+			// "web-canary-debug".
+			if f, _ := splitTaskDef(arn); f != family {
+				continue
+			}
+			rev, err := c.describeImageRevision(ctx, arn)
+			if err != nil {
+				return nil, err
+			}
+			if rev.Digest == "" && !unpinned {
+				continue
+			}
+			history = append(history, rev)
+			if done(history) {
+				return history, nil
+			}
+		}
+	}
+	return history, nil
+}
+
+// PreviousImage finds the image a service was running before its current one.
+// An in-flight or recently superseded ECS deployment is the most direct
+// evidence, so a non-PRIMARY deployment's task definition wins; otherwise we
+// walk the task definition family back from the current revision to the first
+// one pinned to a different digest.
+func (c *Client) PreviousImage(ctx context.Context, serviceName string) (current, previous model.ImageRevision, err error) {
+	out, err := c.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(c.cluster),
+		Services: []string{serviceName},
+	})
+	if err != nil {
+		return current, previous, fmt.Errorf("describing service: %w", err)
+	}
+	if len(out.Services) == 0 {
+		return current, previous, fmt.Errorf("service %s not found", serviceName)
+	}
+	svc := out.Services[0]
+
+	current, err = c.describeImageRevision(ctx, aws.ToString(svc.TaskDefinition))
+	if err != nil {
+		return current, previous, err
+	}
+	if current.Digest == "" {
+		return current, previous, fmt.Errorf("current task definition %s is not pinned to an image digest", current.TaskDef)
+	}
+
+	for _, dep := range svc.Deployments {
+		if aws.ToString(dep.Status) == "PRIMARY" {
+			continue
+		}
+		rev, err := c.describeImageRevision(ctx, aws.ToString(dep.TaskDefinition))
+		if err == nil && rev.Digest != "" && rev.Digest != current.Digest {
+			return current, rev, nil
+		}
+	}
+
+	history, err := c.ImageHistory(ctx, serviceName, 25)
+	if err != nil {
+		return current, previous, err
+	}
+	_, curRev := splitTaskDef(current.TaskDef)
+	for _, rev := range history {
+		if _, r := splitTaskDef(rev.TaskDef); r >= curRev {
+			continue
+		}
+		if rev.Digest != current.Digest {
+			return current, rev, nil
+		}
+	}
+	return current, previous, fmt.Errorf("no earlier image found in the last %d revisions of %s", len(history), current.TaskDef)
+}
+
+// describeImageRevision describes one task definition and extracts the app
+// container's image reference. An image referenced by tag gets its
+// ImageBase but no Digest.
+func (c *Client) describeImageRevision(ctx context.Context, taskDefArn string) (model.ImageRevision, error) {
+	out, err := c.ecs.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(taskDefArn),
+	})
+	if err != nil {
+		return model.ImageRevision{}, fmt.Errorf("describing task definition %s: %w", taskDefArn, err)
+	}
+	td := out.TaskDefinition
+	rev := model.ImageRevision{
+		TaskDef: fmt.Sprintf("%s:%d", aws.ToString(td.Family), td.Revision),
+	}
+	if td.RegisteredAt != nil {
+		rev.RegisteredAt = *td.RegisteredAt
+	}
+
+	names := make([]string, len(td.ContainerDefinitions))
+	for i, cd := range td.ContainerDefinitions {
+		names[i] = aws.ToString(cd.Name)
+	}
+	if i := pickAppContainerIndex(names); i >= 0 {
+		image := aws.ToString(td.ContainerDefinitions[i].Image)
+		if base, digest, ok := strings.Cut(image, "@"); ok && strings.HasPrefix(digest, "sha256:") {
+			rev.ImageBase = base
+			rev.Digest = digest
+		} else if j := strings.LastIndex(image, ":"); j > strings.LastIndex(image, "/") {
+			rev.ImageBase = image[:j]
+		} else {
+			rev.ImageBase = image
+		}
+	}
+	return rev, nil
+}
+
+// splitTaskDef splits a task definition ARN or "family:revision" string into
+// its family and revision number.
+func splitTaskDef(taskDef string) (string, int) {
+	if i := strings.LastIndex(taskDef, "/"); i >= 0 {
+		taskDef = taskDef[i+1:]
+	}
+	family, rev, ok := strings.Cut(taskDef, ":")
+	if !ok {
+		return family, 0
+	}
+	var n int
+	fmt.Sscanf(rev, "%d", &n)
+	return family, n
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AuditConfig is the "audit" section of ~/.config/dwtool/config.json. Both
+// sinks are optional; the local log is always written.
+type AuditConfig struct {
+	Webhook string `json:"webhook,omitempty"` // URL each entry is POSTed to as JSON
+	S3      string `json:"s3,omitempty"`      // s3://bucket/prefix; one object per entry
+}
+
+// LoadAuditConfig loads the audit section of the config file, with
+// environment overrides:
+//
+//	DWTOOL_AUDIT_WEBHOOK
+//	DWTOOL_AUDIT_S3
+func LoadAuditConfig() (*AuditConfig, error) {
+	cfg := &AuditConfig{}
+
+	data, err := os.ReadFile(configFilePath())
+	if err == nil {
+		var file ConfigFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", configFilePath(), err)
+		}
+		cfg = &file.Audit
+	}
+
+	if v := os.Getenv("DWTOOL_AUDIT_WEBHOOK"); v != "" {
+		cfg.Webhook = v
+	}
+	if v := os.Getenv("DWTOOL_AUDIT_S3"); v != "" {
+		cfg.S3 = v
+	}
+	return cfg, nil
+}
+
+// AuditLogPath returns the local JSONL audit log, alongside config.json.
+// DWTOOL_AUDIT_LOG overrides it.
+func AuditLogPath() string {
+	if v := os.Getenv("DWTOOL_AUDIT_LOG"); v != "" {
+		return v
+	}
+	return filepath.Join(filepath.Dir(configFilePath()), "audit.jsonl")
+}
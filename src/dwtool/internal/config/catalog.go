@@ -0,0 +1,329 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The service catalog (config/services.json, next to workers.json) says
+// which ECS services dwtool knows about and how to deploy them: each
+// service's dashboard group, the workflows and GHCR image bases it can be
+// deployed from, its CloudWatch log group and ALB target group, and the order
+// web deploys go in. Adding a service means adding it there, not to Go code.
+//
+// Entries match an ECS service by its key (the name without "-service"),
+// either exactly ("name") or by prefix ("prefix", e.g. "worker-"); an exact
+// match wins. In an entry's strings, {name} expands to the workflow service
+// name: the key, minus the entry's prefix.
+
+// CatalogGroups are the groups the dashboard and deploy code know how to
+// handle; a service matching no entry is shown as "other".
+var CatalogGroups = []string{"web", "worker", "proxy"}
+
+// Catalog is the parsed service catalog.
+type Catalog struct {
+	ALB         string                   `json:"alb"`     // load balancer holding the target groups
+	Targets     map[string]CatalogTarget `json:"targets"` // deploy targets by label, e.g. "worker22"
+	Services    []CatalogService         `json:"services"`
+	DeployOrder []string                 `json:"deploy_order"` // web services, in the order rollouts deploy them
+
+	Path string `json:"-"` // where it was loaded from
+}
+
+// CatalogTarget is one way to deploy: a workflow and the images it deploys.
+type CatalogTarget struct {
+	Workflow  string `json:"workflow"`
+	ImageBase string `json:"image_base"`
+}
+
+// CatalogService describes one service, or every service with a prefix.
+type CatalogService struct {
+	Name            string   `json:"name,omitempty"`
+	Prefix          string   `json:"prefix,omitempty"`
+	Group           string   `json:"group"`
+	Targets         []string `json:"targets,omitempty"`          // labels in Catalog.Targets; the first is the default
+	WorkflowService string   `json:"workflow_service,omitempty"` // the workflow's "service" input; defaults to {name}
+	LogGroup        string   `json:"log_group,omitempty"`
+	TargetGroup     string   `json:"target_group,omitempty"` // ALB target group taking the service's traffic
+}
+
+// ServiceInfo is what the catalog says about one ECS service.
+type ServiceInfo struct {
+	Key         string // service name without "-service", e.g. "web-canary"
+	Group       string
+	WorkflowSvc string
+	LogGroup    string
+	TargetGroup string
+	Targets     []TargetInfo
+}
+
+// TargetInfo is a resolved deploy target.
+type TargetInfo struct {
+	Label     string
+	Workflow  string
+	ImageBase string
+}
+
+// ReadCatalog parses the service catalog from explicitPath, else
+// $DWTOOL_CATALOG, else $LJHOME/config/services.json, without validating it.
+// There's no fallback: without a catalog, dwtool doesn't know what it can
+// deploy.
+func ReadCatalog(explicitPath string) (*Catalog, error) {
+	path := explicitPath
+	if path == "" {
+		path = os.Getenv("DWTOOL_CATALOG")
+	}
+	if path == "" {
+		ljhome := os.Getenv("LJHOME")
+		if ljhome == "" {
+			return nil, errors.New("no service catalog: set LJHOME to a dreamwidth checkout, or DWTOOL_CATALOG (or --catalog) to its config/services.json")
+		}
+		path = filepath.Join(ljhome, "config", "services.json")
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no service catalog at %s: set LJHOME to a dreamwidth checkout, or DWTOOL_CATALOG (or --catalog) to its config/services.json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	c.Path = path
+	return &c, nil
+}
+
+// Validate returns every problem with the catalog, or nil.
+func (c *Catalog) Validate() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, label := range c.TargetLabels() {
+		t := c.Targets[label]
+		if t.Workflow == "" {
+			add("target %q has no workflow", label)
+		}
+		if !strings.Contains(t.ImageBase, "/") {
+			add("target %q: image_base %q isn't an image repository", label, t.ImageBase)
+		}
+	}
+
+	knownGroups := make(map[string]bool)
+	for _, g := range CatalogGroups {
+		knownGroups[g] = true
+	}
+	seen := make(map[string]bool)
+	named := make(map[string]CatalogService)
+	workerPrefix := ""
+	needALB := false
+	for i, s := range c.Services {
+		what := fmt.Sprintf("service %q", s.Name)
+		switch {
+		case s.Name != "" && s.Prefix != "":
+			add("services[%d] has both a name and a prefix", i)
+			continue
+		case s.Name == "" && s.Prefix == "":
+			add("services[%d] has neither a name nor a prefix", i)
+			continue
+		case s.Prefix != "":
+			what = fmt.Sprintf("prefix %q", s.Prefix)
+		}
+		if key := s.Name + "\x00" + s.Prefix; seen[key] {
+			add("%s is listed twice", what)
+		} else {
+			seen[key] = true
+		}
+		if strings.HasSuffix(s.Name, "-service") {
+			add("%s: use the name without \"-service\"", what)
+		}
+		if !knownGroups[s.Group] {
+			add("%s: group %q isn't one of %s", what, s.Group, strings.Join(CatalogGroups, ", "))
+		}
+		for _, label := range s.Targets {
+			if _, ok := c.Targets[label]; !ok {
+				add("%s: unknown target %q", what, label)
+			}
+		}
+		for _, f := range [][2]string{{"workflow_service", s.WorkflowService}, {"log_group", s.LogGroup}, {"target_group", s.TargetGroup}} {
+			if rest := strings.ReplaceAll(f[1], "{name}", ""); strings.ContainsAny(rest, "{}") {
+				add("%s: %s %q may only use {name}", what, f[0], f[1])
+			}
+		}
+		if s.TargetGroup != "" {
+			needALB = true
+		}
+		if s.Name != "" {
+			named[s.Name] = s
+		}
+		if s.Prefix != "" && s.Group == "worker" {
+			if workerPrefix != "" && workerPrefix != s.Prefix {
+				add("prefix %q: workers already have prefix %q", s.Prefix, workerPrefix)
+			}
+			workerPrefix = s.Prefix
+		}
+	}
+	if needALB && c.ALB == "" {
+		add("services have target groups but no alb is set")
+	}
+
+	inOrder := make(map[string]bool)
+	for _, name := range c.DeployOrder {
+		s, ok := named[name]
+		switch {
+		case inOrder[name]:
+			add("deploy_order lists %q twice", name)
+		case !ok:
+			add("deploy_order: %q isn't a named service", name)
+		case s.Group != "web" || len(s.Targets) == 0:
+			add("deploy_order: %q isn't a deployable web service", name)
+		}
+		inOrder[name] = true
+	}
+	return problems
+}
+
+// Lookup returns what the catalog says about an ECS service, given its name
+// with or without the "-service" suffix.
+func (c *Catalog) Lookup(name string) (ServiceInfo, bool) {
+	key := strings.TrimSuffix(name, "-service")
+	var match *CatalogService
+	for i, s := range c.Services {
+		if s.Name == key {
+			match = &c.Services[i]
+			break
+		}
+		if match == nil && s.Prefix != "" && strings.HasPrefix(key, s.Prefix) {
+			match = &c.Services[i]
+		}
+	}
+	if match == nil {
+		return ServiceInfo{Key: key, Group: "other"}, false
+	}
+
+	short := strings.TrimPrefix(key, match.Prefix)
+	expand := func(s string) string { return strings.ReplaceAll(s, "{name}", short) }
+	info := ServiceInfo{
+		Key:         key,
+		Group:       match.Group,
+		WorkflowSvc: short,
+		LogGroup:    expand(match.LogGroup),
+		TargetGroup: expand(match.TargetGroup),
+	}
+	if match.WorkflowService != "" {
+		info.WorkflowSvc = expand(match.WorkflowService)
+	}
+	if len(match.Targets) == 0 {
+		// Nothing to deploy with, so no workflow input either.
+		info.WorkflowSvc = ""
+	}
+	for _, label := range match.Targets {
+		t := c.Targets[label]
+		info.Targets = append(info.Targets, TargetInfo{Label: label, Workflow: t.Workflow, ImageBase: t.ImageBase})
+	}
+	return info, true
+}
+
+// WorkerService returns the ECS service name of the worker called name in
+// workers.json, built from the catalog's worker prefix entry. In a catalog
+// without one, a worker's name is its service key.
+func (c *Catalog) WorkerService(name string) string {
+	for _, s := range c.Services {
+		if s.Prefix != "" && s.Group == "worker" {
+			return s.Prefix + name + "-service"
+		}
+	}
+	return name + "-service"
+}
+
+// Named returns the keys of the services listed by name, in catalog order.
+func (c *Catalog) Named(group string) []string {
+	var names []string
+	for _, s := range c.Services {
+		if s.Name != "" && s.Group == group {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// Target returns the deploy target with the given label.
+func (c *Catalog) Target(label string) (TargetInfo, bool) {
+	t, ok := c.Targets[label]
+	return TargetInfo{Label: label, Workflow: t.Workflow, ImageBase: t.ImageBase}, ok
+}
+
+// TargetFor returns the deploy target that deploys images from imageBase.
+func (c *Catalog) TargetFor(imageBase string) (TargetInfo, bool) {
+	for _, label := range c.TargetLabels() {
+		if t := c.Targets[label]; t.ImageBase == imageBase {
+			return TargetInfo{Label: label, Workflow: t.Workflow, ImageBase: t.ImageBase}, true
+		}
+	}
+	return TargetInfo{}, false
+}
+
+// TargetLabels returns the deploy target labels, sorted.
+func (c *Catalog) TargetLabels() []string {
+	labels := make([]string, 0, len(c.Targets))
+	for label := range c.Targets {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// ImageBases returns every image base a target deploys from, sorted.
+func (c *Catalog) ImageBases() []string {
+	seen := make(map[string]bool)
+	var bases []string
+	for _, t := range c.Targets {
+		if !seen[t.ImageBase] {
+			seen[t.ImageBase] = true
+			bases = append(bases, t.ImageBase)
+		}
+	}
+	sort.Strings(bases)
+	return bases
+}
+
+var (
+	catalogMu     sync.Mutex
+	activeCatalog *Catalog
+)
+
+// UseCatalog makes c the catalog Services returns.
+func UseCatalog(c *Catalog) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	activeCatalog = c
+}
+
+// Services returns the catalog given to UseCatalog. If there wasn't one, it
+// reads and validates the default catalog (see ReadCatalog) on first use, and
+// returns why if it can't.
+func Services() (*Catalog, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	if activeCatalog == nil {
+		c, err := ReadCatalog("")
+		if err != nil {
+			return nil, err
+		}
+		if problems := c.Validate(); len(problems) > 0 {
+			return nil, fmt.Errorf("invalid service catalog %s: %s", c.Path, strings.Join(problems, "; "))
+		}
+		activeCatalog = c
+	}
+	return activeCatalog, nil
+}
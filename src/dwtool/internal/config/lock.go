@@ -0,0 +1,237 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LockConfig is the "locks" section of ~/.config/dwtool/config.json: where
+// the advisory per-service deploy locks are kept and how long they last.
+type LockConfig struct {
+	Backend   string `json:"backend,omitempty"`    // "ssm" (default) or "file"
+	SSMPrefix string `json:"ssm_prefix,omitempty"` // parameter path; default DefaultLockSSMPrefix
+	Dir       string `json:"dir,omitempty"`        // file backend directory; default alongside config.json
+	TTL       string `json:"ttl,omitempty"`        // how long a lock lasts if never released; default 1h
+}
+
+// DefaultLockSSMPrefix is the SSM parameter path locks are stored under.
+const DefaultLockSSMPrefix = "/dwtool/locks"
+
+// DefaultLockTTL is how long a deploy lock lasts if its holder never
+// releases it (e.g. the process was killed).
+const DefaultLockTTL = time.Hour
+
+// TTLDuration parses TTL, falling back to DefaultLockTTL.
+func (lc LockConfig) TTLDuration() (time.Duration, error) {
+	if lc.TTL == "" {
+		return DefaultLockTTL, nil
+	}
+	d, err := time.ParseDuration(lc.TTL)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid lock ttl %q", lc.TTL)
+	}
+	return d, nil
+}
+
+// FreezeWindow is a period during which deploys are refused unless forced
+// with a reason. It is either one-off (Start and End, RFC 3339) or weekly
+// (Days, From and To as HH:MM in Timezone; To at or before From runs past
+// midnight into the next day).
+//
+//	{ "name": "holiday", "start": "2026-12-23T00:00:00Z", "end": "2027-01-02T00:00:00Z" }
+//	{ "name": "weekend", "days": ["fri"], "from": "16:00", "to": "09:00",
+//	  "timezone": "America/Los_Angeles" }
+type FreezeWindow struct {
+	Name     string   `json:"name"`
+	Reason   string   `json:"reason,omitempty"`
+	Services []string `json:"services,omitempty"` // service keys it covers (e.g. web-stable); empty = all
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Days     []string `json:"days,omitempty"` // mon, tue, ...
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Timezone string   `json:"timezone,omitempty"` // IANA name; default UTC
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Covers reports whether the window applies to service (with or without
+// the -service suffix).
+func (w FreezeWindow) Covers(service string) bool {
+	if len(w.Services) == 0 {
+		return true
+	}
+	key := strings.TrimSuffix(service, "-service")
+	for _, s := range w.Services {
+		if strings.TrimSuffix(s, "-service") == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveAt reports whether the window is in force at t, and if so when it
+// ends. The window must have passed validate.
+func (w FreezeWindow) ActiveAt(t time.Time) (bool, time.Time) {
+	if w.Start != "" {
+		start, _ := time.Parse(time.RFC3339, w.Start)
+		end, _ := time.Parse(time.RFC3339, w.End)
+		return !t.Before(start) && t.Before(end), end
+	}
+
+	loc := time.UTC
+	if w.Timezone != "" {
+		loc, _ = time.LoadLocation(w.Timezone)
+	}
+	t = t.In(loc)
+	from, _ := time.Parse("15:04", w.From)
+	to, _ := time.Parse("15:04", w.To)
+	// A window that crosses midnight may have started yesterday.
+	for back := 0; back <= 1; back++ {
+		day := t.AddDate(0, 0, -back)
+		if !w.onDay(day.Weekday()) {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), from.Hour(), from.Minute(), 0, 0, loc)
+		end := time.Date(day.Year(), day.Month(), day.Day(), to.Hour(), to.Minute(), 0, 0, loc)
+		if !end.After(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !t.Before(start) && t.Before(end) {
+			return true, end
+		}
+	}
+	return false, time.Time{}
+}
+
+func (w FreezeWindow) onDay(d time.Weekday) bool {
+	for _, name := range w.Days {
+		if weekdays[strings.ToLower(name)] == d {
+			return true
+		}
+	}
+	return false
+}
+
+func (w FreezeWindow) validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("freeze window without a name")
+	}
+	if w.Start != "" || w.End != "" {
+		start, err := time.Parse(time.RFC3339, w.Start)
+		if err != nil {
+			return fmt.Errorf("freeze %q: invalid start %q (want RFC 3339)", w.Name, w.Start)
+		}
+		end, err := time.Parse(time.RFC3339, w.End)
+		if err != nil {
+			return fmt.Errorf("freeze %q: invalid end %q (want RFC 3339)", w.Name, w.End)
+		}
+		if !end.After(start) {
+			return fmt.Errorf("freeze %q: end is not after start", w.Name)
+		}
+		if len(w.Days) > 0 {
+			return fmt.Errorf("freeze %q: give either start/end or days/from/to, not both", w.Name)
+		}
+		return nil
+	}
+	if len(w.Days) == 0 {
+		return fmt.Errorf("freeze %q: needs start/end or days/from/to", w.Name)
+	}
+	for _, d := range w.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("freeze %q: unknown day %q (want mon, tue, ...)", w.Name, d)
+		}
+	}
+	for _, hm := range []string{w.From, w.To} {
+		if _, err := time.Parse("15:04", hm); err != nil {
+			return fmt.Errorf("freeze %q: invalid time %q (want HH:MM)", w.Name, hm)
+		}
+	}
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("freeze %q: %w", w.Name, err)
+		}
+	}
+	return nil
+}
+
+// LoadLockConfig loads the locks section of the config file, with
+// environment overrides (handy for tests and CI):
+//
+//	DWTOOL_LOCK_BACKEND
+//	DWTOOL_LOCK_DIR
+func LoadLockConfig() (*LockConfig, error) {
+	cfg := &LockConfig{}
+
+	data, err := os.ReadFile(configFilePath())
+	if err == nil {
+		var file ConfigFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", configFilePath(), err)
+		}
+		cfg = &file.Locks
+	}
+
+	if v := os.Getenv("DWTOOL_LOCK_BACKEND"); v != "" {
+		cfg.Backend = v
+	}
+	if v := os.Getenv("DWTOOL_LOCK_DIR"); v != "" {
+		cfg.Dir = v
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = "ssm"
+	}
+	if cfg.SSMPrefix == "" {
+		cfg.SSMPrefix = DefaultLockSSMPrefix
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = filepath.Join(filepath.Dir(configFilePath()), "locks")
+	}
+	if cfg.Backend != "ssm" && cfg.Backend != "file" {
+		return nil, fmt.Errorf("unknown lock backend %q (want ssm or file)", cfg.Backend)
+	}
+	if _, err := cfg.TTLDuration(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFreezeWindows loads and validates the "freeze" section of the config
+// file. A missing file means no freezes.
+func LoadFreezeWindows() ([]FreezeWindow, error) {
+	data, err := os.ReadFile(configFilePath())
+	if err != nil {
+		return nil, nil
+	}
+	var file ConfigFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", configFilePath(), err)
+	}
+	for _, w := range file.Freeze {
+		if err := w.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return file.Freeze, nil
+}
+
+// ActiveFreeze returns the first freeze window covering service at t, and
+// when it ends, or nil if deploys to service are allowed.
+func ActiveFreeze(windows []FreezeWindow, service string, t time.Time) (*FreezeWindow, time.Time) {
+	for i := range windows {
+		if !windows[i].Covers(service) {
+			continue
+		}
+		if on, end := windows[i].ActiveAt(t); on {
+			return &windows[i], end
+		}
+	}
+	return nil, time.Time{}
+}
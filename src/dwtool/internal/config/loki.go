@@ -16,7 +16,11 @@ type LokiConfig struct {
 
 // ConfigFile is the top-level structure of ~/.config/dwtool/config.json.
 type ConfigFile struct {
-	Loki LokiConfig `json:"loki"`
+	Loki    LokiConfig     `json:"loki"`
+	Rollout RolloutConfig  `json:"rollout"`
+	Audit   AuditConfig    `json:"audit"`
+	Locks   LockConfig     `json:"locks"`
+	Freeze  []FreezeWindow `json:"freeze"`
 }
 
 // configFilePath returns ~/.config/dwtool/config.json.
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HealthGate is one check `dwtool rollout` runs after a service's deploy has
+// finished and before moving on to the next service in the catalog's
+// deploy order.
+//
+// Two kinds are supported:
+//
+//	"tasks" — the service must have running == desired tasks and none pending
+//	"loki"  — a LogQL query must return at most MaxMatches lines over Window
+//
+// Loki queries may contain $SERVICE, which is replaced by the service key
+// (e.g. "web-canary") so one gate definition covers every step.
+type HealthGate struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Query      string `json:"query,omitempty"`
+	MaxMatches int    `json:"max_matches,omitempty"`
+	Window     string `json:"window,omitempty"` // e.g. "5m"; defaults to the soak time
+}
+
+// RolloutConfig is the "rollout" section of ~/.config/dwtool/config.json.
+type RolloutConfig struct {
+	Soak  string       `json:"soak,omitempty"` // how long to let a step bake before gating
+	Gates []HealthGate `json:"gates,omitempty"`
+}
+
+// DefaultRolloutGates are used when the config file has no "rollout" section.
+var DefaultRolloutGates = []HealthGate{
+	{Name: "tasks", Type: "tasks"},
+	{
+		Name:       "error-rate",
+		Type:       "loki",
+		Query:      `{source="dreamwidth",service="$SERVICE"} |~ "(?i)\\[error\\]|internal server error"`,
+		MaxMatches: 50,
+	},
+}
+
+// DefaultRolloutSoak is how long a step bakes before its gates run.
+const DefaultRolloutSoak = 3 * time.Minute
+
+// SoakDuration parses Soak, falling back to DefaultRolloutSoak.
+func (rc RolloutConfig) SoakDuration() (time.Duration, error) {
+	if rc.Soak == "" {
+		return DefaultRolloutSoak, nil
+	}
+	d, err := time.ParseDuration(rc.Soak)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rollout soak %q: %w", rc.Soak, err)
+	}
+	return d, nil
+}
+
+// NeedsLoki reports whether any configured gate queries Loki.
+func (rc RolloutConfig) NeedsLoki() bool {
+	for _, g := range rc.Gates {
+		if g.Type == "loki" {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandQuery returns the gate's LogQL query for one service.
+func (g HealthGate) ExpandQuery(serviceKey string) string {
+	return strings.ReplaceAll(g.Query, "$SERVICE", serviceKey)
+}
+
+// LoadRolloutConfig loads the rollout section of the config file, filling in
+// the default gates when none are configured, and validates each gate.
+func LoadRolloutConfig() (*RolloutConfig, error) {
+	cfg := &RolloutConfig{}
+
+	data, err := os.ReadFile(configFilePath())
+	if err == nil {
+		var file ConfigFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", configFilePath(), err)
+		}
+		cfg = &file.Rollout
+	}
+	if len(cfg.Gates) == 0 {
+		cfg.Gates = DefaultRolloutGates
+	}
+
+	if _, err := cfg.SoakDuration(); err != nil {
+		return nil, err
+	}
+	for _, g := range cfg.Gates {
+		switch g.Type {
+		case "tasks":
+		case "loki":
+			if g.Query == "" {
+				return nil, fmt.Errorf("rollout gate %q: loki gates need a query", g.Name)
+			}
+			if g.Window != "" {
+				if _, err := time.ParseDuration(g.Window); err != nil {
+					return nil, fmt.Errorf("rollout gate %q: invalid window %q: %w", g.Name, g.Window, err)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("rollout gate %q: unknown type %q (want tasks or loki)", g.Name, g.Type)
+		}
+	}
+	return cfg, nil
+}
+
+// RolloutStatePath returns the default location of the resumable rollout
+// state file, alongside config.json.
+func RolloutStatePath() string {
+	return filepath.Join(filepath.Dir(configFilePath()), "rollout-state.json")
+}
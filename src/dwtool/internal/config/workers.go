@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 )
 
 // WorkerDef represents a single worker definition from workers.json.
@@ -74,3 +76,66 @@ func (c *WorkersConfig) WorkersByCategory() map[string][]string {
 	}
 	return result
 }
+
+// Wave deploys of every worker default to at most DefaultWaveSize runs in
+// flight, with DefaultWaveWait between waves.
+const (
+	DefaultWaveSize = 4
+	DefaultWaveWait = time.Minute
+)
+
+// DeployWave is one batch of workers from a single category, deployed
+// together.
+type DeployWave struct {
+	Category string
+	Workers  []string
+}
+
+// DeployWaves splits every worker into waves of at most size, one category
+// at a time so a category's workers restart together and before the next
+// category's. order (comma-separated) picks and orders the categories; if
+// empty, CategoryOrder is used, followed by any other categories
+// alphabetically.
+func (c *WorkersConfig) DeployWaves(order string, size int) ([]DeployWave, error) {
+	byCat := c.WorkersByCategory()
+	var cats []string
+	if order != "" {
+		seen := make(map[string]bool)
+		for _, cat := range strings.Split(order, ",") {
+			cat = strings.TrimSpace(cat)
+			if cat == "" || seen[cat] {
+				continue
+			}
+			if _, ok := byCat[cat]; !ok {
+				return nil, fmt.Errorf("no workers in category %q", cat)
+			}
+			seen[cat] = true
+			cats = append(cats, cat)
+		}
+	} else {
+		known := make(map[string]bool)
+		for _, cat := range CategoryOrder {
+			known[cat] = true
+		}
+		var extra []string
+		for cat := range byCat {
+			if !known[cat] {
+				extra = append(extra, cat)
+			}
+		}
+		sort.Strings(extra)
+		cats = append(append(cats, CategoryOrder...), extra...)
+	}
+
+	size = max(size, 1)
+	var waves []DeployWave
+	for _, cat := range cats {
+		names := byCat[cat]
+		for len(names) > 0 {
+			n := min(size, len(names))
+			waves = append(waves, DeployWave{Category: cat, Workers: names[:n]})
+			names = names[n:]
+		}
+	}
+	return waves, nil
+}
@@ -0,0 +1,267 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// DefaultBaseURL is the GitHub REST API root.
+const DefaultBaseURL = "https://api.github.com"
+
+// maxRateLimitWait is the longest we'll sleep for a rate limit to reset
+// before giving up and returning a *RateLimitError.
+const maxRateLimitWait = 90 * time.Second
+
+// ErrNoToken is returned when no GitHub token can be found.
+var ErrNoToken = errors.New("no GitHub token: set GH_TOKEN (e.g. export GH_TOKEN=$(gh auth token)) or log in with gh auth login")
+
+// APIError is a non-2xx response from the GitHub API.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string // GitHub's "message" field, or the raw body
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github: %s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// RateLimitError is returned when GitHub's rate limit is exhausted and won't
+// reset soon enough to wait it out.
+type RateLimitError struct {
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("github: rate limit exceeded; resets at %s", e.Reset.Local().Format("15:04:05"))
+}
+
+// IsNotFound reports whether err is a 404 from the GitHub API.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Client talks to the GitHub REST API.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+
+	mu            sync.Mutex
+	defaultBranch map[string]string           // repo -> default branch, for workflow dispatch
+	provenance    map[string]model.Provenance // "imageBase@digest" -> checked provenance
+}
+
+// NewClient creates a client for baseURL (DefaultBaseURL in production; an
+// httptest server URL in tests) authenticating with token.
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		token:         token,
+		http:          &http.Client{Timeout: 30 * time.Second},
+		defaultBranch: make(map[string]string),
+		provenance:    make(map[string]model.Provenance),
+	}
+}
+
+// ResolveToken finds a GitHub token: $GH_TOKEN, then $GITHUB_TOKEN, then the
+// oauth_token gh stores for github.com in its hosts.yml.
+func ResolveToken() (string, error) {
+	for _, env := range []string{"GH_TOKEN", "GITHUB_TOKEN"} {
+		if v := strings.TrimSpace(os.Getenv(env)); v != "" {
+			return v, nil
+		}
+	}
+
+	dir := os.Getenv("GH_CONFIG_DIR")
+	if dir == "" {
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+			dir = filepath.Join(xdg, "gh")
+		} else {
+			home, _ := os.UserHomeDir()
+			dir = filepath.Join(home, ".config", "gh")
+		}
+	}
+	f, err := os.Open(filepath.Join(dir, "hosts.yml"))
+	if err != nil {
+		return "", ErrNoToken
+	}
+	defer f.Close()
+	if token := hostsToken(f, "github.com"); token != "" {
+		return token, nil
+	}
+	// Recent gh versions keep the token in the system keyring instead.
+	return "", ErrNoToken
+}
+
+// hostsToken pulls host's oauth_token out of gh's hosts.yml. The file is a
+// tiny, fixed shape, so we scan it rather than pull in a YAML parser:
+//
+//	github.com:
+//	    oauth_token: gho_...
+//	    user: someone
+func hostsToken(r io.Reader, host string) string {
+	scanner := bufio.NewScanner(r)
+	inHost := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			inHost = strings.TrimSuffix(strings.TrimSpace(line), ":") == host
+			continue
+		}
+		if !inHost {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && key == "oauth_token" {
+			return strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	return ""
+}
+
+// do sends one request and decodes a JSON response into out (if non-nil).
+// It returns the response headers so callers can follow pagination.
+func (c *Client) do(method, path string, body, out interface{}) (http.Header, error) {
+	h, data, err := c.send(method, path, body)
+	if err != nil {
+		return h, err
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return h, fmt.Errorf("github: parsing %s response: %w", path, err)
+		}
+	}
+	return h, nil
+}
+
+// send sends one request and returns the raw response body. It waits out a
+// rate limit that resets within maxRateLimitWait and retries once.
+func (c *Client) send(method, path string, body interface{}) (http.Header, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if body != nil {
+			data, err := json.Marshal(body)
+			if err != nil {
+				return nil, nil, err
+			}
+			reqBody = bytes.NewReader(data)
+		}
+
+		reqURL := path
+		if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+			reqURL = c.baseURL + path
+		}
+		req, err := http.NewRequest(method, reqURL, reqBody)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		req.Header.Set("User-Agent", "dwtool")
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("github: %s %s: %w", method, path, err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("github: reading response: %w", err)
+		}
+
+		if reset, limited := rateLimited(resp); limited {
+			wait := time.Until(reset)
+			if attempt == 0 && wait <= maxRateLimitWait {
+				time.Sleep(max(wait, time.Second))
+				continue
+			}
+			return resp.Header, nil, &RateLimitError{Reset: reset}
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			apiErr := &APIError{Method: method, Path: path, StatusCode: resp.StatusCode}
+			var msg struct {
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(data, &msg) == nil && msg.Message != "" {
+				apiErr.Message = msg.Message
+			} else {
+				apiErr.Message = strings.TrimSpace(string(data[:min(len(data), 200)]))
+			}
+			return resp.Header, nil, apiErr
+		}
+
+		return resp.Header, data, nil
+	}
+}
+
+// rateLimited reports whether resp is a primary or secondary rate-limit
+// rejection, and when it's worth trying again.
+func rateLimited(resp *http.Response) (time.Time, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return time.Now().Add(time.Duration(secs) * time.Second), true
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if secs, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Unix(secs, 0), true
+		}
+		return time.Now().Add(time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// nextPage returns the rel="next" URL from a Link header, or "".
+func nextPage(h http.Header) string {
+	for _, part := range strings.Split(h.Get("Link"), ",") {
+		segs := strings.Split(part, ";")
+		if len(segs) < 2 {
+			continue
+		}
+		for _, s := range segs[1:] {
+			if strings.TrimSpace(s) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(segs[0]), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// repoPath splits "owner/name" and returns the escaped /repos/owner/name prefix.
+func repoPath(repo string) (string, error) {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || name == "" {
+		return "", fmt.Errorf("invalid repo: %s", repo)
+	}
+	return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name), nil
+}
@@ -0,0 +1,206 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient returns a client talking to an httptest server running handler.
+func testClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL+"/", "test-token")
+}
+
+func TestDo(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		for header, want := range map[string]string{
+			"Authorization":        "Bearer test-token",
+			"Accept":               "application/vnd.github+json",
+			"X-GitHub-Api-Version": "2022-11-28",
+			"Content-Type":         "application/json",
+		} {
+			if got := r.Header.Get(header); got != want {
+				t.Errorf("%s = %q, want %q", header, got, want)
+			}
+		}
+		if r.Method != "POST" || r.URL.Path != "/repos/o/r/things" {
+			t.Errorf("got %s %s", r.Method, r.URL.Path)
+		}
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		if in["ref"] != "main" {
+			t.Errorf("body = %v", in)
+		}
+		w.Header().Set("X-Thing", "1")
+		fmt.Fprint(w, `{"id": 42, "name": "thing"}`)
+	})
+
+	var out struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	h, err := c.do("POST", "/repos/o/r/things", map[string]string{"ref": "main"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != 42 || out.Name != "thing" {
+		t.Errorf("decoded %+v", out)
+	}
+	if h.Get("X-Thing") != "1" {
+		t.Error("response headers weren't returned")
+	}
+}
+
+func TestDoBadJSON(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": `)
+	})
+	var out struct{ ID int }
+	if _, err := c.do("GET", "/x", nil, &out); err == nil || !strings.Contains(err.Error(), "parsing /x response") {
+		t.Errorf("err = %v, want a parse error", err)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		message  string
+		notFound bool
+	}{
+		{"json message", 404, `{"message": "Not Found", "documentation_url": "x"}`, "Not Found", true},
+		{"plain body", 500, "  upstream exploded\n", "upstream exploded", false},
+		{"long body", 502, strings.Repeat("x", 500), strings.Repeat("x", 200), false},
+		{"forbidden without rate limit", 403, `{"message": "Resource not accessible by integration"}`, "Resource not accessible by integration", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			_, err := c.do("DELETE", "/repos/o/r/thing", nil, nil)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.message || apiErr.Method != "DELETE" || apiErr.Path != "/repos/o/r/thing" {
+				t.Errorf("got %+v", apiErr)
+			}
+			if IsNotFound(err) != tt.notFound {
+				t.Errorf("IsNotFound = %v, want %v", IsNotFound(err), tt.notFound)
+			}
+		})
+	}
+}
+
+func TestSendRateLimit(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	calls := 0
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(403)
+	})
+	_, err := c.do("GET", "/x", nil, nil)
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) || !rlErr.Reset.Equal(reset) {
+		t.Fatalf("err = %v, want a rate limit error resetting at %s", err, reset)
+	}
+	if calls != 1 {
+		t.Errorf("%d calls; a reset that far off shouldn't be waited for", calls)
+	}
+}
+
+func TestSendRetriesShortRateLimit(t *testing.T) {
+	calls := 0
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(429)
+			return
+		}
+		fmt.Fprint(w, `{"ok": true}`)
+	})
+	var out struct{ OK bool }
+	if _, err := c.do("GET", "/x", nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || !out.OK {
+		t.Errorf("calls = %d, out = %+v; want a retry that succeeds", calls, out)
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	tests := []struct {
+		link, want string
+	}{
+		{"", ""},
+		{`<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`, "https://api.github.com/x?page=2"},
+		{`<https://api.github.com/x?page=1>; rel="prev", <https://api.github.com/x?page=3>; rel="next"`, "https://api.github.com/x?page=3"},
+		{`<https://api.github.com/x?page=1>; rel="first", <https://api.github.com/x?page=4>; rel="prev"`, ""},
+		{`garbage`, ""},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.link != "" {
+			h.Set("Link", tt.link)
+		}
+		if got := nextPage(h); got != tt.want {
+			t.Errorf("nextPage(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestListRunJobsPaginates(t *testing.T) {
+	var srvURL string
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/actions/runs/7/jobs" {
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			w.Header().Set("Link", `<`+srvURL+`/repos/o/r/actions/runs/7/jobs?page=2>; rel="next"`)
+			fmt.Fprint(w, `{"jobs": [{"id": 1, "name": "build", "steps": [{"number": 1, "name": "checkout"}]}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"jobs": [{"id": 2, "name": "deploy"}]}`)
+	})
+	srvURL = c.baseURL
+
+	jobs, err := c.ListRunJobs("o/r", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].Name != "build" || jobs[1].Name != "deploy" {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	if len(jobs[0].Steps) != 1 || jobs[0].Steps[0].Name != "checkout" {
+		t.Errorf("steps = %+v", jobs[0].Steps)
+	}
+}
+
+func TestHostsToken(t *testing.T) {
+	hosts := "github.example.com:\n    oauth_token: wrong\ngithub.com:\n    user: someone\n    oauth_token: \"gho_abc\"\n"
+	if got := hostsToken(strings.NewReader(hosts), "github.com"); got != "gho_abc" {
+		t.Errorf("hostsToken = %q", got)
+	}
+	if got := hostsToken(io.LimitReader(strings.NewReader(hosts), 0), "github.com"); got != "" {
+		t.Errorf("hostsToken of an empty file = %q", got)
+	}
+}
@@ -0,0 +1,214 @@
+package github
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// maxCompareCommits caps how many commits a release diff lists.
+const maxCompareCommits = 300
+
+// CommitSHA returns the git SHA an image was built from, taken from its tags,
+// or "" if none of them carries one.
+func CommitSHA(img model.Image) string {
+	return extractGitSHA(img.Tags)
+}
+
+// ReleaseDiff lists the commits between base (the running image's SHA) and
+// head (the candidate's), from the local git checkout when it has both
+// commits, else from the GitHub compare API. Changes under bin/upgrading --
+// data files and the update-db*.pl schema definitions -- are flagged.
+func ReleaseDiff(repo, base, head string) (model.ReleaseDiff, error) {
+	if gitHasCommits(base, head) {
+		return gitReleaseDiff(base, head)
+	}
+	api, err := Default()
+	if err != nil {
+		return model.ReleaseDiff{}, err
+	}
+	return api.Compare(repo, base, head)
+}
+
+type ghCompare struct {
+	Status   string `json:"status"` // ahead, behind, diverged, identical
+	AheadBy  int    `json:"ahead_by"`
+	BehindBy int    `json:"behind_by"`
+	Commits  []struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Message string `json:"message"`
+			Author  struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"commit"`
+		Author *struct {
+			Login string `json:"login"`
+		} `json:"author"`
+	} `json:"commits"`
+	Files []struct {
+		Filename string `json:"filename"`
+	} `json:"files"`
+}
+
+// Compare builds a release diff from GitHub's compare API. If head is behind
+// base (a rollback), the comparison is flipped so Commits lists what the
+// deploy would remove.
+func (c *Client) Compare(repo, base, head string) (model.ReleaseDiff, error) {
+	diff := model.ReleaseDiff{Base: base, Head: head, Source: "github"}
+	cmp, err := c.compare(repo, base, head)
+	if err != nil {
+		return diff, err
+	}
+	if cmp.Status == "behind" {
+		diff.Rollback = true
+		if cmp, err = c.compare(repo, head, base); err != nil {
+			return diff, err
+		}
+	}
+
+	for _, rc := range cmp.Commits {
+		subject, pr := parseCommitMessage(rc.Commit.Message)
+		author := rc.Commit.Author.Name
+		if rc.Author != nil && rc.Author.Login != "" {
+			author = rc.Author.Login
+		}
+		diff.Commits = append(diff.Commits, model.Commit{SHA: rc.SHA, Author: author, Subject: subject, PR: pr})
+	}
+	// The API lists commits oldest first; show newest first like git log.
+	for i, j := 0, len(diff.Commits)-1; i < j; i, j = i+1, j-1 {
+		diff.Commits[i], diff.Commits[j] = diff.Commits[j], diff.Commits[i]
+	}
+	diff.Truncated = cmp.AheadBy > len(diff.Commits)
+	for _, f := range cmp.Files {
+		if kind := flagKind(f.Filename); kind != "" {
+			diff.Flagged = append(diff.Flagged, model.FlaggedFile{Path: f.Filename, Kind: kind})
+		}
+	}
+	return diff, nil
+}
+
+// compare fetches one comparison. Commits are paginated (files only come
+// with the first page), so we follow pages up to maxCompareCommits.
+func (c *Client) compare(repo, base, head string) (ghCompare, error) {
+	prefix, err := repoPath(repo)
+	if err != nil {
+		return ghCompare{}, err
+	}
+	var out ghCompare
+	p := fmt.Sprintf("%s/compare/%s...%s?per_page=100", prefix, base, head)
+	for page := 0; p != ""; page++ {
+		var resp ghCompare
+		h, err := c.do("GET", p, nil, &resp)
+		if err != nil {
+			return ghCompare{}, err
+		}
+		if page == 0 {
+			out = resp
+		} else {
+			out.Commits = append(out.Commits, resp.Commits...)
+		}
+		if len(out.Commits) >= maxCompareCommits {
+			break
+		}
+		p = nextPage(h)
+	}
+	return out, nil
+}
+
+// gitHasCommits reports whether the local checkout has every given commit.
+func gitHasCommits(shas ...string) bool {
+	for _, sha := range shas {
+		if exec.Command("git", "cat-file", "-e", sha+"^{commit}").Run() != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// gitReleaseDiff builds a release diff from the local checkout.
+func gitReleaseDiff(base, head string) (model.ReleaseDiff, error) {
+	diff := model.ReleaseDiff{Base: base, Head: head, Source: "git"}
+	from, to := base, head
+	if exec.Command("git", "merge-base", "--is-ancestor", head, base).Run() == nil &&
+		exec.Command("git", "merge-base", "--is-ancestor", base, head).Run() != nil {
+		diff.Rollback = true
+		from, to = head, base
+	}
+
+	out, err := exec.Command("git", "log", "--format=%H%x1f%an%x1f%B%x1e",
+		"-n", strconv.Itoa(maxCompareCommits+1), from+".."+to).Output()
+	if err != nil {
+		return diff, fmt.Errorf("git log %s..%s: %w", from, to, err)
+	}
+	for _, rec := range bytes.Split(out, []byte{0x1e}) {
+		fields := strings.SplitN(strings.TrimLeft(string(rec), "\n"), "\x1f", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		subject, pr := parseCommitMessage(fields[2])
+		diff.Commits = append(diff.Commits, model.Commit{SHA: fields[0], Author: fields[1], Subject: subject, PR: pr})
+	}
+	if len(diff.Commits) > maxCompareCommits {
+		diff.Commits = diff.Commits[:maxCompareCommits]
+		diff.Truncated = true
+	}
+
+	out, err = exec.Command("git", "diff", "--name-only", from+"..."+to).Output()
+	if err != nil {
+		return diff, fmt.Errorf("git diff %s...%s: %w", from, to, err)
+	}
+	for _, f := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if kind := flagKind(f); kind != "" {
+			diff.Flagged = append(diff.Flagged, model.FlaggedFile{Path: f, Kind: kind})
+		}
+	}
+	return diff, nil
+}
+
+var (
+	mergePRRe  = regexp.MustCompile(`^Merge pull request #(\d+) `)
+	squashPRRe = regexp.MustCompile(`\(#(\d+)\)\s*$`)
+)
+
+// parseCommitMessage returns a commit's one-line subject and the PR it came
+// from, if any. GitHub merge commits ("Merge pull request #123 from ...")
+// carry the PR title in the body, which makes a better subject; squash merges
+// end their subject with "(#123)".
+func parseCommitMessage(msg string) (string, int) {
+	lines := strings.Split(strings.TrimSpace(msg), "\n")
+	subject := strings.TrimSpace(lines[0])
+	if m := mergePRRe.FindStringSubmatch(subject); m != nil {
+		pr, _ := strconv.Atoi(m[1])
+		for _, l := range lines[1:] {
+			if l = strings.TrimSpace(l); l != "" {
+				return l, pr
+			}
+		}
+		return subject, pr
+	}
+	if m := squashPRRe.FindStringSubmatch(subject); m != nil {
+		pr, _ := strconv.Atoi(m[1])
+		return strings.TrimSpace(squashPRRe.ReplaceAllString(subject, "")), pr
+	}
+	return subject, 0
+}
+
+// flagKind classifies a changed path: "schema" for the update-db*.pl schema
+// definitions, "upgrading" for anything else under a bin/upgrading directory
+// (including extension repos' ext/*/bin/upgrading), or "" if unremarkable.
+func flagKind(p string) string {
+	if !strings.HasPrefix(p, "bin/upgrading/") && !strings.Contains(p, "/bin/upgrading/") {
+		return ""
+	}
+	if strings.HasPrefix(path.Base(p), "update-db") {
+		return "schema"
+	}
+	return "upgrading"
+}
@@ -1,15 +1,90 @@
 package github
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"dreamwidth.org/dwtool/internal/model"
 )
 
+// API is the subset of GitHub that dwtool uses. *Client implements it against
+// the real REST API; tests can point a Client at an httptest server, or swap
+// in their own implementation with SetDefault.
+type API interface {
+	FetchImages(repo, imageBase string, limit int) ([]model.Image, error)
+	DispatchWorkflow(repo, workflow string, inputs map[string]string) (Dispatch, error)
+	FindDispatchedRun(repo string, d Dispatch) (int, error)
+	GetWorkflowRun(repo string, runID int) (status, conclusion string, err error)
+	ListRunJobs(repo string, runID int) ([]model.WorkflowJob, error)
+	StepLogTail(repo string, job model.WorkflowJob, step model.WorkflowStep, n int) ([]string, error)
+	Compare(repo, base, head string) (model.ReleaseDiff, error)
+	ImageProvenance(repo, imageBase, digest string) (model.Provenance, error)
+	ImageChildren(imageBase, digest string) ([]string, error)
+	DeleteImage(repo, imageBase string, img model.Image) error
+}
+
+// DispatchInput is the workflow input dwtool uses to tag the runs it starts.
+// The deploy workflows fold it into their run-name, which the runs API
+// returns as display_title, so a run can be matched to its dispatch exactly.
+const DispatchInput = "dispatch_id"
+
+// Dispatch identifies one workflow_dispatch event we sent.
+type Dispatch struct {
+	Workflow string    `json:"workflow"`
+	ID       string    `json:"id,omitempty"` // empty if the workflow doesn't accept DispatchInput
+	Since    time.Time `json:"since"`
+}
+
+// UncorrelatedError is returned when a dispatch can't be tied to exactly one
+// run: the workflow doesn't take a dispatch ID and several runs started after
+// it, so any choice could be someone else's deploy.
+type UncorrelatedError struct {
+	Workflow   string
+	Candidates int
+}
+
+func (e *UncorrelatedError) Error() string {
+	return fmt.Sprintf("can't tell which of %d new %s runs is ours (the workflow has no %s input); check GitHub Actions",
+		e.Candidates, e.Workflow, DispatchInput)
+}
+
+var (
+	defaultOnce sync.Once
+	defaultAPI  API
+	defaultErr  error
+)
+
+// Default returns the process-wide client, authenticating with the token
+// found by ResolveToken on first use.
+func Default() (API, error) {
+	defaultOnce.Do(func() {
+		if defaultAPI != nil {
+			return
+		}
+		token, err := ResolveToken()
+		if err != nil {
+			defaultErr = err
+			return
+		}
+		defaultAPI = NewClient(DefaultBaseURL, token)
+	})
+	return defaultAPI, defaultErr
+}
+
+// SetDefault replaces the client used by the package-level functions.
+func SetDefault(api API) {
+	defaultOnce.Do(func() {})
+	defaultAPI, defaultErr = api, nil
+}
+
 // ghPackageVersion represents a single GHCR package version from the GitHub API.
 type ghPackageVersion struct {
 	ID        int    `json:"id"`
@@ -23,133 +98,280 @@ type ghPackageVersion struct {
 	} `json:"metadata"`
 }
 
-// ghWorkflowRun represents a workflow run from gh run list.
+// ghWorkflowRun represents a workflow run from the Actions API.
 type ghWorkflowRun struct {
-	DatabaseID int    `json:"databaseId"`
-	CreatedAt  string `json:"createdAt"`
-}
-
-// ghRunView represents a workflow run from gh run view.
-type ghRunView struct {
-	Status     string `json:"status"`
-	Conclusion string `json:"conclusion"`
+	ID           int    `json:"id"`
+	DisplayTitle string `json:"display_title"`
+	CreatedAt    string `json:"created_at"`
+	Status       string `json:"status"`
+	Conclusion   string `json:"conclusion"`
 }
 
 // FetchImages lists recent GHCR package versions for the given image base.
 // imageBase is like "ghcr.io/dreamwidth/web22" — we extract "web22" as the package name.
-func FetchImages(repo, imageBase string, limit int) ([]model.Image, error) {
+func (c *Client) FetchImages(repo, imageBase string, limit int) ([]model.Image, error) {
+	versions, err := packageVersionsPath(repo, imageBase)
+	if err != nil {
+		return nil, err
+	}
+
+	// The API caps per_page at 100; follow Link headers for larger limits.
+	perPage := min(limit, 100)
+	path := fmt.Sprintf("%s?per_page=%d", versions, perPage)
+
+	var images []model.Image
+	for path != "" && len(images) < limit {
+		var versions []ghPackageVersion
+		h, err := c.do("GET", path, nil, &versions)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			created, _ := time.Parse(time.RFC3339, v.CreatedAt)
+			images = append(images, model.Image{
+				Digest:    v.Name,
+				Tags:      v.Metadata.Container.Tags,
+				CreatedAt: created,
+				VersionID: v.ID,
+			})
+			if len(images) >= limit {
+				break
+			}
+		}
+		path = nextPage(h)
+	}
+
+	return images, nil
+}
+
+// DeleteImage deletes one GHCR package version. The token needs the
+// delete:packages scope.
+func (c *Client) DeleteImage(repo, imageBase string, img model.Image) error {
+	if img.VersionID == 0 {
+		return fmt.Errorf("image %s has no package version ID", img.Digest)
+	}
+	versions, err := packageVersionsPath(repo, imageBase)
+	if err != nil {
+		return err
+	}
+	_, err = c.do("DELETE", fmt.Sprintf("%s/%d", versions, img.VersionID), nil, nil)
+	return err
+}
+
+// packageVersionsPath returns the API path listing imageBase's versions.
+func packageVersionsPath(repo, imageBase string) (string, error) {
 	// Extract package name from imageBase (e.g. "ghcr.io/dreamwidth/web22" -> "web22")
 	parts := strings.Split(imageBase, "/")
 	if len(parts) < 2 {
-		return nil, fmt.Errorf("invalid image base: %s", imageBase)
+		return "", fmt.Errorf("invalid image base: %s", imageBase)
 	}
 	packageName := parts[len(parts)-1]
 
 	// Extract org from repo (e.g. "dreamwidth/dreamwidth" -> "dreamwidth")
 	repoParts := strings.SplitN(repo, "/", 2)
 	if len(repoParts) != 2 {
-		return nil, fmt.Errorf("invalid repo: %s", repo)
+		return "", fmt.Errorf("invalid repo: %s", repo)
 	}
 	org := repoParts[0]
 
-	// gh api to list package versions
-	apiPath := fmt.Sprintf("/orgs/%s/packages/container/%s/versions?per_page=%d", org, packageName, limit)
-	out, err := exec.Command("gh", "api", apiPath).Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, fmt.Errorf("gh api failed: %s", string(exitErr.Stderr))
-		}
-		return nil, fmt.Errorf("gh api failed: %w", err)
-	}
+	return fmt.Sprintf("/orgs/%s/packages/container/%s/versions",
+		url.PathEscape(org), url.PathEscape(packageName)), nil
+}
 
-	var versions []ghPackageVersion
-	if err := json.Unmarshal(out, &versions); err != nil {
-		return nil, fmt.Errorf("parsing GHCR response: %w", err)
+// DispatchWorkflow triggers a workflow on the repo's default branch, tagging
+// it with a fresh dispatch ID so FindDispatchedRun can find exactly this run.
+// inputs is a map of workflow input keys to values (e.g. {"service":
+// "web-canary", "tag": "sha256:abc..."}). Workflows that don't declare
+// DispatchInput are retried without it and come back with an empty ID.
+func (c *Client) DispatchWorkflow(repo, workflow string, inputs map[string]string) (Dispatch, error) {
+	d := Dispatch{Workflow: workflow, ID: newDispatchID(), Since: time.Now()}
+	tagged := make(map[string]string, len(inputs)+1)
+	for k, v := range inputs {
+		tagged[k] = v
 	}
+	tagged[DispatchInput] = d.ID
 
-	var images []model.Image
-	for _, v := range versions {
-		created, _ := time.Parse(time.RFC3339, v.CreatedAt)
-		images = append(images, model.Image{
-			Digest:    v.Name,
-			Tags:      v.Metadata.Container.Tags,
-			CreatedAt: created,
-		})
+	err := c.triggerWorkflow(repo, workflow, tagged)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity && strings.Contains(apiErr.Message, DispatchInput) {
+		d.ID = ""
+		err = c.triggerWorkflow(repo, workflow, inputs)
 	}
-
-	return images, nil
+	return d, err
 }
 
-// TriggerWorkflow dispatches a GitHub Actions workflow.
-// inputs is a map of workflow input keys to values (e.g. {"service": "web-canary", "tag": "sha256:abc..."}).
-func TriggerWorkflow(repo, workflow string, inputs map[string]string) error {
-	args := []string{"workflow", "run", workflow, "-R", repo}
-	for k, v := range inputs {
-		args = append(args, "-f", k+"="+v)
+// triggerWorkflow sends the workflow_dispatch event.
+func (c *Client) triggerWorkflow(repo, workflow string, inputs map[string]string) error {
+	base, err := repoPath(repo)
+	if err != nil {
+		return err
 	}
-
-	cmd := exec.Command("gh", args...)
-	out, err := cmd.CombinedOutput()
+	ref, err := c.repoDefaultBranch(repo)
 	if err != nil {
-		return fmt.Errorf("gh workflow run failed: %s", strings.TrimSpace(string(out)))
+		return err
 	}
-	return nil
+	body := struct {
+		Ref    string            `json:"ref"`
+		Inputs map[string]string `json:"inputs,omitempty"`
+	}{ref, inputs}
+	_, err = c.do("POST", base+"/actions/workflows/"+url.PathEscape(workflow)+"/dispatches", body, nil)
+	return err
+}
+
+func newDispatchID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
-// FindWorkflowRun finds the most recent workflow run created after `since`.
-// Returns the run ID or 0 if not found.
-func FindWorkflowRun(repo, workflow string, since time.Time) (int, error) {
-	out, err := exec.Command("gh", "run", "list",
-		"--workflow="+workflow,
-		"-R", repo,
-		"--json", "databaseId,createdAt",
-		"--limit", "5",
-	).Output()
+// repoDefaultBranch returns (and caches) the branch workflow dispatches run on.
+func (c *Client) repoDefaultBranch(repo string) (string, error) {
+	c.mu.Lock()
+	branch, ok := c.defaultBranch[repo]
+	c.mu.Unlock()
+	if ok {
+		return branch, nil
+	}
+	base, err := repoPath(repo)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return 0, fmt.Errorf("gh run list failed: %s", string(exitErr.Stderr))
-		}
-		return 0, fmt.Errorf("gh run list failed: %w", err)
+		return "", err
+	}
+	var info struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if _, err := c.do("GET", base, nil, &info); err != nil {
+		return "", err
+	}
+	if info.DefaultBranch == "" {
+		return "", fmt.Errorf("github: %s has no default branch", repo)
 	}
+	c.mu.Lock()
+	c.defaultBranch[repo] = info.DefaultBranch
+	c.mu.Unlock()
+	return info.DefaultBranch, nil
+}
 
-	var runs []ghWorkflowRun
-	if err := json.Unmarshal(out, &runs); err != nil {
-		return 0, fmt.Errorf("parsing run list: %w", err)
+// FindDispatchedRun returns the ID of the run started by d, or 0 if it hasn't
+// appeared yet. With a dispatch ID the match is exact; without one, a single
+// run created after the dispatch is accepted and several are an
+// *UncorrelatedError.
+func (c *Client) FindDispatchedRun(repo string, d Dispatch) (int, error) {
+	base, err := repoPath(repo)
+	if err != nil {
+		return 0, err
 	}
+	// Look back a little further than d.Since to absorb clock skew between
+	// us and GitHub; the dispatch ID keeps older runs from matching.
+	created := d.Since.Add(-2 * time.Minute).UTC().Format(time.RFC3339)
+	path := base + "/actions/workflows/" + url.PathEscape(d.Workflow) + "/runs?event=workflow_dispatch&per_page=50&created=" + url.QueryEscape(">="+created)
 
-	for _, r := range runs {
-		created, err := time.Parse(time.RFC3339, r.CreatedAt)
+	var candidates []int
+	for page := 0; path != "" && page < 4; page++ {
+		var resp struct {
+			WorkflowRuns []ghWorkflowRun `json:"workflow_runs"`
+		}
+		h, err := c.do("GET", path, nil, &resp)
 		if err != nil {
-			continue
+			return 0, err
 		}
-		if created.After(since) {
-			return r.DatabaseID, nil
+		for _, r := range resp.WorkflowRuns {
+			if d.ID != "" {
+				if strings.Contains(r.DisplayTitle, "["+d.ID+"]") {
+					return r.ID, nil
+				}
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339, r.CreatedAt); err == nil && t.After(d.Since) {
+				candidates = append(candidates, r.ID)
+			}
 		}
+		path = nextPage(h)
 	}
 
-	return 0, nil
+	switch {
+	case d.ID != "" || len(candidates) == 0:
+		return 0, nil
+	case len(candidates) == 1:
+		return candidates[0], nil
+	default:
+		return 0, &UncorrelatedError{Workflow: d.Workflow, Candidates: len(candidates)}
+	}
 }
 
 // GetWorkflowRun returns the status and conclusion of a workflow run.
+func (c *Client) GetWorkflowRun(repo string, runID int) (status, conclusion string, err error) {
+	base, err := repoPath(repo)
+	if err != nil {
+		return "", "", err
+	}
+	var run ghWorkflowRun
+	if _, err := c.do("GET", fmt.Sprintf("%s/actions/runs/%d", base, runID), nil, &run); err != nil {
+		return "", "", err
+	}
+	return run.Status, run.Conclusion, nil
+}
+
+// FetchImages lists recent GHCR images using the default client.
+func FetchImages(repo, imageBase string, limit int) ([]model.Image, error) {
+	api, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return api.FetchImages(repo, imageBase, limit)
+}
+
+// DeleteImage deletes a GHCR package version using the default client.
+func DeleteImage(repo, imageBase string, img model.Image) error {
+	api, err := Default()
+	if err != nil {
+		return err
+	}
+	return api.DeleteImage(repo, imageBase, img)
+}
+
+// DispatchWorkflow triggers a workflow using the default client.
+func DispatchWorkflow(repo, workflow string, inputs map[string]string) (Dispatch, error) {
+	api, err := Default()
+	if err != nil {
+		return Dispatch{}, err
+	}
+	return api.DispatchWorkflow(repo, workflow, inputs)
+}
+
+// FindDispatchedRun finds the run for a dispatch using the default client.
+func FindDispatchedRun(repo string, d Dispatch) (int, error) {
+	api, err := Default()
+	if err != nil {
+		return 0, err
+	}
+	return api.FindDispatchedRun(repo, d)
+}
+
+// GetWorkflowRun polls a run using the default client.
 func GetWorkflowRun(repo string, runID int) (status, conclusion string, err error) {
-	out, err := exec.Command("gh", "run", "view",
-		fmt.Sprintf("%d", runID),
-		"-R", repo,
-		"--json", "status,conclusion",
-	).Output()
+	api, err := Default()
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", "", fmt.Errorf("gh run view failed: %s", string(exitErr.Stderr))
-		}
-		return "", "", fmt.Errorf("gh run view failed: %w", err)
+		return "", "", err
 	}
+	return api.GetWorkflowRun(repo, runID)
+}
 
-	var run ghRunView
-	if err := json.Unmarshal(out, &run); err != nil {
-		return "", "", fmt.Errorf("parsing run view: %w", err)
+// ListRunJobs lists a run's jobs using the default client.
+func ListRunJobs(repo string, runID int) ([]model.WorkflowJob, error) {
+	api, err := Default()
+	if err != nil {
+		return nil, err
 	}
+	return api.ListRunJobs(repo, runID)
+}
 
-	return run.Status, run.Conclusion, nil
+// StepLogTail fetches the end of a step's log using the default client.
+func StepLogTail(repo string, job model.WorkflowJob, step model.WorkflowStep, n int) ([]string, error) {
+	api, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return api.StepLogTail(repo, job, step, n)
 }
 
 // ResolveCommitMessages tries to find git commit messages for images
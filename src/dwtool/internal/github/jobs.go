@@ -0,0 +1,131 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+type ghJob struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	Conclusion  string    `json:"conclusion"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	Steps       []struct {
+		Number      int       `json:"number"`
+		Name        string    `json:"name"`
+		Status      string    `json:"status"`
+		Conclusion  string    `json:"conclusion"`
+		StartedAt   time.Time `json:"started_at"`
+		CompletedAt time.Time `json:"completed_at"`
+	} `json:"steps"`
+}
+
+// ListRunJobs returns the jobs of a workflow run (latest attempt) with their
+// steps, in the order GitHub reports them.
+func (c *Client) ListRunJobs(repo string, runID int) ([]model.WorkflowJob, error) {
+	base, err := repoPath(repo)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("%s/actions/runs/%d/jobs?filter=latest&per_page=100", base, runID)
+	var jobs []model.WorkflowJob
+	for path != "" {
+		var resp struct {
+			Jobs []ghJob `json:"jobs"`
+		}
+		h, err := c.do("GET", path, nil, &resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range resp.Jobs {
+			job := model.WorkflowJob{
+				ID:          j.ID,
+				Name:        j.Name,
+				Status:      j.Status,
+				Conclusion:  j.Conclusion,
+				StartedAt:   j.StartedAt,
+				CompletedAt: j.CompletedAt,
+			}
+			for _, s := range j.Steps {
+				job.Steps = append(job.Steps, model.WorkflowStep{
+					Number:      s.Number,
+					Name:        s.Name,
+					Status:      s.Status,
+					Conclusion:  s.Conclusion,
+					StartedAt:   s.StartedAt,
+					CompletedAt: s.CompletedAt,
+				})
+			}
+			jobs = append(jobs, job)
+		}
+		path = nextPage(h)
+	}
+	return jobs, nil
+}
+
+// FailedStep returns the first failed step across jobs. ok is false if no
+// step failed (a job can also fail before any step runs, e.g. no runner).
+func FailedStep(jobs []model.WorkflowJob) (job model.WorkflowJob, step model.WorkflowStep, ok bool) {
+	for _, j := range jobs {
+		for _, s := range j.Steps {
+			if s.Conclusion == "failure" {
+				return j, s, true
+			}
+		}
+	}
+	return model.WorkflowJob{}, model.WorkflowStep{}, false
+}
+
+// StepLogTail returns up to n lines of step's output from job's log, with
+// GitHub's timestamps stripped. The jobs API only serves whole-job logs, so
+// the step's lines are picked out by timestamp; if that finds nothing, the
+// tail of the whole job log is returned instead.
+func (c *Client) StepLogTail(repo string, job model.WorkflowJob, step model.WorkflowStep, n int) ([]string, error) {
+	base, err := repoPath(repo)
+	if err != nil {
+		return nil, err
+	}
+	// This redirects to a short-lived blob URL; net/http drops the
+	// Authorization header when following it to another host.
+	_, data, err := c.send("GET", fmt.Sprintf("%s/actions/jobs/%d/logs", base, job.ID), nil)
+	if err != nil {
+		return nil, err
+	}
+	return logTail(string(data), step.StartedAt, step.CompletedAt, n), nil
+}
+
+// logTail picks the lines of a job log stamped between from and to (each line
+// starts with an RFC 3339 timestamp) and returns the last n of them.
+func logTail(log string, from, to time.Time, n int) []string {
+	var all, inStep []string
+	for _, line := range strings.Split(strings.TrimRight(log, "\n"), "\n") {
+		line = strings.TrimPrefix(strings.TrimRight(line, "\r"), "\ufeff")
+		stamp, text, _ := strings.Cut(line, " ")
+		ts, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil {
+			text = line
+		}
+		if strings.HasPrefix(text, "##[endgroup]") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "##[group]")
+		all = append(all, text)
+		if err == nil && !from.IsZero() && !ts.Before(from.Add(-time.Second)) &&
+			(to.IsZero() || !ts.After(to.Add(time.Second))) {
+			inStep = append(inStep, text)
+		}
+	}
+	lines := inStep
+	if len(lines) == 0 {
+		lines = all
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -0,0 +1,335 @@
+package github
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+// attestation is one entry from GET /repos/{repo}/attestations/{digest}: a
+// Sigstore bundle holding a DSSE-signed in-toto statement and the Fulcio
+// certificate it was signed with.
+type attestation struct {
+	Bundle struct {
+		VerificationMaterial struct {
+			Certificate *struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificate"`
+			X509CertificateChain *struct {
+				Certificates []struct {
+					RawBytes []byte `json:"rawBytes"`
+				} `json:"certificates"`
+			} `json:"x509CertificateChain"`
+		} `json:"verificationMaterial"`
+		DSSEEnvelope struct {
+			Payload     []byte `json:"payload"`
+			PayloadType string `json:"payloadType"`
+			Signatures  []struct {
+				Sig []byte `json:"sig"`
+			} `json:"signatures"`
+		} `json:"dsseEnvelope"`
+	} `json:"bundle"`
+}
+
+// inTotoStatement is the part of an attestation's statement dwtool reads.
+type inTotoStatement struct {
+	PredicateType string `json:"predicateType"`
+	Subject       []struct {
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+}
+
+// Fulcio records where a workflow's signing certificate was issued in these
+// extensions, taken from the workflow's OIDC token, so unlike the statement
+// they can't be written by the build itself.
+var (
+	oidBuildSignerURI         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 9}
+	oidSourceRepositoryURI    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 12}
+	oidSourceRepositoryDigest = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 13}
+	oidSourceRepositoryRef    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 14}
+)
+
+// ImageProvenance verifies the image imageBase@digest's signed build
+// provenance attestation and checks that it was built by repo's CI from a
+// commit on repo's default branch. Failed checks are listed in Problems; an error means the registry
+// or GitHub couldn't be read at all.
+func (c *Client) ImageProvenance(repo, imageBase, digest string) (model.Provenance, error) {
+	key := imageBase + "@" + digest
+	c.mu.Lock()
+	p, ok := c.provenance[key]
+	c.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	p, err := c.readProvenance(imageBase, digest)
+	if err != nil {
+		return p, err
+	}
+	if err := c.readAttestation(repo, digest, &p); err != nil {
+		return p, err
+	}
+	if err := c.checkProvenance(repo, &p); err != nil {
+		return p, err
+	}
+
+	c.mu.Lock()
+	c.provenance[key] = p
+	c.mu.Unlock()
+	return p, nil
+}
+
+// readProvenance fills in Source and Revision from the image's OCI config
+// labels. Anyone who can build an image can set those, so they're only
+// shown, never trusted; readAttestation replaces them with verified values.
+func (c *Client) readProvenance(imageBase, digest string) (model.Provenance, error) {
+	var p model.Provenance
+	reg, err := c.openRegistry(imageBase)
+	if err != nil {
+		return p, err
+	}
+
+	var top ociManifest
+	if err := reg.get("/manifests/"+digest, manifestAccept, &top); err != nil {
+		return p, err
+	}
+	image := top
+	if len(top.Manifests) > 0 {
+		// An index: find the image manifest.
+		var imageDigest string
+		for _, m := range top.Manifests {
+			if m.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+				continue
+			}
+			if imageDigest == "" || (m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == "amd64") {
+				imageDigest = m.Digest
+			}
+		}
+		if imageDigest == "" {
+			return p, fmt.Errorf("%s@%s: index has no image manifest", imageBase, digest)
+		}
+		if err := reg.get("/manifests/"+imageDigest, manifestAccept, &image); err != nil {
+			return p, err
+		}
+	}
+
+	var cfg struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if image.Config.Digest != "" {
+		if err := reg.get("/blobs/"+image.Config.Digest, "", &cfg); err != nil {
+			return p, err
+		}
+	}
+	p.Source = cfg.Config.Labels["org.opencontainers.image.source"]
+	p.Revision = cfg.Config.Labels["org.opencontainers.image.revision"]
+	return p, nil
+}
+
+// checkProvenance records in p.Problems every way p falls short of "built
+// by repo's CI from a commit on its default branch".
+func (c *Client) checkProvenance(repo string, p *model.Provenance) error {
+	if !p.Attested {
+		// readAttestation has said why; unsigned labels prove nothing more.
+		return nil
+	}
+	if src := repoFromURL(p.Source); src == "" {
+		p.Problems = append(p.Problems, "no source repository recorded")
+	} else if !strings.EqualFold(src, repo) {
+		p.Problems = append(p.Problems, fmt.Sprintf("built from %s, not %s", src, repo))
+	}
+	if !strings.HasPrefix(strings.ToLower(p.Builder), strings.ToLower("https://github.com/"+repo+"/.github/workflows/")) {
+		p.Problems = append(p.Problems, fmt.Sprintf("built by %s, not %s's CI", dashIfEmpty(p.Builder), repo))
+	}
+	if p.Revision == "" {
+		p.Problems = append(p.Problems, "no git revision recorded")
+		return nil
+	}
+
+	branch, err := c.repoDefaultBranch(repo)
+	if err != nil {
+		return err
+	}
+	prefix, err := repoPath(repo)
+	if err != nil {
+		return err
+	}
+	// Comparing the branch with the commit says whether the branch
+	// contains it ("behind" or "identical").
+	var cmp struct {
+		Status string `json:"status"`
+	}
+	_, err = c.do("GET", fmt.Sprintf("%s/compare/%s...%s?per_page=1", prefix, url.PathEscape(branch), url.PathEscape(p.Revision)), nil, &cmp)
+	switch {
+	case IsNotFound(err):
+		p.Problems = append(p.Problems, fmt.Sprintf("commit %s is not in %s", shortRev(p.Revision), repo))
+	case err != nil:
+		return err
+	case cmp.Status == "behind" || cmp.Status == "identical":
+		p.Branch = branch
+	default:
+		p.Problems = append(p.Problems, fmt.Sprintf("commit %s is not on %s (%s)", shortRev(p.Revision), branch, cmp.Status))
+	}
+	return nil
+}
+
+// readAttestation fetches the image's build provenance attestations from
+// repo and, if one checks out, sets p's Source, Revision, Ref and Builder
+// from its signing certificate and marks it Attested. A missing or invalid
+// attestation is recorded in p.Problems; an error means GitHub couldn't be
+// asked, which says nothing either way about the image.
+//
+// GitHub only stores attestations for a repository from that repository's
+// workflows, so the certificate is trusted as issued by Fulcio without
+// checking its chain or the transparency log; what is checked is that it
+// signed the statement, and that the statement is SLSA provenance for this
+// digest.
+func (c *Client) readAttestation(repo, digest string, p *model.Provenance) error {
+	prefix, err := repoPath(repo)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Attestations []attestation `json:"attestations"`
+	}
+	_, err = c.do("GET", prefix+"/attestations/"+url.PathEscape(digest), nil, &resp)
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("attestation verifier unavailable: %w", err)
+	}
+	if len(resp.Attestations) == 0 {
+		p.Problems = append(p.Problems, "no build provenance attestation")
+		return nil
+	}
+
+	var reason string
+	for _, a := range resp.Attestations {
+		var cert *x509.Certificate
+		if cert, reason = verifyAttestation(a, digest); cert == nil {
+			continue
+		}
+		p.Attested = true
+		p.Builder = certExtension(cert, oidBuildSignerURI)
+		p.Source = certExtension(cert, oidSourceRepositoryURI)
+		p.Revision = certExtension(cert, oidSourceRepositoryDigest)
+		p.Ref = certExtension(cert, oidSourceRepositoryRef)
+		return nil
+	}
+	p.Problems = append(p.Problems, fmt.Sprintf("no verified build provenance attestation (%s)", reason))
+	return nil
+}
+
+// verifyAttestation checks that a is a signed SLSA provenance statement
+// about digest, returning its signing certificate, or nil and why not.
+func verifyAttestation(a attestation, digest string) (*x509.Certificate, string) {
+	material := a.Bundle.VerificationMaterial
+	var der []byte
+	switch {
+	case material.Certificate != nil:
+		der = material.Certificate.RawBytes
+	case material.X509CertificateChain != nil && len(material.X509CertificateChain.Certificates) > 0:
+		der = material.X509CertificateChain.Certificates[0].RawBytes
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Sprintf("bad signing certificate: %v", err)
+	}
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Sprintf("unsupported signing key %T", cert.PublicKey)
+	}
+
+	env := a.Bundle.DSSEEnvelope
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(env.PayloadType), env.PayloadType, len(env.Payload), env.Payload)
+	hash := sha256.Sum256([]byte(pae))
+	signed := false
+	for _, sig := range env.Signatures {
+		if ecdsa.VerifyASN1(key, hash[:], sig.Sig) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, "signature doesn't match its certificate"
+	}
+
+	var stmt inTotoStatement
+	if err := json.Unmarshal(env.Payload, &stmt); err != nil {
+		return nil, fmt.Sprintf("bad statement: %v", err)
+	}
+	if !strings.HasPrefix(stmt.PredicateType, "https://slsa.dev/provenance/") {
+		return nil, fmt.Sprintf("predicate is %s, not SLSA provenance", dashIfEmpty(stmt.PredicateType))
+	}
+	alg, sum, _ := strings.Cut(digest, ":")
+	for _, subject := range stmt.Subject {
+		if strings.EqualFold(subject.Digest[alg], sum) {
+			return cert, ""
+		}
+	}
+	return nil, "statement is about a different image"
+}
+
+// certExtension returns the string value of a Fulcio certificate extension,
+// or "" if it isn't there.
+func certExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) string {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oid) {
+			continue
+		}
+		var v string
+		if _, err := asn1.Unmarshal(ext.Value, &v); err == nil {
+			return v
+		}
+	}
+	return ""
+}
+
+// repoFromURL turns a source URL (https://github.com/o/r, git+https://...,
+// o/r.git) into "o/r", or "" if it doesn't look like a GitHub repository.
+func repoFromURL(s string) string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "git+")
+	s, _, _ = strings.Cut(s, "@")
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".git")
+	for _, prefix := range []string{"https://github.com/", "http://github.com/", "github.com/"} {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			s = rest
+			break
+		}
+	}
+	if strings.Count(s, "/") != 1 || strings.Contains(s, ":") {
+		return ""
+	}
+	return s
+}
+
+func shortRev(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// ImageProvenance reads and checks an image's provenance using the default
+// client.
+func ImageProvenance(repo, imageBase, digest string) (model.Provenance, error) {
+	api, err := Default()
+	if err != nil {
+		return model.Provenance{}, err
+	}
+	return api.ImageProvenance(repo, imageBase, digest)
+}
@@ -0,0 +1,197 @@
+package github
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"dreamwidth.org/dwtool/internal/model"
+)
+
+const imageDigest = "sha256:0123abcd"
+
+// signedAttestation returns an attestations API response holding one
+// statement, signed with a throwaway certificate carrying Fulcio's
+// extensions for builder and revision. tamper, if set, runs on the envelope
+// after signing.
+func signedAttestation(t *testing.T, statement, builder, revision string, tamper func(env map[string]interface{})) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exts []pkix.Extension
+	for oid, v := range map[*asn1.ObjectIdentifier]string{
+		&oidBuildSignerURI:         builder,
+		&oidSourceRepositoryURI:    "https://github.com/o/r",
+		&oidSourceRepositoryDigest: revision,
+		&oidSourceRepositoryRef:    "refs/heads/main",
+	} {
+		value, _ := asn1.MarshalWithParams(v, "utf8")
+		exts = append(exts, pkix.Extension{Id: *oid, Value: value})
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour), ExtraExtensions: exts}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloadType := "application/vnd.in-toto+json"
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(statement), statement)
+	hash := sha256.Sum256([]byte(pae))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]interface{}{
+		"payload":     []byte(statement),
+		"payloadType": payloadType,
+		"signatures":  []map[string]interface{}{{"sig": sig}},
+	}
+	if tamper != nil {
+		tamper(env)
+	}
+	out, _ := json.Marshal(map[string]interface{}{"attestations": []interface{}{
+		map[string]interface{}{"bundle": map[string]interface{}{
+			"verificationMaterial": map[string]interface{}{"certificate": map[string]interface{}{"rawBytes": der}},
+			"dsseEnvelope":         env,
+		}},
+	}})
+	return string(out)
+}
+
+func slsaStatement(digest string) string {
+	alg, sum, _ := strings.Cut(digest, ":")
+	return fmt.Sprintf(`{"_type": "https://in-toto.io/Statement/v1", "subject": [{"name": "ghcr.io/o/web22", "digest": {%q: %q}}], "predicateType": "https://slsa.dev/provenance/v1", "predicate": {}}`, alg, sum)
+}
+
+func TestReadAttestation(t *testing.T) {
+	builder := "https://github.com/o/r/.github/workflows/web22-build.yml@refs/heads/main"
+	rev := "0123456789abcdef0123456789abcdef01234567"
+	body := signedAttestation(t, slsaStatement(imageDigest), builder, rev, nil)
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/attestations/"+imageDigest {
+			t.Errorf("fetched %s", r.URL.Path)
+		}
+		fmt.Fprint(w, body)
+	})
+	// The labels are replaced by what the certificate says.
+	p := model.Provenance{Source: "https://github.com/someone/else", Revision: "feedface"}
+	if err := c.readAttestation("o/r", imageDigest, &p); err != nil {
+		t.Fatal(err)
+	}
+	want := model.Provenance{
+		Source:   "https://github.com/o/r",
+		Revision: rev,
+		Ref:      "refs/heads/main",
+		Builder:  builder,
+		Attested: true,
+	}
+	if fmt.Sprint(p) != fmt.Sprint(want) {
+		t.Errorf("got %+v\nwant %+v", p, want)
+	}
+}
+
+func TestReadAttestationUnverified(t *testing.T) {
+	builder := "https://github.com/o/r/.github/workflows/web22-build.yml@refs/heads/main"
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		problem string
+	}{
+		{"none", http.StatusNotFound, `{"message": "Not Found"}`, "no build provenance attestation"},
+		{"empty", http.StatusOK, `{"attestations": []}`, "no build provenance attestation"},
+		{"other image", http.StatusOK, signedAttestation(t, slsaStatement("sha256:ffff"), builder, "abc", nil),
+			"no verified build provenance attestation (statement is about a different image)"},
+		{"not provenance", http.StatusOK, signedAttestation(t, strings.Replace(slsaStatement(imageDigest), "https://slsa.dev/provenance/v1", "https://spdx.dev/Document", 1), builder, "abc", nil),
+			"no verified build provenance attestation (predicate is https://spdx.dev/Document, not SLSA provenance)"},
+		{"tampered", http.StatusOK, signedAttestation(t, slsaStatement("sha256:ffff"), builder, "abc", func(env map[string]interface{}) {
+			env["payload"] = []byte(slsaStatement(imageDigest))
+		}), "no verified build provenance attestation (signature doesn't match its certificate)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			p := model.Provenance{Source: "https://github.com/o/r", Revision: "0123456789ab"}
+			if err := c.readAttestation("o/r", imageDigest, &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Attested || len(p.Problems) != 1 || p.Problems[0] != tt.problem {
+				t.Errorf("got %+v, want the one problem %q", p, tt.problem)
+			}
+		})
+	}
+
+	// GitHub being unreachable isn't evidence about the image.
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	p := model.Provenance{}
+	err := c.readAttestation("o/r", imageDigest, &p)
+	if err == nil || !strings.Contains(err.Error(), "attestation verifier unavailable") || len(p.Problems) != 0 {
+		t.Errorf("got %v and %+v, want only a verifier unavailable error", err, p)
+	}
+}
+
+func TestCheckProvenance(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/o/r":
+			fmt.Fprint(w, `{"default_branch": "main"}`)
+		case strings.HasPrefix(r.URL.Path, "/repos/o/r/compare/main...good"):
+			fmt.Fprint(w, `{"status": "behind"}`)
+		case strings.HasPrefix(r.URL.Path, "/repos/o/r/compare/main...branch"):
+			fmt.Fprint(w, `{"status": "diverged"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ci := "https://github.com/o/r/.github/workflows/web22-build.yml@refs/heads/main"
+
+	tests := []struct {
+		name     string
+		p        model.Provenance
+		problems []string
+	}{
+		{"verified", model.Provenance{Attested: true, Source: "https://github.com/o/r", Revision: "good", Builder: ci}, nil},
+		{"labels only", model.Provenance{Source: "https://github.com/o/r", Revision: "good", Problems: []string{"no build provenance attestation"}},
+			[]string{"no build provenance attestation"}},
+		{"fork", model.Provenance{Attested: true, Source: "https://github.com/x/r", Revision: "good", Builder: "https://github.com/x/r/.github/workflows/b.yml@refs/heads/main"},
+			[]string{"built from x/r, not o/r", "built by https://github.com/x/r/.github/workflows/b.yml@refs/heads/main, not o/r's CI"}},
+		{"not a workflow", model.Provenance{Attested: true, Source: "https://github.com/o/r", Revision: "good", Builder: "https://github.com/o/r/somewhere"},
+			[]string{"built by https://github.com/o/r/somewhere, not o/r's CI"}},
+		{"unmerged", model.Provenance{Attested: true, Source: "https://github.com/o/r", Revision: "branch", Builder: ci},
+			[]string{"commit branch is not on main (diverged)"}},
+		{"unknown commit", model.Provenance{Attested: true, Source: "https://github.com/o/r", Revision: "gone", Builder: ci},
+			[]string{"commit gone is not in o/r"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.p
+			if err := c.checkProvenance("o/r", &p); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(p.Problems, "\n") != strings.Join(tt.problems, "\n") {
+				t.Errorf("problems = %q, want %q", p.Problems, tt.problems)
+			}
+			if p.Verified() && p.Branch != "main" {
+				t.Errorf("verified with branch %q", p.Branch)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Media types the registry serves image indexes and manifests as. buildx
+// pushes an index even for single-platform images, so it can attach the
+// provenance attestation alongside the image manifest.
+var manifestAccept = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// ociManifest covers both an index (Manifests) and an image manifest
+// (Config and Layers).
+type ociManifest struct {
+	MediaType string `json:"mediaType"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform *struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"manifests"`
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Layers []struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// ImageChildren returns the manifests an image index refers to -- the
+// per-platform images and their attestations, which GHCR lists as separate
+// untagged versions -- or nil if digest is a plain image manifest.
+func (c *Client) ImageChildren(imageBase, digest string) ([]string, error) {
+	reg, err := c.openRegistry(imageBase)
+	if err != nil {
+		return nil, err
+	}
+	var m ociManifest
+	if err := reg.get("/manifests/"+digest, manifestAccept, &m); err != nil {
+		return nil, err
+	}
+	var children []string
+	for _, child := range m.Manifests {
+		children = append(children, child.Digest)
+	}
+	return children, nil
+}
+
+// registry reads one repository of an OCI distribution registry.
+type registry struct {
+	base  string // https://host/v2/name
+	token string
+	http  *http.Client
+}
+
+// openRegistry returns an authenticated reader for imageBase's repository.
+func (c *Client) openRegistry(imageBase string) (*registry, error) {
+	host, name, ok := strings.Cut(imageBase, "/")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("invalid image base: %s", imageBase)
+	}
+	reg := &registry{base: "https://" + host + "/v2/" + name, http: c.http}
+	if err := reg.authenticate(host, name, c.token); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// authenticate gets a pull token for name, exchanging the GitHub token for
+// a registry token the way docker login does.
+func (r *registry) authenticate(host, name, ghToken string) error {
+	u := fmt.Sprintf("https://%s/token?service=%s&scope=%s", host, url.QueryEscape(host), url.QueryEscape("repository:"+name+":pull"))
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	if ghToken != "" {
+		req.SetBasicAuth("dwtool", ghToken)
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("registry: token for %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry: token for %s: %s", name, resp.Status)
+	}
+	var tok struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return fmt.Errorf("registry: parsing token response: %w", err)
+	}
+	r.token = tok.Token
+	return nil
+}
+
+// get fetches path (under /v2/name) and decodes the JSON response into out.
+func (r *registry) get(path, accept string, out interface{}) error {
+	req, err := http.NewRequest("GET", r.base+path, nil)
+	if err != nil {
+		return err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("registry: GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("registry: reading %s: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry: GET %s: %s", path, resp.Status)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("registry: parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// ImageChildren lists an image index's manifests using the default client.
+func ImageChildren(imageBase, digest string) ([]string, error) {
+	api, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	return api.ImageChildren(imageBase, digest)
+}
@@ -0,0 +1,38 @@
+package lock
+
+import (
+	"fmt"
+	"time"
+
+	"dreamwidth.org/dwtool/internal/config"
+)
+
+// FreezeError is returned when a deploy falls in a freeze window.
+type FreezeError struct {
+	Service string
+	Window  config.FreezeWindow
+	Until   time.Time
+}
+
+func (e *FreezeError) Error() string {
+	msg := fmt.Sprintf("deploys to %s are frozen (%s) until %s", e.Service, e.Window.Name, e.Until.Local().Format("Mon 15:04"))
+	if e.Window.Reason != "" {
+		msg += ": " + e.Window.Reason
+	}
+	return msg
+}
+
+// CheckFreeze returns a *FreezeError if any of services is in a configured
+// freeze window now, or an error if the windows can't be loaded.
+func CheckFreeze(services []string) error {
+	windows, err := config.LoadFreezeWindows()
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		if w, until := config.ActiveFreeze(windows, svc, time.Now()); w != nil {
+			return &FreezeError{Service: svc, Window: *w, Until: until}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+// Package lock implements advisory per-service deploy locks, so two people
+// can't deploy the same service at once. Locks are kept somewhere shared (an
+// SSM parameter per service) or, for tests and single-user setups, in a
+// local directory. They are advisory: dwtool honours them, the GitHub
+// Actions UI does not.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+
+	"dreamwidth.org/dwtool/internal/audit"
+	"dreamwidth.org/dwtool/internal/config"
+)
+
+// Lock is one service's deploy lock.
+type Lock struct {
+	Service  string    `json:"service"`
+	ID       string    `json:"id"` // distinguishes re-acquisitions, so a stale holder can't release a newer lock
+	Owner    string    `json:"owner"`
+	Reason   string    `json:"reason,omitempty"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Expired reports whether the lock has lapsed and may be taken over.
+func (l Lock) Expired() bool { return !time.Now().Before(l.Expires) }
+
+// HeldError is returned when someone else holds a service's lock.
+type HeldError struct {
+	Lock Lock
+}
+
+func (e *HeldError) Error() string {
+	msg := fmt.Sprintf("%s is locked by %s until %s", e.Lock.Service, e.Lock.Owner, e.Lock.Expires.Local().Format("15:04"))
+	if e.Lock.Reason != "" {
+		msg += " (" + e.Lock.Reason + ")"
+	}
+	return msg
+}
+
+// errExists is returned by a store's create when the service already has a
+// lock.
+var errExists = errors.New("lock exists")
+
+// store is where locks are kept.
+type store interface {
+	get(service string) (*Lock, error) // nil, nil if unlocked
+	create(l Lock) error               // errExists if already locked
+	replace(l Lock) error
+	remove(service string) error
+	list() ([]Lock, error)
+}
+
+// Locker acquires and releases deploy locks.
+type Locker struct {
+	store store
+	ttl   time.Duration
+}
+
+// Open returns a Locker for the configured backend. region is the AWS
+// region for the SSM backend.
+func Open(region string) (*Locker, error) {
+	cfg, err := config.LoadLockConfig()
+	if err != nil {
+		return nil, err
+	}
+	ttl, _ := cfg.TTLDuration()
+	var s store
+	switch cfg.Backend {
+	case "file":
+		s = fileStore{dir: cfg.Dir}
+	default:
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(region))
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS config: %w", err)
+		}
+		s = ssmStore{client: ssm.NewFromConfig(awsCfg), prefix: strings.TrimSuffix(cfg.SSMPrefix, "/")}
+	}
+	return &Locker{store: s, ttl: ttl}, nil
+}
+
+// TTL is the configured lifetime of a deploy lock.
+func (lk *Locker) TTL() time.Duration { return lk.ttl }
+
+// Acquire locks service for the current actor for ttl. A lock held by the
+// same actor is taken over (e.g. re-running a failed deploy); an expired
+// lock is taken over from anyone. Otherwise it returns a *HeldError.
+func (lk *Locker) Acquire(service, reason string, ttl time.Duration) (Lock, error) {
+	l := Lock{
+		Service:  service,
+		ID:       newID(),
+		Owner:    audit.Actor(),
+		Reason:   reason,
+		Acquired: time.Now().UTC(),
+	}
+	l.Expires = l.Acquired.Add(ttl)
+
+	cur, err := lk.store.get(service)
+	if err != nil {
+		return Lock{}, err
+	}
+	if cur == nil {
+		err = lk.store.create(l)
+		if errors.Is(err, errExists) {
+			// Someone got there first.
+			if cur, gerr := lk.store.get(service); gerr == nil && cur != nil {
+				return Lock{}, &HeldError{Lock: *cur}
+			}
+		}
+		if err != nil {
+			return Lock{}, err
+		}
+		return l, nil
+	}
+	if cur.Owner != l.Owner && !cur.Expired() {
+		return Lock{}, &HeldError{Lock: *cur}
+	}
+	if err := lk.store.replace(l); err != nil {
+		return Lock{}, err
+	}
+	// Two takeovers of an expired lock can race; the last write wins, and
+	// the loser finds out here.
+	if cur, err := lk.store.get(service); err == nil && cur != nil && cur.ID != l.ID {
+		return Lock{}, &HeldError{Lock: *cur}
+	}
+	return l, nil
+}
+
+// Extend resets l's expiry to d from now, if l is still the current lock.
+func (lk *Locker) Extend(l Lock, d time.Duration) (Lock, error) {
+	cur, err := lk.store.get(l.Service)
+	if err != nil {
+		return l, err
+	}
+	if cur == nil || cur.ID != l.ID {
+		return l, fmt.Errorf("lock on %s is no longer ours", l.Service)
+	}
+	l.Expires = time.Now().UTC().Add(d)
+	return l, lk.store.replace(l)
+}
+
+// Release removes l if it is still the current lock for its service. A
+// lock that has since been taken over by someone else is left alone.
+func (lk *Locker) Release(l Lock) error {
+	cur, err := lk.store.get(l.Service)
+	if err != nil {
+		return err
+	}
+	if cur == nil || cur.ID != l.ID {
+		return nil
+	}
+	return lk.store.remove(l.Service)
+}
+
+// ForceRelease removes service's lock whoever holds it.
+func (lk *Locker) ForceRelease(service string) error {
+	return lk.store.remove(service)
+}
+
+// Get returns service's lock, or nil if it has none.
+func (lk *Locker) Get(service string) (*Lock, error) {
+	return lk.store.get(service)
+}
+
+// List returns every lock, expired ones included, by service.
+func (lk *Locker) List() ([]Lock, error) {
+	locks, err := lk.store.list()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Service < locks[j].Service })
+	return locks, nil
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// fileStore keeps one JSON file per service in dir.
+type fileStore struct {
+	dir string
+}
+
+func (s fileStore) path(service string) string {
+	return filepath.Join(s.dir, service+".json")
+}
+
+func (s fileStore) get(service string) (*Lock, error) {
+	data, err := os.ReadFile(s.path(service))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading lock: %w", err)
+	}
+	var l Lock
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("parsing lock %s: %w", s.path(service), err)
+	}
+	return &l, nil
+}
+
+func (s fileStore) create(l Lock) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("creating lock dir: %w", err)
+	}
+	data, _ := json.Marshal(l)
+	f, err := os.OpenFile(s.path(l.Service), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return errExists
+	}
+	if err != nil {
+		return fmt.Errorf("creating lock: %w", err)
+	}
+	_, werr := f.Write(data)
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	return werr
+}
+
+func (s fileStore) replace(l Lock) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("creating lock dir: %w", err)
+	}
+	data, _ := json.Marshal(l)
+	tmp := s.path(l.Service) + ".tmp-" + l.ID
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing lock: %w", err)
+	}
+	return os.Rename(tmp, s.path(l.Service))
+}
+
+func (s fileStore) remove(service string) error {
+	err := os.Remove(s.path(service))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s fileStore) list() ([]Lock, error) {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	var locks []Lock
+	for _, m := range matches {
+		l, err := s.get(strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			locks = append(locks, *l)
+		}
+	}
+	return locks, nil
+}
+
+// ssmStore keeps one SSM parameter per service under prefix. PutParameter
+// without Overwrite fails if the parameter exists, which makes create atomic.
+type ssmStore struct {
+	client *ssm.Client
+	prefix string
+}
+
+func (s ssmStore) name(service string) string {
+	return s.prefix + "/" + service
+}
+
+func (s ssmStore) get(service string) (*Lock, error) {
+	out, err := s.client.GetParameter(context.Background(), &ssm.GetParameterInput{
+		Name: aws.String(s.name(service)),
+	})
+	var notFound *ssmtypes.ParameterNotFound
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading lock: %w", err)
+	}
+	var l Lock
+	if err := json.Unmarshal([]byte(aws.ToString(out.Parameter.Value)), &l); err != nil {
+		return nil, fmt.Errorf("parsing lock %s: %w", s.name(service), err)
+	}
+	return &l, nil
+}
+
+func (s ssmStore) put(l Lock, overwrite bool) error {
+	data, _ := json.Marshal(l)
+	_, err := s.client.PutParameter(context.Background(), &ssm.PutParameterInput{
+		Name:      aws.String(s.name(l.Service)),
+		Type:      ssmtypes.ParameterTypeString,
+		Value:     aws.String(string(data)),
+		Overwrite: aws.Bool(overwrite),
+	})
+	var exists *ssmtypes.ParameterAlreadyExists
+	if errors.As(err, &exists) {
+		return errExists
+	}
+	if err != nil {
+		return fmt.Errorf("writing lock: %w", err)
+	}
+	return nil
+}
+
+func (s ssmStore) create(l Lock) error  { return s.put(l, false) }
+func (s ssmStore) replace(l Lock) error { return s.put(l, true) }
+
+func (s ssmStore) remove(service string) error {
+	_, err := s.client.DeleteParameter(context.Background(), &ssm.DeleteParameterInput{
+		Name: aws.String(s.name(service)),
+	})
+	var notFound *ssmtypes.ParameterNotFound
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("removing lock: %w", err)
+	}
+	return nil
+}
+
+func (s ssmStore) list() ([]Lock, error) {
+	var locks []Lock
+	paginator := ssm.NewGetParametersByPathPaginator(s.client, &ssm.GetParametersByPathInput{
+		Path: aws.String(s.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("listing locks: %w", err)
+		}
+		for _, p := range page.Parameters {
+			var l Lock
+			if json.Unmarshal([]byte(aws.ToString(p.Value)), &l) == nil {
+				locks = append(locks, l)
+			}
+		}
+	}
+	return locks, nil
+}
@@ -0,0 +1,243 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testLocker returns a Locker over a fresh directory, acting as actor.
+func testLocker(t *testing.T, actor string) *Locker {
+	t.Helper()
+	t.Setenv("DWTOOL_ACTOR", actor)
+	return &Locker{store: fileStore{dir: t.TempDir()}, ttl: time.Hour}
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	lk := testLocker(t, "alice")
+
+	l, err := lk.Acquire("web-stable", "deploy abc", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Owner != "alice" || l.Reason != "deploy abc" || l.ID == "" || !l.Expires.After(time.Now()) {
+		t.Errorf("acquired %+v", l)
+	}
+	cur, err := lk.Get("web-stable")
+	if err != nil || cur == nil || cur.ID != l.ID {
+		t.Fatalf("Get = %+v, %v; want the lock just acquired", cur, err)
+	}
+
+	if err := lk.Release(l); err != nil {
+		t.Fatal(err)
+	}
+	if cur, err := lk.Get("web-stable"); err != nil || cur != nil {
+		t.Errorf("after Release, Get = %+v, %v", cur, err)
+	}
+	// Releasing again is harmless.
+	if err := lk.Release(l); err != nil {
+		t.Errorf("second Release: %v", err)
+	}
+}
+
+func TestAcquireConflict(t *testing.T) {
+	lk := testLocker(t, "alice")
+	held, err := lk.Acquire("web-stable", "deploy abc", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DWTOOL_ACTOR", "bob")
+	_, err = lk.Acquire("web-stable", "deploy def", time.Hour)
+	var heldErr *HeldError
+	if !errors.As(err, &heldErr) {
+		t.Fatalf("Acquire by another actor = %v, want *HeldError", err)
+	}
+	if heldErr.Lock.ID != held.ID || heldErr.Lock.Owner != "alice" {
+		t.Errorf("HeldError names %+v, want alice's lock", heldErr.Lock)
+	}
+
+	// Other services aren't affected.
+	if _, err := lk.Acquire("web-canary", "", time.Hour); err != nil {
+		t.Errorf("Acquire of another service: %v", err)
+	}
+
+	// The holder can take its own lock over, e.g. to re-run a failed deploy.
+	t.Setenv("DWTOOL_ACTOR", "alice")
+	again, err := lk.Acquire("web-stable", "retry", time.Hour)
+	if err != nil {
+		t.Fatalf("re-Acquire by the holder: %v", err)
+	}
+	if again.ID == held.ID {
+		t.Error("a takeover kept the old lock ID")
+	}
+}
+
+func TestAcquireExpired(t *testing.T) {
+	lk := testLocker(t, "alice")
+	stale, err := lk.Acquire("web-stable", "", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stale.Expired() {
+		t.Fatal("a lock with a past expiry isn't Expired")
+	}
+
+	t.Setenv("DWTOOL_ACTOR", "bob")
+	l, err := lk.Acquire("web-stable", "", time.Hour)
+	if err != nil {
+		t.Fatalf("Acquire over an expired lock: %v", err)
+	}
+	if l.Owner != "bob" {
+		t.Errorf("owner = %q, want bob", l.Owner)
+	}
+
+	// The old holder's release must not remove bob's lock.
+	if err := lk.Release(stale); err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := lk.Get("web-stable"); cur == nil || cur.ID != l.ID {
+		t.Errorf("a stale Release removed the current lock: %+v", cur)
+	}
+	if _, err := lk.Extend(stale, time.Hour); err == nil {
+		t.Error("Extend of a lock that's been taken over succeeded")
+	}
+}
+
+func TestExtendAndForceRelease(t *testing.T) {
+	lk := testLocker(t, "alice")
+	l, err := lk.Acquire("worker-search-service", "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extended, err := lk.Extend(l, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !extended.Expires.After(l.Expires) {
+		t.Errorf("Extend moved expiry from %s to %s", l.Expires, extended.Expires)
+	}
+	if cur, _ := lk.Get(l.Service); cur == nil || !cur.Expires.Equal(extended.Expires) {
+		t.Errorf("stored lock = %+v, want the extended expiry", cur)
+	}
+
+	if err := lk.ForceRelease(l.Service); err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := lk.Get(l.Service); cur != nil {
+		t.Errorf("after ForceRelease, Get = %+v", cur)
+	}
+	if err := lk.ForceRelease(l.Service); err != nil {
+		t.Errorf("ForceRelease of an unlocked service: %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	lk := testLocker(t, "alice")
+	for _, svc := range []string{"web-stable", "proxy", "web-canary"} {
+		if _, err := lk.Acquire(svc, "", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	locks, err := lk.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range locks {
+		got = append(got, l.Service)
+	}
+	if len(got) != 3 || got[0] != "proxy" || got[1] != "web-canary" || got[2] != "web-stable" {
+		t.Errorf("List = %v, want proxy, web-canary, web-stable", got)
+	}
+}
+
+func TestFileStoreCreateIsExclusive(t *testing.T) {
+	s := fileStore{dir: filepath.Join(t.TempDir(), "locks")}
+	l := Lock{Service: "web-stable", ID: "one", Expires: time.Now().Add(time.Hour)}
+	if err := s.create(l); err != nil {
+		t.Fatal(err)
+	}
+	l.ID = "two"
+	if err := s.create(l); !errors.Is(err, errExists) {
+		t.Errorf("second create = %v, want errExists", err)
+	}
+	if cur, _ := s.get("web-stable"); cur == nil || cur.ID != "one" {
+		t.Errorf("get = %+v, want the first lock", cur)
+	}
+}
+
+// withFreezeConfig points the config file at one holding windows for the
+// rest of the test.
+func withFreezeConfig(t *testing.T, freeze string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if freeze == "" {
+		return
+	}
+	dir := filepath.Join(home, ".config", "dwtool")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"freeze": `+freeze+`}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckFreeze(t *testing.T) {
+	now := time.Now().UTC()
+	start, end := now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339)
+	withFreezeConfig(t, `[{"name": "release", "reason": "big launch", "services": ["web-stable"], "start": "`+start+`", "end": "`+end+`"}]`)
+
+	err := CheckFreeze([]string{"web-canary-service", "web-stable-service"})
+	var freezeErr *FreezeError
+	if !errors.As(err, &freezeErr) {
+		t.Fatalf("CheckFreeze = %v, want *FreezeError", err)
+	}
+	if freezeErr.Service != "web-stable-service" || freezeErr.Window.Name != "release" {
+		t.Errorf("FreezeError = %+v", freezeErr)
+	}
+	if !freezeErr.Until.Equal(now.Add(time.Hour).Truncate(time.Second)) {
+		t.Errorf("Until = %s, want %s", freezeErr.Until, end)
+	}
+
+	if err := CheckFreeze([]string{"web-canary-service"}); err != nil {
+		t.Errorf("CheckFreeze of an uncovered service = %v", err)
+	}
+}
+
+func TestCheckFreezeWeekly(t *testing.T) {
+	now := time.Now().UTC()
+	window := func(from, to time.Time) string {
+		return `[{"name": "weekly", "days": ["sun", "mon", "tue", "wed", "thu", "fri", "sat"], "from": "` +
+			from.Format("15:04") + `", "to": "` + to.Format("15:04") + `"}]`
+	}
+
+	withFreezeConfig(t, window(now.Add(-time.Minute), now.Add(2*time.Minute)))
+	var freezeErr *FreezeError
+	if err := CheckFreeze([]string{"proxy-service"}); !errors.As(err, &freezeErr) {
+		t.Errorf("CheckFreeze inside a weekly window = %v, want *FreezeError", err)
+	}
+
+	withFreezeConfig(t, window(now.Add(2*time.Hour), now.Add(3*time.Hour)))
+	if err := CheckFreeze([]string{"proxy-service"}); err != nil {
+		t.Errorf("CheckFreeze outside a weekly window = %v", err)
+	}
+}
+
+func TestCheckFreezeConfig(t *testing.T) {
+	withFreezeConfig(t, "")
+	if err := CheckFreeze([]string{"web-stable-service"}); err != nil {
+		t.Errorf("CheckFreeze with no config file = %v", err)
+	}
+
+	withFreezeConfig(t, `[{"name": "bad", "days": ["someday"], "from": "09:00", "to": "17:00"}]`)
+	err := CheckFreeze([]string{"web-stable-service"})
+	var freezeErr *FreezeError
+	if err == nil || errors.As(err, &freezeErr) {
+		t.Errorf("CheckFreeze with an invalid window = %v, want a config error", err)
+	}
+}
@@ -30,8 +30,11 @@ type Service struct {
 	Workflow     string // GitHub Actions workflow filename (primary)
 	WorkflowSvc  string // the "service" input value for the workflow
 	ImageBase    string // GHCR image base (e.g., ghcr.io/dreamwidth/web22)
+	LogGroup     string // CloudWatch log group, from the service catalog
+	TargetGroup  string // ALB target group taking its traffic (web services)
 	DeployTargets []DeployTarget // all available deploy sources (len > 1 means choice)
 	Deployments   []Deployment  // active deployments (PRIMARY + any in-progress)
+	Events        []ServiceEvent // recent ECS service events, newest first
 }
 
 // Deployment represents an ECS deployment (part of a service's rollout history).
@@ -45,6 +48,13 @@ type Deployment struct {
 	TaskDef      string // short task definition identifier (family:revision)
 }
 
+// ServiceEvent is one entry from an ECS service's event log ("has reached a
+// steady state", "was unable to place a task", ...).
+type ServiceEvent struct {
+	CreatedAt time.Time
+	Message   string
+}
+
 // Task represents a running ECS task.
 type Task struct {
 	ID            string
@@ -53,6 +63,20 @@ type Task struct {
 	ContainerName string
 	PrivateIP     string
 	ServiceName   string
+	Health        string // HEALTHY, UNHEALTHY, or UNKNOWN (no health check)
+	StoppedAt     time.Time
+	StopCode      string // e.g. EssentialContainerExited, TaskFailedToStart
+	StoppedReason string
+	Containers    []ContainerState
+}
+
+// ContainerState is one container of a task, as ECS last saw it.
+type ContainerState struct {
+	Name     string
+	Status   string
+	Health   string
+	ExitCode *int   // nil while running, or if it never started
+	Reason   string // e.g. "OutOfMemoryError: Container killed due to memory usage"
 }
 
 // Image represents a container image version from GHCR.
@@ -61,6 +85,77 @@ type Image struct {
 	Tags      []string
 	CreatedAt time.Time
 	CommitMsg string // first line of git commit message, if resolvable from tags
+	VersionID int    // GHCR package version ID, used to delete it
+}
+
+// Commit is one commit in a ReleaseDiff.
+type Commit struct {
+	SHA     string
+	Author  string // GitHub login when known, else the git author name
+	Subject string // for PR merge commits, the PR title rather than "Merge pull request ..."
+	PR      int    // 0 if the commit doesn't reference a PR
+}
+
+// FlaggedFile is a changed file that needs attention before deploying.
+type FlaggedFile struct {
+	Path string
+	Kind string // "schema" (update-db*.pl) or "upgrading" (anything else under bin/upgrading)
+}
+
+// ReleaseDiff is what changes between a running image and a candidate.
+type ReleaseDiff struct {
+	Base      string // git SHA of the running image
+	Head      string // git SHA of the candidate image
+	Source    string // "git" (local checkout) or "github" (compare API)
+	Rollback  bool   // the candidate is behind the running image; Commits are being removed
+	Commits   []Commit
+	Truncated bool // more commits exist than were fetched
+	Flagged   []FlaggedFile
+}
+
+// Provenance is where an image was built, from its signed build provenance
+// attestation, or from its OCI config labels (shown, but not trusted) when
+// it has none.
+type Provenance struct {
+	Source   string   // source repository, e.g. https://github.com/dreamwidth/dreamwidth
+	Revision string   // git commit SHA the image was built from
+	Ref      string   // git ref the build ran on (e.g. refs/heads/main), when attested
+	Builder  string   // the workflow that signed the attestation, e.g. https://github.com/o/r/.github/workflows/web22-build.yml@refs/heads/main
+	Attested bool     // a signed build provenance attestation was verified
+	Branch   string   // the default branch, if Revision is on it
+	Problems []string // reasons not to deploy it; empty if verified
+}
+
+// Verified reports whether the image passed every provenance check.
+func (p Provenance) Verified() bool { return len(p.Problems) == 0 }
+
+// ImageRevision is one task definition revision and the image it pins.
+type ImageRevision struct {
+	TaskDef      string // family:revision
+	ImageBase    string // e.g. ghcr.io/dreamwidth/web22
+	Digest       string // full "sha256:..." digest; empty if the image is referenced by tag
+	RegisteredAt time.Time
+}
+
+// WorkflowJob is one job of a GitHub Actions workflow run.
+type WorkflowJob struct {
+	ID          int
+	Name        string
+	Status      string // "queued", "in_progress", "completed"
+	Conclusion  string // "success", "failure", "cancelled", "skipped", ...
+	StartedAt   time.Time
+	CompletedAt time.Time
+	Steps       []WorkflowStep
+}
+
+// WorkflowStep is one step of a WorkflowJob.
+type WorkflowStep struct {
+	Number      int
+	Name        string
+	Status      string
+	Conclusion  string
+	StartedAt   time.Time
+	CompletedAt time.Time
 }
 
 // TrafficRule represents an ALB listener rule with weighted target groups.
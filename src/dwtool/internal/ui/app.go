@@ -2,6 +2,7 @@ package ui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -12,9 +13,11 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
+	"dreamwidth.org/dwtool/internal/audit"
 	dwaws "dreamwidth.org/dwtool/internal/aws"
 	"dreamwidth.org/dwtool/internal/config"
 	"dreamwidth.org/dwtool/internal/github"
+	"dreamwidth.org/dwtool/internal/lock"
 	"dreamwidth.org/dwtool/internal/model"
 )
 
@@ -34,6 +37,7 @@ const (
 type App struct {
 	// Config
 	cfg     config.Config
+	catalog *config.Catalog
 	workers *config.WorkersConfig
 	client  *dwaws.Client
 
@@ -83,14 +87,16 @@ type servicesImagesMsg struct {
 
 // tasksMsg is sent when tasks for a service have been fetched.
 type tasksMsg struct {
-	tasks []model.Task
-	err   error
+	tasks   []model.Task
+	stopped []model.Task
+	err     error
 }
 
 // detailRefreshMsg is sent when both service description and tasks have been refreshed.
 type detailRefreshMsg struct {
 	service *model.Service // nil if describe failed
 	tasks   []model.Task
+	stopped []model.Task
 	err     error
 }
 
@@ -111,8 +117,29 @@ type imagesMsg struct {
 	err    error
 }
 
-// deployTriggeredMsg is sent after the workflow trigger completes.
-type deployTriggeredMsg struct{ err error }
+// releaseDiffMsg is sent with the commits between the running image and the
+// candidate (digest) on the confirm screen.
+type releaseDiffMsg struct {
+	digest string
+	diff   model.ReleaseDiff
+	err    error
+}
+
+// provenanceMsg is sent with where the candidate (digest) on the confirm
+// screen was built.
+type provenanceMsg struct {
+	digest     string
+	provenance model.Provenance
+	err        error
+}
+
+// deployTriggeredMsg is sent after the workflow trigger completes, with the
+// deploy locks taken for it.
+type deployTriggeredMsg struct {
+	dispatch github.Dispatch
+	locks    []lock.Lock
+	err      error
+}
 
 // workflowRunFoundMsg is sent when we find the triggered run's ID.
 type workflowRunFoundMsg struct {
@@ -120,10 +147,24 @@ type workflowRunFoundMsg struct {
 	err   error
 }
 
-// workflowPollMsg is sent with the latest run status.
+// workflowPollMsg is sent with the latest run status, its jobs and steps,
+// and once a run has failed, the tail of the failed step's log.
 type workflowPollMsg struct {
 	status     string
 	conclusion string
+	jobs       []model.WorkflowJob
+	failed     string // "job / step"
+	failLog    []string
+	err        error
+}
+
+// ecsPollMsg is sent with one check of the ECS rollout after a successful
+// workflow run. workerName is empty for a single-service deploy.
+type ecsPollMsg struct {
+	workerName string
+	status     dwaws.RolloutStatus
+	tasks      int   // tasks checked once the rollout COMPLETED
+	verifyErr  error // set if some task isn't on the deployed image
 	err        error
 }
 
@@ -133,9 +174,17 @@ type pollTickMsg struct{}
 // categoryTriggeredMsg is sent after a single worker's workflow trigger completes in a category deploy.
 type categoryTriggeredMsg struct {
 	workerName string
+	dispatch   github.Dispatch
+	locks      []lock.Lock
 	err        error
 }
 
+// waveStartMsg is sent when the wait before the next wave of a wave deploy
+// is over.
+type waveStartMsg struct {
+	wave int
+}
+
 // categoryRunFoundMsg is sent when a triggered worker's run ID is found.
 type categoryRunFoundMsg struct {
 	workerName string
@@ -148,9 +197,21 @@ type categoryPollMsg struct {
 	workerName string
 	status     string
 	conclusion string
+	jobs       []model.WorkflowJob
+	failed     string
+	failLog    []string
 	err        error
 }
 
+// rollbackResolvedMsg is sent when the previous image for a rollback has been found.
+type rollbackResolvedMsg struct {
+	target model.DeployTarget
+	image  model.Image
+	from   model.ImageRevision
+	to     model.ImageRevision
+	err    error
+}
+
 // logsMsg is sent when initial log events have been fetched.
 type logsMsg struct {
 	events      []model.LogEvent
@@ -176,7 +237,8 @@ type trafficRuleFetchedMsg struct {
 
 // trafficRuleUpdatedMsg is sent when traffic weights have been applied.
 type trafficRuleUpdatedMsg struct {
-	err error
+	err      error
+	auditErr error // writing the audit log entry failed
 }
 
 // sqsFetchedMsg is sent when SQS queue data has been fetched.
@@ -185,21 +247,25 @@ type sqsFetchedMsg struct {
 	err    error
 }
 
+// auditRecordedMsg is sent after an audit log entry has been written.
+type auditRecordedMsg struct{ err error }
+
 // refreshTickMsg triggers a periodic dashboard refresh.
 type refreshTickMsg struct{}
 
 // NewApp creates a new App model.
-func NewApp(cfg config.Config, workers *config.WorkersConfig, client *dwaws.Client) App {
+func NewApp(cfg config.Config, catalog *config.Catalog, workers *config.WorkersConfig, client *dwaws.Client) App {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(colorCyan)
 
 	// Build skeleton services from config so the UI populates immediately
-	skeleton := skeletonServices(workers)
-	rows := buildRows(skeleton, workers)
+	skeleton := skeletonServices(catalog, workers)
+	rows := buildRows(catalog, skeleton, workers)
 
 	a := App{
 		cfg:      cfg,
+		catalog:  catalog,
 		workers:  workers,
 		client:   client,
 		spinner:  s,
@@ -213,40 +279,27 @@ func NewApp(cfg config.Config, workers *config.WorkersConfig, client *dwaws.Clie
 	return a
 }
 
-// skeletonServices builds placeholder services from config so the dashboard
-// can render immediately while real data loads from AWS.
-func skeletonServices(workers *config.WorkersConfig) []model.Service {
+// skeletonServices builds placeholder services from the service catalog and
+// workers.json so the dashboard can render immediately while real data loads
+// from AWS.
+func skeletonServices(catalog *config.Catalog, workers *config.WorkersConfig) []model.Service {
 	var services []model.Service
 
-	// Web services
-	for _, ws := range config.WebServices() {
-		name := ws.Name + "-service"
-		services = append(services, model.Service{
-			Name:      name,
-			Group:     "web",
-			Workflow:  ws.Workflow,
-			WorkflowSvc: ws.WorkflowSvc,
-			ImageBase: ws.ImageBase,
-		})
+	// Web services and proxy
+	for _, group := range []string{"web", "proxy"} {
+		for _, name := range catalog.Named(group) {
+			svc := model.Service{Name: name + "-service"}
+			dwaws.ClassifyService(&svc)
+			services = append(services, svc)
+		}
 	}
 
-	// Proxy
-	services = append(services, model.Service{
-		Name:  "proxy-service",
-		Group: "proxy",
-	})
-
 	// Workers from workers.json
 	if workers != nil {
 		for name := range workers.Workers {
-			svcName := "worker-" + name + "-service"
-			services = append(services, model.Service{
-				Name:      svcName,
-				Group:     "worker",
-				Workflow:  config.WorkflowWorker,
-				WorkflowSvc: name,
-				ImageBase: config.ImageBaseWorker,
-			})
+			svc := model.Service{Name: catalog.WorkerService(name)}
+			dwaws.ClassifyService(&svc)
+			services = append(services, svc)
 		}
 	}
 
@@ -350,6 +403,9 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return a, nil
 
 	case trafficRuleUpdatedMsg:
+		if msg.auditErr != nil {
+			a.message = fmt.Sprintf("Audit log: %v", msg.auditErr)
+		}
 		if a.view != viewTraffic {
 			return a, nil
 		}
@@ -358,6 +414,9 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			a.traffic.step = trafficEditing
 			return a, nil
 		}
+		if msg.auditErr != nil {
+			return a.exitTraffic(fmt.Sprintf("Traffic weights updated, but the audit log failed: %v", msg.auditErr))
+		}
 		return a.exitTraffic("Traffic weights updated")
 
 	case sqsFetchedMsg:
@@ -396,6 +455,7 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return a, nil
 		}
 		a.detail.tasks = msg.tasks
+		a.detail.stopped = msg.stopped
 		a.detail.taskCursor = 0
 		return a, nil
 
@@ -409,6 +469,7 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			a.detail.service = *msg.service
 		}
 		a.detail.tasks = msg.tasks
+		a.detail.stopped = msg.stopped
 		if a.detail.taskCursor >= len(a.detail.tasks) {
 			a.detail.taskCursor = max(0, len(a.detail.tasks)-1)
 		}
@@ -498,11 +559,61 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		a.deploy.imageCursor = 0
 		return a, nil
 
+	case auditRecordedMsg:
+		if msg.err != nil {
+			a.message = fmt.Sprintf("Audit log: %v", msg.err)
+		}
+		return a, nil
+
+	case rollbackResolvedMsg:
+		if a.view != viewDetail {
+			return a, nil
+		}
+		if msg.err != nil {
+			a.message = fmt.Sprintf("Rollback: %v", msg.err)
+			return a, nil
+		}
+		a.message = ""
+		a.view = viewDeploy
+		a.deploy = deployState{
+			service:      a.detail.service,
+			targets:      []model.DeployTarget{msg.target},
+			images:       []model.Image{msg.image},
+			step:         stepConfirm,
+			rollback:     true,
+			rollbackFrom: msg.from,
+			rollbackTo:   msg.to,
+			diffLoading:  true,
+		}
+		return a, a.fetchReleaseDiff(a.deploy.service, msg.target, msg.image, nil)
+
+	case releaseDiffMsg:
+		if a.view != viewDeploy || a.deploy.step != stepConfirm ||
+			a.deploy.images[a.deploy.imageCursor].Digest != msg.digest {
+			return a, nil
+		}
+		a.deploy.diffLoading = false
+		a.deploy.diff = &msg.diff
+		a.deploy.diffErr = msg.err
+		return a, nil
+
+	case provenanceMsg:
+		if a.view != viewDeploy || a.deploy.step != stepConfirm ||
+			a.deploy.images[a.deploy.imageCursor].Digest != msg.digest {
+			return a, nil
+		}
+		a.deploy.provenanceLoading = false
+		a.deploy.provenance = &msg.provenance
+		a.deploy.provenanceErr = msg.err
+		return a, nil
+
 	case deployTriggeredMsg:
 		if msg.err != nil {
 			a.deploy.err = msg.err
 			return a, nil
 		}
+		a.deploy.dispatch = msg.dispatch
+		a.deploy.locks = msg.locks
 		// Workflow triggered; wait 2s then look for the run
 		return a, tea.Tick(2*time.Second, func(t time.Time) tea.Msg {
 			return pollTickMsg{}
@@ -511,31 +622,44 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case workflowRunFoundMsg:
 		if msg.err != nil {
 			a.deploy.err = msg.err
-			return a, nil
+			return a, a.releaseLocks(a.deploy.locks)
 		}
 		if msg.runID == 0 {
+			if time.Since(a.deploy.dispatch.Since) > runFindTimeout {
+				a.deploy.err = errRunNotFound(a.deploy.dispatch)
+				return a, a.finishDeploy(a.deploy.audit, a.deploy.locks, "error", a.deploy.err.Error())
+			}
 			// Not found yet, retry after 3s
 			return a, tea.Tick(3*time.Second, func(t time.Time) tea.Msg {
 				return pollTickMsg{}
 			})
 		}
 		a.deploy.runID = msg.runID
+		a.deploy.audit.RunID = msg.runID
 		// Now poll for status
 		return a, a.pollRun(a.cfg.Repo, msg.runID)
 
 	case workflowPollMsg:
 		if msg.err != nil {
 			a.deploy.err = msg.err
-			return a, nil
+			return a, a.releaseLocks(a.deploy.locks)
 		}
 		a.deploy.runStatus = msg.status
 		a.deploy.conclusion = msg.conclusion
+		if msg.jobs != nil {
+			a.deploy.jobs = msg.jobs
+		}
+		a.deploy.failedStep = msg.failed
+		a.deploy.failLog = msg.failLog
 		if msg.status == "completed" {
 			// Set next hint for web deploy order
-			if !a.deploy.allWorkers {
-				a.deploy.nextHint = nextWebService(a.deploy.service.WorkflowSvc)
+			a.deploy.nextHint = nextWebService(a.catalog, a.deploy.service.WorkflowSvc)
+			// A green run only means ECS was told to deploy; follow the
+			// rollout and record the outcome once it lands.
+			if msg.conclusion == "success" {
+				return a, a.pollECS("", a.deploy.service.Name, a.deploy.images[a.deploy.imageCursor].Digest, a.deploy.dispatch.Since)
 			}
-			return a, nil
+			return a, a.finishDeploy(a.deploy.audit, a.deploy.locks, msg.conclusion, failedStepDetail(msg.failed))
 		}
 		// Still running, poll again after 5s
 		return a, tea.Tick(5*time.Second, func(t time.Time) tea.Msg {
@@ -552,13 +676,18 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					a.deploy.categoryRuns[i].err = msg.err
 				} else {
 					a.deploy.categoryRuns[i].triggered = true
+					a.deploy.categoryRuns[i].dispatch = msg.dispatch
+					a.deploy.categoryRuns[i].locks = msg.locks
 				}
 				break
 			}
 		}
-		// Check if all have been triggered (or errored), then start polling
+		// Check if the wave has all been triggered (or errored), then start polling
 		allTriggered := true
 		for _, cr := range a.deploy.categoryRuns {
+			if cr.wave != a.deploy.wave {
+				continue
+			}
 			if !cr.triggered && cr.err == nil {
 				allTriggered = false
 				break
@@ -571,16 +700,32 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return a, nil
 
+	case waveStartMsg:
+		if a.view != viewDeploy || a.deploy.step != stepProgress || a.deploy.wave != msg.wave-1 || a.deploy.waveStopped {
+			return a, nil
+		}
+		a.deploy.wave = msg.wave
+		a.deploy.nextWaveAt = time.Time{}
+		cmd := a.triggerWave()
+		return a, cmd
+
 	case categoryRunFoundMsg:
 		if a.view != viewDeploy || !a.deploy.categoryDeploy {
 			return a, nil
 		}
 		for i := range a.deploy.categoryRuns {
-			if a.deploy.categoryRuns[i].workerName == msg.workerName {
-				if msg.err != nil {
-					a.deploy.categoryRuns[i].err = msg.err
-				} else if msg.runID != 0 {
-					a.deploy.categoryRuns[i].runID = msg.runID
+			cr := &a.deploy.categoryRuns[i]
+			if cr.workerName == msg.workerName {
+				switch {
+				case msg.err != nil:
+					cr.err = msg.err
+					return a, a.releaseLocks(cr.locks)
+				case msg.runID != 0:
+					cr.runID = msg.runID
+					cr.audit.RunID = msg.runID
+				case time.Since(cr.dispatch.Since) > runFindTimeout:
+					cr.err = errRunNotFound(cr.dispatch)
+					return a, a.finishDeploy(cr.audit, cr.locks, "error", cr.err.Error())
 				}
 				break
 			}
@@ -595,9 +740,46 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if a.deploy.categoryRuns[i].workerName == msg.workerName {
 				if msg.err != nil {
 					a.deploy.categoryRuns[i].err = msg.err
+					return a, a.releaseLocks(a.deploy.categoryRuns[i].locks)
 				} else {
+					wasDone := a.deploy.categoryRuns[i].status == "completed"
 					a.deploy.categoryRuns[i].status = msg.status
 					a.deploy.categoryRuns[i].conclusion = msg.conclusion
+					if msg.jobs != nil {
+						a.deploy.categoryRuns[i].step = currentStep(msg.jobs)
+					}
+					a.deploy.categoryRuns[i].failedStep = msg.failed
+					a.deploy.categoryRuns[i].failLog = msg.failLog
+					// Successful runs are recorded once their ECS rollout lands.
+					if msg.status == "completed" && !wasDone && msg.conclusion != "success" {
+						cr := a.deploy.categoryRuns[i]
+						return a, a.finishDeploy(cr.audit, cr.locks, msg.conclusion, failedStepDetail(msg.failed))
+					}
+				}
+				break
+			}
+		}
+		return a, nil
+
+	case ecsPollMsg:
+		if a.view != viewDeploy || a.deploy.step != stepProgress {
+			return a, nil
+		}
+		if msg.workerName == "" {
+			if !a.deploy.ecs.update(msg, a.deploy.dispatch.Since) {
+				return a, tea.Tick(10*time.Second, func(t time.Time) tea.Msg {
+					return pollTickMsg{}
+				})
+			}
+			conclusion, detail := a.deploy.ecs.outcome()
+			return a, a.finishDeploy(a.deploy.audit, a.deploy.locks, conclusion, detail)
+		}
+		for i := range a.deploy.categoryRuns {
+			cr := &a.deploy.categoryRuns[i]
+			if cr.workerName == msg.workerName {
+				if !cr.ecs.finished() && cr.ecs.update(msg, cr.dispatch.Since) {
+					conclusion, detail := cr.ecs.outcome()
+					return a, a.finishDeploy(cr.audit, cr.locks, conclusion, detail)
 				}
 				break
 			}
@@ -613,16 +795,18 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if a.deploy.categoryDeploy {
 			var cmds []tea.Cmd
 			anyPending := false
-			target := a.deploy.selectedTarget()
+			img := a.deploy.images[a.deploy.imageCursor]
 			for _, cr := range a.deploy.categoryRuns {
-				if cr.err != nil || cr.status == "completed" {
+				if cr.finished() || cr.wave > a.deploy.wave {
 					continue
 				}
 				anyPending = true
 				if cr.runID == 0 {
 					// Still looking for the run
-					workerName := cr.workerName
-					cmds = append(cmds, a.findCategoryRun(a.cfg.Repo, target.Workflow, workerName, a.deploy.triggered))
+					cmds = append(cmds, a.findCategoryRun(a.cfg.Repo, cr.workerName, cr.dispatch))
+				} else if cr.status == "completed" {
+					// Run succeeded; follow the ECS rollout
+					cmds = append(cmds, a.pollECS(cr.workerName, a.catalog.WorkerService(cr.workerName), img.Digest, cr.dispatch.Since))
 				} else {
 					// Poll the known run
 					workerName := cr.workerName
@@ -639,14 +823,23 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if len(cmds) > 0 {
 				return a, tea.Batch(cmds...)
 			}
+			if len(a.deploy.waves) > 0 {
+				cmd := a.nextWave()
+				return a, cmd
+			}
 			return a, nil
 		}
 
 		// Single deploy: existing logic
-		target := a.deploy.selectedTarget()
 		if a.deploy.runID == 0 {
 			// Still looking for the run
-			return a, a.findRun(a.cfg.Repo, target.Workflow, a.deploy.triggered)
+			return a, a.findRun(a.cfg.Repo, a.deploy.dispatch)
+		}
+		if a.deploy.runStatus == "completed" {
+			if a.deploy.finished() {
+				return a, nil
+			}
+			return a, a.pollECS("", a.deploy.service.Name, a.deploy.images[a.deploy.imageCursor].Digest, a.deploy.dispatch.Since)
 		}
 		// Poll the known run
 		return a, a.pollRun(a.cfg.Repo, a.deploy.runID)
@@ -860,21 +1053,10 @@ func (a App) handleDashboardKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			a.message = fmt.Sprintf("No deploy workflow for %s", svc.Name)
 			return a, nil
 		}
-		return a.startDeploy(*svc, false)
+		return a.startDeploy(*svc)
 
 	case key.Matches(msg, keys.DeployAll):
-		// Deploy all workers — offer worker and worker22 targets
-		allSvc := model.Service{
-			Name:        "ALL WORKERS",
-			Workflow:    config.WorkflowWorker,
-			WorkflowSvc: "ALL WORKERS (*)",
-			ImageBase:   config.ImageBaseWorker,
-			DeployTargets: []model.DeployTarget{
-				{Label: "worker", Workflow: config.WorkflowWorker, WorkflowSvc: "ALL WORKERS (*)", ImageBase: config.ImageBaseWorker},
-				{Label: "worker22", Workflow: config.WorkflowWorker22, WorkflowSvc: "ALL WORKERS (*)", ImageBase: config.ImageBaseWorker22},
-			},
-		}
-		return a.startDeploy(allSvc, true)
+		return a.startWaveDeploy()
 
 	case key.Matches(msg, keys.DeployCategory):
 		svc := a.selectedService()
@@ -904,8 +1086,8 @@ func (a App) handleDashboardKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if svc == nil {
 			return a, nil
 		}
-		if svc.Group != "web" {
-			a.message = "Traffic weights only available for web services"
+		if svc.TargetGroup == "" {
+			a.message = "Traffic weights only available for services with an ALB target group"
 			return a, nil
 		}
 		serviceKey := strings.TrimSuffix(svc.Name, "-service")
@@ -915,7 +1097,7 @@ func (a App) handleDashboardKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			loading:  true,
 		}
 		a.view = viewTraffic
-		return a, a.fetchTrafficRule(serviceKey)
+		return a, a.fetchTrafficRule(serviceKey, svc.TargetGroup)
 
 	case key.Matches(msg, keys.Filter):
 		a.filterActive = true
@@ -961,7 +1143,7 @@ func (a App) handleFilterKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 // applyFilter rebuilds the dashboard rows using the current filter.
 func (a *App) applyFilter() {
 	filtered := filterServices(a.services, a.filter)
-	a.rows = buildRows(filtered, a.workers)
+	a.rows = buildRows(a.catalog, filtered, a.workers)
 	// Reset cursor to first service
 	a.cursor = 0
 	a.advanceCursorToService(1)
@@ -1146,15 +1328,24 @@ func (a App) handleDetailKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			a.message = fmt.Sprintf("No deploy workflow for %s", svc.Name)
 			return a, nil
 		}
-		return a.startDeploy(svc, false)
+		return a.startDeploy(svc)
+
+	case key.Matches(msg, keys.Rollback):
+		svc := a.detail.service
+		if svc.Workflow == "" {
+			a.message = fmt.Sprintf("No deploy workflow for %s", svc.Name)
+			return a, nil
+		}
+		a.message = "Finding previous image..."
+		return a, a.resolveRollback(svc)
 
 	case key.Matches(msg, keys.Logs):
 		return a.openLogs(a.detail.service)
 
 	case key.Matches(msg, keys.Traffic):
 		svc := a.detail.service
-		if svc.Group != "web" {
-			a.message = "Traffic weights only available for web services"
+		if svc.TargetGroup == "" {
+			a.message = "Traffic weights only available for services with an ALB target group"
 			return a, nil
 		}
 		serviceKey := strings.TrimSuffix(svc.Name, "-service")
@@ -1164,7 +1355,7 @@ func (a App) handleDetailKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			loading:  true,
 		}
 		a.view = viewTraffic
-		return a, a.fetchTrafficRule(serviceKey)
+		return a, a.fetchTrafficRule(serviceKey, svc.TargetGroup)
 
 	case key.Matches(msg, keys.Refresh):
 		a.detail.loading = true
@@ -1179,7 +1370,7 @@ func (a App) handleDetailKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (a App) openLogs(svc model.Service) (tea.Model, tea.Cmd) {
-	logGroup := dwaws.LogGroupForService(svc)
+	logGroup := svc.LogGroup
 	if logGroup == "" {
 		a.message = fmt.Sprintf("No log group for %s", svc.Name)
 		return a, nil
@@ -1419,7 +1610,9 @@ func (a App) handleDeployKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 						break
 					}
 				}
-				if !allDone {
+				if !allDone && len(a.deploy.waves) > 0 {
+					a.message = "Running deploys continue on GitHub; later waves cancelled"
+				} else if !allDone {
 					a.message = "Deploys continue on GitHub"
 				}
 			} else if a.deploy.runStatus != "completed" {
@@ -1428,7 +1621,7 @@ func (a App) handleDeployKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			a.view = viewDashboard
 			// Refresh services to pick up new deployment status
 			a.loading = true
-			return a, tea.Batch(a.spinner.Tick, a.fetchServiceDescriptions())
+			return a, tea.Batch(a.spinner.Tick, a.fetchServiceDescriptions(), a.abandonLocks())
 		}
 		return a, nil
 	}
@@ -1497,53 +1690,127 @@ func (a App) handleImageSelectKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return a, nil
 		}
 		a.deploy.step = stepConfirm
-		return a, nil
+		a.deploy.diff, a.deploy.diffErr = nil, nil
+		a.deploy.provenance, a.deploy.provenanceErr = nil, nil
+		a.deploy.overriding, a.deploy.overrideReason, a.deploy.override = false, "", ""
+		a.deploy.provenanceLoading = true
+		img := a.deploy.images[a.deploy.imageCursor]
+		checkProvenance := a.fetchProvenance(a.deploy.selectedTarget().ImageBase, img.Digest)
+		if a.deploy.categoryDeploy {
+			// Each worker may be running something different.
+			return a, checkProvenance
+		}
+		a.deploy.diffLoading = true
+		return a, tea.Batch(checkProvenance, a.fetchReleaseDiff(a.deploy.service, a.deploy.selectedTarget(), img, a.deploy.images))
 	}
 
 	return a, nil
 }
 
 func (a App) handleConfirmKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if a.deploy.overriding {
+		return a.handleOverrideKey(msg)
+	}
+
 	// Only Shift+Y confirms
 	if msg.String() == "Y" {
-		a.deploy.step = stepProgress
-		a.deploy.triggered = time.Now()
-
-		target := a.deploy.selectedTarget()
-		img := a.deploy.images[a.deploy.imageCursor]
-
-		// Category deploy: trigger one workflow per worker
-		if a.deploy.categoryDeploy {
-			var cmds []tea.Cmd
-			for _, cr := range a.deploy.categoryRuns {
-				workerName := cr.workerName
-				cmds = append(cmds, a.triggerCategoryDeploy(a.cfg.Repo, target.Workflow, workerName, img.Digest))
+		// A rollback restores an image that has already run in production.
+		if !a.deploy.rollback {
+			if a.deploy.provenanceLoading {
+				return a, nil
+			}
+			if len(a.deploy.provenanceProblems()) > 0 {
+				a.deploy.overriding = true
+				a.deploy.overrideReason = ""
+				return a, nil
 			}
-			return a, tea.Batch(cmds...)
-		}
-
-		// Single/all-workers deploy
-		inputs := map[string]string{
-			"service": target.WorkflowSvc,
-			"tag":     img.Digest, // already has "sha256:" prefix
 		}
-
-		return a, a.triggerDeploy(a.cfg.Repo, target.Workflow, inputs)
+		return a.confirmDeploy()
 	}
 
 	// Any other key cancels
+	if a.deploy.rollback {
+		a.view = viewDetail
+		a.message = "Rollback cancelled"
+		return a, nil
+	}
 	a.deploy.step = stepSelectImage
 	a.message = "Deploy cancelled"
 	return a, nil
 }
 
+// handleOverrideKey reads the reason for deploying an image that failed its
+// provenance checks. Enter deploys it, recording the reason and the problems
+// in the audit log; Esc goes back to the confirm prompt.
+func (a App) handleOverrideKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		reason := strings.TrimSpace(a.deploy.overrideReason)
+		if reason == "" {
+			return a, nil
+		}
+		a.deploy.overriding = false
+		a.deploy.override = fmt.Sprintf("unverified image (%s) allowed: %s", strings.Join(a.deploy.provenanceProblems(), "; "), reason)
+		return a.confirmDeploy()
+	case tea.KeyEscape:
+		a.deploy.overriding = false
+		a.deploy.overrideReason = ""
+		return a, nil
+	case tea.KeyBackspace:
+		if r := []rune(a.deploy.overrideReason); len(r) > 0 {
+			a.deploy.overrideReason = string(r[:len(r)-1])
+		}
+		return a, nil
+	case tea.KeyRunes, tea.KeySpace:
+		a.deploy.overrideReason += string(msg.Runes)
+		return a, nil
+	}
+	return a, nil
+}
+
+// confirmDeploy starts the confirmed deploy.
+func (a App) confirmDeploy() (tea.Model, tea.Cmd) {
+	a.deploy.step = stepProgress
+	a.deploy.triggered = time.Now()
+
+	target := a.deploy.selectedTarget()
+	img := a.deploy.images[a.deploy.imageCursor]
+
+	// Category deploy: trigger one workflow per worker (in the first wave)
+	if a.deploy.categoryDeploy {
+		cmd := a.triggerWave()
+		return a, cmd
+	}
+
+	// Single deploy
+	inputs := map[string]string{
+		"service": target.WorkflowSvc,
+		"tag":     img.Digest, // already has "sha256:" prefix
+	}
+
+	action := "deploy"
+	if a.deploy.rollback {
+		action = "rollback"
+	}
+	a.deploy.audit = audit.New("tui", action, a.deploy.service.Name)
+	a.deploy.audit.Workflow = target.Workflow
+	a.deploy.audit.Digest = img.Digest
+	if a.deploy.rollback {
+		a.deploy.audit.Detail = "from " + a.deploy.rollbackFrom.TaskDef + " to " + a.deploy.rollbackTo.TaskDef
+	} else {
+		a.deploy.audit.Detail = a.deploy.override
+	}
+
+	reason := action + " " + digestPrefix(img.Digest)
+	return a, a.triggerDeploy(a.cfg.Repo, target.Workflow, target.ImageBase, inputs, []string{a.deploy.service.Name}, reason, a.deploy.audit)
+}
+
 // startDeploy initiates the deploy flow for a service.
-func (a App) startDeploy(svc model.Service, allWorkers bool) (tea.Model, tea.Cmd) {
+func (a App) startDeploy(svc model.Service) (tea.Model, tea.Cmd) {
 	a.view = viewDeploy
 	a.deploy = deployState{
-		service:    svc,
-		targets:    svc.DeployTargets,
-		allWorkers: allWorkers,
+		service: svc,
+		targets: svc.DeployTargets,
 	}
 	a.message = ""
 
@@ -1571,17 +1838,21 @@ func (a App) startCategoryDeploy(categoryName string, services []model.Service)
 		runs[i] = categoryRun{workerName: svc.WorkflowSvc}
 	}
 
-	// Build a synthetic service for the deploy flow, using worker targets
-	catSvc := model.Service{
-		Name:        fmt.Sprintf("WORKERS: %s", categoryName),
-		Workflow:    config.WorkflowWorker,
-		WorkflowSvc: fmt.Sprintf("WORKERS: %s", categoryName),
-		ImageBase:   config.ImageBaseWorker,
-		DeployTargets: []model.DeployTarget{
-			{Label: "worker", Workflow: config.WorkflowWorker, WorkflowSvc: fmt.Sprintf("WORKERS: %s", categoryName), ImageBase: config.ImageBaseWorker},
-			{Label: "worker22", Workflow: config.WorkflowWorker22, WorkflowSvc: fmt.Sprintf("WORKERS: %s", categoryName), ImageBase: config.ImageBaseWorker22},
-		},
+	// Build a synthetic service for the deploy flow, using the targets the
+	// service catalog gives the workers
+	workflowSvc := fmt.Sprintf("WORKERS: %s", categoryName)
+	catSvc := model.Service{Name: workflowSvc, WorkflowSvc: workflowSvc}
+	if len(services) > 0 {
+		for _, t := range services[0].DeployTargets {
+			t.WorkflowSvc = workflowSvc
+			catSvc.DeployTargets = append(catSvc.DeployTargets, t)
+		}
 	}
+	if len(catSvc.DeployTargets) == 0 {
+		a.message = "No deploy targets for these workers in the service catalog"
+		return a, nil
+	}
+	catSvc.Workflow, catSvc.ImageBase = catSvc.DeployTargets[0].Workflow, catSvc.DeployTargets[0].ImageBase
 
 	a.view = viewDeploy
 	a.deploy = deployState{
@@ -1598,6 +1869,39 @@ func (a App) startCategoryDeploy(categoryName string, services []model.Service)
 	return a, nil
 }
 
+// startWaveDeploy initiates the deploy flow for every worker, one category
+// at a time in waves of at most config.DefaultWaveSize, like
+// `dwtool deploy-workers`.
+func (a App) startWaveDeploy() (tea.Model, tea.Cmd) {
+	if a.workers == nil {
+		a.message = "No workers.json loaded"
+		return a, nil
+	}
+	waves, err := a.workers.DeployWaves("", config.DefaultWaveSize)
+	if err != nil || len(waves) == 0 {
+		a.message = "No workers to deploy"
+		return a, nil
+	}
+
+	var services []model.Service
+	for _, w := range waves {
+		for _, name := range w.Workers {
+			services = append(services, model.Service{WorkflowSvc: name})
+		}
+	}
+	m, cmd := a.startCategoryDeploy("ALL (in waves)", services)
+	a = m.(App)
+	a.deploy.waves = waves
+	i := 0
+	for n, w := range waves {
+		for range w.Workers {
+			a.deploy.categoryRuns[i].wave = n
+			i++
+		}
+	}
+	return a, cmd
+}
+
 func (a *App) moveCursorPage(direction int) {
 	pageSize := a.viewportHeight()
 	for i := 0; i < pageSize; i++ {
@@ -1677,7 +1981,7 @@ func (a *App) updateServices(services []model.Service) {
 		selectedName = a.rows[a.cursor].service.Name
 	}
 	a.services = services
-	a.rows = buildRows(filterServices(a.services, a.filter), a.workers)
+	a.rows = buildRows(a.catalog, filterServices(a.services, a.filter), a.workers)
 	restored := false
 	if selectedName != "" {
 		for i, row := range a.rows {
@@ -1741,7 +2045,12 @@ func (a App) fetchTasks(serviceName string) tea.Cmd {
 	return func() tea.Msg {
 		ctx := context.Background()
 		tasks, err := a.client.ListTasks(ctx, serviceName)
-		return tasksMsg{tasks: tasks, err: err}
+		if err != nil {
+			return tasksMsg{err: err}
+		}
+		// Stopped tasks are extra context; don't fail the view over them.
+		stopped, _ := a.client.ListStoppedTasks(ctx, serviceName, detailStoppedTasks)
+		return tasksMsg{tasks: tasks, stopped: stopped}
 	}
 }
 
@@ -1766,8 +2075,9 @@ func (a App) fetchDetailRefresh(serviceName string) tea.Cmd {
 		if err != nil {
 			return detailRefreshMsg{service: svc, err: fmt.Errorf("listing tasks: %w", err)}
 		}
+		stopped, _ := a.client.ListStoppedTasks(ctx, serviceName, detailStoppedTasks)
 
-		return detailRefreshMsg{service: svc, tasks: tasks}
+		return detailRefreshMsg{service: svc, tasks: tasks, stopped: stopped}
 	}
 }
 
@@ -1863,18 +2173,288 @@ func (a App) fetchImages(repo, imageBase string) tea.Cmd {
 	}
 }
 
-// triggerDeploy dispatches the GitHub Actions workflow.
-func (a App) triggerDeploy(repo, workflow string, inputs map[string]string) tea.Cmd {
+// fetchReleaseDiff lists the commits between the image svc is running and
+// candidate. The running image is looked up in known (the images already
+// listed for the target) first, then in the GHCR history of each of the
+// service's image sources.
+func (a App) fetchReleaseDiff(svc model.Service, target model.DeployTarget, candidate model.Image, known []model.Image) tea.Cmd {
+	repo := a.cfg.Repo
+	return func() tea.Msg {
+		msg := releaseDiffMsg{digest: candidate.Digest}
+		running, err := findRunningImage(repo, svc, target, known)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		base, head := github.CommitSHA(running), github.CommitSHA(candidate)
+		if base == "" || head == "" {
+			msg.err = fmt.Errorf("no git SHA tag on the running or candidate image")
+			return msg
+		}
+		msg.diff, msg.err = github.ReleaseDiff(repo, base, head)
+		return msg
+	}
+}
+
+// fetchProvenance checks where the image imageBase@digest was built.
+func (a App) fetchProvenance(imageBase, digest string) tea.Cmd {
+	repo := a.cfg.Repo
+	return func() tea.Msg {
+		p, err := github.ImageProvenance(repo, imageBase, digest)
+		return provenanceMsg{digest: digest, provenance: p, err: err}
+	}
+}
+
+// findRunningImage finds the GHCR image matching svc's running digest.
+func findRunningImage(repo string, svc model.Service, target model.DeployTarget, known []model.Image) (model.Image, error) {
+	if svc.ImageDigest == "" {
+		return model.Image{}, fmt.Errorf("can't tell which image %s is running", svc.Name)
+	}
+	match := func(images []model.Image) (model.Image, bool) {
+		for _, img := range images {
+			if strings.HasPrefix(strings.TrimPrefix(img.Digest, "sha256:"), svc.ImageDigest) {
+				return img, true
+			}
+		}
+		return model.Image{}, false
+	}
+	if img, ok := match(known); ok {
+		return img, nil
+	}
+	bases := []string{target.ImageBase}
+	for _, t := range svc.DeployTargets {
+		if t.ImageBase != target.ImageBase {
+			bases = append(bases, t.ImageBase)
+		}
+	}
+	for _, base := range bases {
+		images, err := github.FetchImages(repo, base, 100)
+		if err != nil {
+			return model.Image{}, err
+		}
+		if img, ok := match(images); ok {
+			return img, nil
+		}
+	}
+	return model.Image{}, fmt.Errorf("running image %s not found in GHCR", svc.ImageDigest)
+}
+
+// resolveRollback finds the image the service ran before its current one and
+// the GHCR image (with tags and commit) that matches it.
+func (a App) resolveRollback(svc model.Service) tea.Cmd {
+	repo := a.cfg.Repo
+	return func() tea.Msg {
+		ctx := context.Background()
+		from, to, err := a.client.PreviousImage(ctx, svc.Name)
+		if err != nil {
+			return rollbackResolvedMsg{err: err}
+		}
+
+		target := model.DeployTarget{Workflow: svc.Workflow, WorkflowSvc: svc.WorkflowSvc, ImageBase: svc.ImageBase}
+		for _, t := range svc.DeployTargets {
+			if t.ImageBase == to.ImageBase {
+				target = t
+				break
+			}
+		}
+
+		images, err := github.FetchImages(repo, target.ImageBase, 100)
+		if err != nil {
+			return rollbackResolvedMsg{err: err}
+		}
+		for _, img := range images {
+			if img.Digest == to.Digest {
+				found := []model.Image{img}
+				github.ResolveCommitMessages(found)
+				return rollbackResolvedMsg{target: target, image: found[0], from: from, to: to}
+			}
+		}
+		return rollbackResolvedMsg{err: fmt.Errorf("previous image %s (%s) not found in %s", to.Digest, to.TaskDef, target.ImageBase)}
+	}
+}
+
+// recordAudit appends an entry to the audit log in the background.
+func recordAudit(entry audit.Entry, conclusion, detail string) tea.Cmd {
+	return func() tea.Msg {
+		entry.Conclusion = conclusion
+		if detail != "" {
+			entry.Detail = detail
+		}
+		return auditRecordedMsg{err: audit.Record(entry)}
+	}
+}
+
+// abandonedLockHold is how long an unfinished deploy's locks outlive leaving
+// its progress view, long enough for the rollout to land.
+const abandonedLockHold = 15 * time.Minute
+
+// runFindTimeout is how long we look for a dispatched run before giving up.
+const runFindTimeout = 2 * time.Minute
+
+// ecsRolloutTimeout is how long we follow an ECS rollout after its workflow
+// run succeeds.
+const ecsRolloutTimeout = 30 * time.Minute
+
+// errRunNotFound reports a dispatch whose run never showed up.
+func errRunNotFound(d github.Dispatch) error {
+	if d.ID == "" {
+		return fmt.Errorf("no %s run appeared within %s; check GitHub Actions", d.Workflow, runFindTimeout)
+	}
+	return fmt.Errorf("could not find dispatched run %s of %s within %s; check GitHub Actions", d.ID, d.Workflow, runFindTimeout)
+}
+
+// auditTrigger records the outcome of dispatching a workflow.
+func auditTrigger(entry audit.Entry, d github.Dispatch, err error) {
+	switch {
+	case err != nil:
+		entry.Conclusion = "error"
+		entry.Detail = err.Error()
+	default:
+		entry.Conclusion = "triggered"
+		note := "dispatch " + d.ID
+		if d.ID == "" {
+			note = "uncorrelated dispatch"
+		}
+		if entry.Detail != "" {
+			note = entry.Detail + "; " + note
+		}
+		entry.Detail = note
+	}
+	// Best effort: a failed audit write surfaces when the run completes.
+	audit.Record(entry)
+}
+
+// triggerDeploy takes the deploy locks on services and dispatches the
+// GitHub Actions workflow.
+func (a App) triggerDeploy(repo, workflow, imageBase string, inputs map[string]string, services []string, reason string, entry audit.Entry) tea.Cmd {
+	region, override := a.cfg.Region, a.deploy.override
+	return func() tea.Msg {
+		// A rollback restores an image that has already run in production.
+		if entry.Action != "rollback" {
+			if err := verifyProvenance(repo, imageBase, entry.Digest, override); err != nil {
+				return deployTriggeredMsg{err: err}
+			}
+		}
+		locks, err := guardDeploy(region, services, reason)
+		if err != nil {
+			return deployTriggeredMsg{err: err}
+		}
+		d, err := github.DispatchWorkflow(repo, workflow, inputs)
+		auditTrigger(entry, d, err)
+		if err != nil {
+			releaseLocks(region, locks)
+			return deployTriggeredMsg{err: err}
+		}
+		return deployTriggeredMsg{dispatch: d, locks: locks}
+	}
+}
+
+// guardDeploy refuses a deploy to services during a freeze window and takes
+// their deploy locks, releasing any it took if one is held by someone else.
+// The TUI can't override a freeze; that takes the CLI's --force-freeze with
+// a reason.
+func guardDeploy(region string, services []string, reason string) ([]lock.Lock, error) {
+	if err := lock.CheckFreeze(services); err != nil {
+		var frozen *lock.FreezeError
+		if errors.As(err, &frozen) {
+			return nil, fmt.Errorf("%v (to override, deploy with the CLI's --force-freeze --reason)", err)
+		}
+		return nil, err
+	}
+	lk, err := lock.Open(region)
+	if err != nil {
+		return nil, err
+	}
+	var locks []lock.Lock
+	for _, svc := range services {
+		l, err := lk.Acquire(svc, reason, lk.TTL())
+		if err != nil {
+			releaseLocks(region, locks)
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return locks, nil
+}
+
+// verifyProvenance refuses an image that wasn't built by CI from a commit
+// on the default branch, or whose provenance can't be read, unless the
+// confirm screen's override was given (override is its audit note).
+func verifyProvenance(repo, imageBase, digest, override string) error {
+	if override != "" {
+		return nil
+	}
+	p, err := github.ImageProvenance(repo, imageBase, digest)
+	if err != nil {
+		return fmt.Errorf("can't verify image provenance: %v", err)
+	}
+	if !p.Verified() {
+		return fmt.Errorf("image failed provenance checks: %s", strings.Join(p.Problems, "; "))
+	}
+	return nil
+}
+
+// releaseLocks releases deploy locks, best effort: any left behind lapse
+// after the lock TTL.
+func releaseLocks(region string, locks []lock.Lock) {
+	if len(locks) == 0 {
+		return
+	}
+	lk, err := lock.Open(region)
+	if err != nil {
+		return
+	}
+	for _, l := range locks {
+		lk.Release(l)
+	}
+}
+
+// releaseLocks releases a finished deploy's locks in the background.
+func (a App) releaseLocks(locks []lock.Lock) tea.Cmd {
+	region := a.cfg.Region
+	return func() tea.Msg {
+		releaseLocks(region, locks)
+		return nil
+	}
+}
+
+// finishDeploy records a deploy's outcome and releases its locks.
+func (a App) finishDeploy(entry audit.Entry, locks []lock.Lock, conclusion, detail string) tea.Cmd {
+	return tea.Batch(recordAudit(entry, conclusion, detail), a.releaseLocks(locks))
+}
+
+// abandonLocks is for leaving the progress view: the TUI stops following
+// unfinished deploys, so their locks are left to lapse after
+// abandonedLockHold instead of holding for the full TTL.
+func (a App) abandonLocks() tea.Cmd {
+	var locks []lock.Lock
+	if a.deploy.categoryDeploy {
+		for _, cr := range a.deploy.categoryRuns {
+			if !cr.finished() {
+				locks = append(locks, cr.locks...)
+			}
+		}
+	} else if !a.deploy.finished() && a.deploy.err == nil {
+		locks = a.deploy.locks
+	}
+	if len(locks) == 0 {
+		return nil
+	}
+	region := a.cfg.Region
 	return func() tea.Msg {
-		err := github.TriggerWorkflow(repo, workflow, inputs)
-		return deployTriggeredMsg{err: err}
+		if lk, err := lock.Open(region); err == nil {
+			for _, l := range locks {
+				lk.Extend(l, abandonedLockHold)
+			}
+		}
+		return nil
 	}
 }
 
-// findRun looks for the workflow run that was triggered.
-func (a App) findRun(repo, workflow string, since time.Time) tea.Cmd {
+// findRun looks for the workflow run started by dispatch d.
+func (a App) findRun(repo string, d github.Dispatch) tea.Cmd {
 	return func() tea.Msg {
-		runID, err := github.FindWorkflowRun(repo, workflow, since)
+		runID, err := github.FindDispatchedRun(repo, d)
 		return workflowRunFoundMsg{runID: runID, err: err}
 	}
 }
@@ -1883,35 +2463,175 @@ func (a App) findRun(repo, workflow string, since time.Time) tea.Cmd {
 func (a App) pollRun(repo string, runID int) tea.Cmd {
 	return func() tea.Msg {
 		status, conclusion, err := github.GetWorkflowRun(repo, runID)
-		return workflowPollMsg{status: status, conclusion: conclusion, err: err}
+		if err != nil {
+			return workflowPollMsg{err: err}
+		}
+		msg := workflowPollMsg{status: status, conclusion: conclusion}
+		msg.jobs, msg.failed, msg.failLog = fetchRunSteps(repo, runID, status, conclusion, 15)
+		return msg
+	}
+}
+
+// fetchRunSteps fetches a run's jobs and, if it has failed, names the failed
+// step and fetches the last logLines of its log. Step detail is best effort:
+// errors leave the fields empty rather than failing the poll.
+func fetchRunSteps(repo string, runID int, status, conclusion string, logLines int) ([]model.WorkflowJob, string, []string) {
+	jobs, err := github.ListRunJobs(repo, runID)
+	if err != nil || status != "completed" || conclusion == "success" {
+		return jobs, "", nil
+	}
+	job, step, ok := github.FailedStep(jobs)
+	if !ok {
+		return jobs, "", nil
+	}
+	failed := job.Name + " / " + step.Name
+	lines, err := github.StepLogTail(repo, job, step, logLines)
+	if err != nil {
+		lines = []string{"(could not fetch log: " + err.Error() + ")"}
+	}
+	return jobs, failed, lines
+}
+
+// failedStepDetail is the audit detail for a failed run.
+func failedStepDetail(failed string) string {
+	if failed == "" {
+		return ""
+	}
+	return "failed step: " + failed
+}
+
+// currentStep names the step a run is on: the first one in progress, else
+// the last one to have finished.
+func currentStep(jobs []model.WorkflowJob) string {
+	last := ""
+	for _, j := range jobs {
+		for _, s := range j.Steps {
+			switch s.Status {
+			case "in_progress":
+				return s.Name
+			case "completed":
+				if s.Conclusion != "skipped" {
+					last = s.Name
+				}
+			}
+		}
+	}
+	return last
+}
+
+// triggerWave dispatches the workflow for every worker in the current wave
+// (every worker, outside a wave deploy).
+func (a *App) triggerWave() tea.Cmd {
+	target := a.deploy.selectedTarget()
+	img := a.deploy.images[a.deploy.imageCursor]
+	action, detail := "deploy-category", "category "+a.deploy.categoryName
+	var cmds []tea.Cmd
+	for i := range a.deploy.categoryRuns {
+		cr := &a.deploy.categoryRuns[i]
+		if cr.wave != a.deploy.wave {
+			continue
+		}
+		if len(a.deploy.waves) > 0 {
+			action = "deploy-workers"
+			detail = fmt.Sprintf("wave %d/%d category %s", cr.wave+1, len(a.deploy.waves), a.deploy.waves[cr.wave].Category)
+		}
+		cr.audit = audit.New("tui", action, a.catalog.WorkerService(cr.workerName))
+		cr.audit.Workflow = target.Workflow
+		cr.audit.Digest = img.Digest
+		cr.audit.Detail = detail
+		if a.deploy.override != "" {
+			cr.audit.Detail += "; " + a.deploy.override
+		}
+		reason := action + " " + a.deploy.categoryName + " " + digestPrefix(img.Digest)
+		cmds = append(cmds, a.triggerCategoryDeploy(a.cfg.Repo, target.Workflow, target.ImageBase, cr.workerName, img.Digest, reason, cr.audit))
+	}
+	return tea.Batch(cmds...)
+}
+
+// nextWave is called once every run in the current wave has finished. If
+// they all succeeded, the next wave starts after config.DefaultWaveWait;
+// otherwise the rest of the waves are skipped.
+func (a *App) nextWave() tea.Cmd {
+	if a.deploy.waveStopped || !a.deploy.nextWaveAt.IsZero() || a.deploy.wave >= len(a.deploy.waves)-1 {
+		return nil
+	}
+	for _, cr := range a.deploy.categoryRuns {
+		if cr.wave == a.deploy.wave && !cr.succeeded() {
+			a.deploy.waveStopped = true
+		}
+	}
+	if a.deploy.waveStopped {
+		for i := range a.deploy.categoryRuns {
+			if a.deploy.categoryRuns[i].wave > a.deploy.wave {
+				a.deploy.categoryRuns[i].skipped = true
+			}
+		}
+		return nil
 	}
+	a.deploy.nextWaveAt = time.Now().Add(config.DefaultWaveWait)
+	wave := a.deploy.wave + 1
+	return tea.Tick(config.DefaultWaveWait, func(t time.Time) tea.Msg {
+		return waveStartMsg{wave: wave}
+	})
 }
 
 // triggerCategoryDeploy dispatches a GitHub Actions workflow for a single worker in a category deploy.
-func (a App) triggerCategoryDeploy(repo, workflow, workerName, tag string) tea.Cmd {
+func (a App) triggerCategoryDeploy(repo, workflow, imageBase, workerName, tag, reason string, entry audit.Entry) tea.Cmd {
+	region, override := a.cfg.Region, a.deploy.override
 	return func() tea.Msg {
+		if err := verifyProvenance(repo, imageBase, tag, override); err != nil {
+			return categoryTriggeredMsg{workerName: workerName, err: err}
+		}
+		locks, err := guardDeploy(region, []string{entry.Service}, reason)
+		if err != nil {
+			return categoryTriggeredMsg{workerName: workerName, err: err}
+		}
 		inputs := map[string]string{
 			"service": workerName,
 			"tag":     tag,
 		}
-		err := github.TriggerWorkflow(repo, workflow, inputs)
-		return categoryTriggeredMsg{workerName: workerName, err: err}
+		d, err := github.DispatchWorkflow(repo, workflow, inputs)
+		auditTrigger(entry, d, err)
+		if err != nil {
+			releaseLocks(region, locks)
+			return categoryTriggeredMsg{workerName: workerName, err: err}
+		}
+		return categoryTriggeredMsg{workerName: workerName, dispatch: d, locks: locks}
 	}
 }
 
 // findCategoryRun looks for the workflow run for a worker in a category deploy.
-func (a App) findCategoryRun(repo, workflow, workerName string, since time.Time) tea.Cmd {
+func (a App) findCategoryRun(repo, workerName string, d github.Dispatch) tea.Cmd {
 	return func() tea.Msg {
-		runID, err := github.FindWorkflowRun(repo, workflow, since)
+		runID, err := github.FindDispatchedRun(repo, d)
 		return categoryRunFoundMsg{workerName: workerName, runID: runID, err: err}
 	}
 }
 
+// pollECS checks the ECS rollout a deploy started and, once it has
+// completed, that every running task is on digest.
+func (a App) pollECS(workerName, service, digest string, since time.Time) tea.Cmd {
+	return func() tea.Msg {
+		ctx := context.Background()
+		st, err := a.client.CheckRollout(ctx, service, since)
+		msg := ecsPollMsg{workerName: workerName, status: st, err: err}
+		if err == nil && st.State == "COMPLETED" {
+			msg.tasks, msg.verifyErr = a.client.VerifyImage(ctx, service, digest)
+		}
+		return msg
+	}
+}
+
 // pollCategoryRun checks the status of a workflow run for a worker in a category deploy.
 func (a App) pollCategoryRun(repo, workerName string, runID int) tea.Cmd {
 	return func() tea.Msg {
 		status, conclusion, err := github.GetWorkflowRun(repo, runID)
-		return categoryPollMsg{workerName: workerName, status: status, conclusion: conclusion, err: err}
+		if err != nil {
+			return categoryPollMsg{workerName: workerName, err: err}
+		}
+		msg := categoryPollMsg{workerName: workerName, status: status, conclusion: conclusion}
+		msg.jobs, msg.failed, msg.failLog = fetchRunSteps(repo, runID, status, conclusion, 5)
+		return msg
 	}
 }
 
@@ -2046,10 +2766,10 @@ func (a App) viewTrafficScreen() string {
 }
 
 // fetchTrafficRule fetches the ALB traffic rule for a web service.
-func (a App) fetchTrafficRule(serviceKey string) tea.Cmd {
+func (a App) fetchTrafficRule(serviceKey, targetGroup string) tea.Cmd {
 	return func() tea.Msg {
 		ctx := context.Background()
-		rule, err := a.client.FetchTrafficRule(ctx, serviceKey)
+		rule, err := a.client.FetchTrafficRule(ctx, serviceKey, targetGroup)
 		return trafficRuleFetchedMsg{rule: rule, err: err}
 	}
 }
@@ -2059,7 +2779,19 @@ func (a App) updateTrafficWeights(rule model.TrafficRule) tea.Cmd {
 	return func() tea.Msg {
 		ctx := context.Background()
 		err := a.client.UpdateTrafficWeights(ctx, rule)
-		return trafficRuleUpdatedMsg{err: err}
+
+		entry := audit.New("tui", "traffic", rule.ServiceKey+"-service")
+		var weights []string
+		for _, t := range rule.Targets {
+			weights = append(weights, fmt.Sprintf("%s=%d", t.Name, t.Weight))
+		}
+		entry.Detail = rule.Label + ": " + strings.Join(weights, ", ")
+		entry.Conclusion = "success"
+		if err != nil {
+			entry.Conclusion = "error"
+			entry.Detail += " (" + err.Error() + ")"
+		}
+		return trafficRuleUpdatedMsg{err: err, auditErr: audit.Record(entry)}
 	}
 }
 
@@ -32,7 +32,7 @@ type visualLine struct {
 }
 
 // buildRows creates the flat list of dashboard rows from grouped services.
-func buildRows(services []model.Service, workers *config.WorkersConfig) []dashboardRow {
+func buildRows(catalog *config.Catalog, services []model.Service, workers *config.WorkersConfig) []dashboardRow {
 	var rows []dashboardRow
 
 	// Group services
@@ -66,14 +66,12 @@ func buildRows(services []model.Service, workers *config.WorkersConfig) []dashbo
 		}
 	}
 
-	// Web services in deployment order
+	// Web services in catalog order
 	if len(webServices) > 0 {
 		rows = append(rows, dashboardRow{isGroup: true, group: "Web"})
-		webOrder := map[string]int{
-			"web-canary":          0,
-			"web-shop":            1,
-			"web-unauthenticated": 2,
-			"web-stable":          3,
+		webOrder := make(map[string]int)
+		for i, name := range catalog.Named("web") {
+			webOrder[name+"-service"] = i
 		}
 		sortByOrder(webServices, webOrder)
 		for _, svc := range webServices {
@@ -5,8 +5,11 @@ import (
 	"strings"
 	"time"
 
+	"dreamwidth.org/dwtool/internal/audit"
 	dwaws "dreamwidth.org/dwtool/internal/aws"
 	"dreamwidth.org/dwtool/internal/config"
+	"dreamwidth.org/dwtool/internal/github"
+	"dreamwidth.org/dwtool/internal/lock"
 	"dreamwidth.org/dwtool/internal/model"
 )
 
@@ -23,11 +26,84 @@ const (
 // categoryRun tracks the deploy status of a single worker in a category deploy.
 type categoryRun struct {
 	workerName string
+	wave       int // 0-based; always 0 outside a wave deploy
 	triggered  bool
+	skipped    bool // a wave deploy stopped before reaching this worker
+	dispatch   github.Dispatch
 	runID      int
 	status     string // "queued", "in_progress", "completed"
 	conclusion string // "success", "failure", "cancelled"
+	step       string // current (or last finished) workflow step
+	failedStep string // "job / step", once the run has failed
+	failLog    []string
+	ecs        ecsWatch
+	locks      []lock.Lock
 	err        error
+	audit      audit.Entry
+}
+
+// finished reports whether nothing more will happen to this worker's deploy.
+func (cr categoryRun) finished() bool {
+	if cr.err != nil || cr.skipped {
+		return true
+	}
+	return cr.status == "completed" && (cr.conclusion != "success" || cr.ecs.finished())
+}
+
+// succeeded reports whether the worker's run passed and its ECS rollout
+// landed.
+func (cr categoryRun) succeeded() bool {
+	return cr.err == nil && cr.conclusion == "success" && cr.ecs.done
+}
+
+// ecsWatch follows the ECS rollout that comes after a successful workflow
+// run, until the new deployment is COMPLETED on the deployed image or fails.
+type ecsWatch struct {
+	state  string // e.g. "IN_PROGRESS 1/2"; empty until the first check
+	done   bool   // COMPLETED and every task verified on the image
+	tasks  int
+	events []model.ServiceEvent
+	err    error
+}
+
+func (w ecsWatch) finished() bool { return w.done || w.err != nil }
+
+// update applies one check of the rollout and reports whether the watch is
+// over. since is when the deploy was triggered.
+func (w *ecsWatch) update(msg ecsPollMsg, since time.Time) bool {
+	if msg.err != nil {
+		w.err = msg.err
+		return true
+	}
+	st := msg.status
+	w.events = st.Events
+	w.state = "waiting for new deployment"
+	if st.State != "" {
+		w.state = st.State + " " + dwaws.TaskCount(st.Running, st.Desired)
+	}
+	switch st.State {
+	case "COMPLETED":
+		w.tasks = msg.tasks
+		w.err = msg.verifyErr
+		w.done = w.err == nil
+		return true
+	case "FAILED":
+		w.err = fmt.Errorf("ECS rollout FAILED (task definition %s)", st.TaskDef)
+		return true
+	}
+	if time.Since(since) > ecsRolloutTimeout {
+		w.err = fmt.Errorf("timed out after %s waiting for the ECS rollout (%s)", ecsRolloutTimeout, w.state)
+		return true
+	}
+	return false
+}
+
+// outcome is the audit conclusion and detail for a finished watch.
+func (w ecsWatch) outcome() (string, string) {
+	if w.err != nil {
+		return "failure", w.err.Error()
+	}
+	return "success", ""
 }
 
 // deployState holds all state for the deploy flow.
@@ -44,20 +120,72 @@ type deployState struct {
 	targets      []model.DeployTarget
 	targetCursor int
 
-	// for "all workers" deploy
-	allWorkers bool
+	// for rollback: a single pre-selected image, confirmed straight away
+	rollback     bool
+	rollbackFrom model.ImageRevision
+	rollbackTo   model.ImageRevision
+
+	// Commits between the running image and the selected one (confirm step,
+	// single-service deploys only)
+	diff        *model.ReleaseDiff
+	diffErr     error
+	diffLoading bool
+
+	// Where the selected image was built (confirm step; rollbacks skip the
+	// check). Deploying an unverified image takes a reason, which goes in
+	// the audit log like the CLI's --allow-unverified --reason.
+	provenance        *model.Provenance
+	provenanceErr     error
+	provenanceLoading bool
+	overriding        bool   // typing the override reason
+	overrideReason    string // as typed so far
+	override          string // audit note, once the override is confirmed
 
 	// for category deploy
 	categoryDeploy bool
 	categoryName   string
 	categoryRuns   []categoryRun
 
+	// for a wave deploy of every worker category: runs in wave N start once
+	// every run in wave N-1 has succeeded
+	waves       []config.DeployWave
+	wave        int       // wave in progress (0-based)
+	nextWaveAt  time.Time // set while waiting between waves
+	waveStopped bool      // a wave failed; later waves were skipped
+
 	// Progress tracking
 	triggered  time.Time
+	dispatch   github.Dispatch
 	runID      int
 	runStatus  string // "queued", "in_progress", "completed"
 	conclusion string // "success", "failure", "cancelled"
+	jobs       []model.WorkflowJob
+	failedStep string // "job / step", once the run has failed
+	failLog    []string
+	ecs        ecsWatch
 	nextHint   string // "Next: deploy web-shop" after web-canary
+	locks      []lock.Lock
+	audit      audit.Entry
+}
+
+// finished reports whether nothing more will happen to a single deploy.
+func (ds deployState) finished() bool {
+	if ds.runStatus != "completed" {
+		return false
+	}
+	return ds.conclusion != "success" || ds.ecs.finished()
+}
+
+// provenanceProblems lists why the selected image's provenance didn't
+// verify; it's empty for a verified image.
+func (ds deployState) provenanceProblems() []string {
+	switch {
+	case ds.provenanceErr != nil:
+		return []string{fmt.Sprintf("can't read provenance: %v", ds.provenanceErr)}
+	case ds.provenance == nil:
+		return []string{"provenance not checked"}
+	}
+	return ds.provenance.Problems
 }
 
 // selectedTarget returns the currently selected deploy target.
@@ -118,9 +246,7 @@ func renderTargetSelectView(ds deployState, width int) string {
 	var b strings.Builder
 
 	serviceName := ds.service.Name
-	if ds.allWorkers {
-		serviceName = "ALL WORKERS"
-	} else if ds.categoryDeploy {
+	if ds.categoryDeploy {
 		serviceName = fmt.Sprintf("WORKERS: %s", ds.categoryName)
 	}
 	b.WriteString(labelStyle.Render(fmt.Sprintf(" Deploy %s — Select Image Source", serviceName)))
@@ -154,9 +280,7 @@ func renderImageSelectView(ds deployState, width, height int) string {
 	var b strings.Builder
 
 	serviceName := ds.service.Name
-	if ds.allWorkers {
-		serviceName = "ALL WORKERS"
-	} else if ds.categoryDeploy {
+	if ds.categoryDeploy {
 		serviceName = fmt.Sprintf("WORKERS: %s", ds.categoryName)
 	}
 	target := ds.selectedTarget()
@@ -300,15 +424,20 @@ func renderConfirmView(ds deployState, width int) string {
 	var b strings.Builder
 
 	serviceName := ds.service.Name
-	if ds.allWorkers {
-		serviceName = "ALL WORKERS (*)"
-	}
 
-	b.WriteString(confirmStyle.Render(" Confirm Deploy"))
+	title := " Confirm Deploy"
+	if ds.rollback {
+		title = " Confirm Rollback"
+	}
+	b.WriteString(confirmStyle.Render(title))
 	b.WriteString("\n\n")
 
 	// Service info
 	b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Service: "), serviceName))
+	if ds.rollback {
+		b.WriteString(fmt.Sprintf("   %s  %s (%s)\n", labelStyle.Render("Current: "), ds.service.ImageDigest, ds.rollbackFrom.TaskDef))
+		b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Previous:"), ds.rollbackTo.TaskDef))
+	}
 
 	// Image info
 	img := ds.images[ds.imageCursor]
@@ -340,22 +469,153 @@ func renderConfirmView(ds deployState, width int) string {
 	b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Source:  "), target.ImageBase))
 
 	b.WriteString("\n")
-	b.WriteString(confirmStyle.Render("   Press Y (Shift+Y) to deploy, any other key to cancel."))
+	b.WriteString(renderReleaseDiff(ds, width))
+
+	action := "deploy"
+	if ds.rollback {
+		action = "roll back"
+	} else {
+		b.WriteString(renderProvenance(ds))
+	}
 	b.WriteString("\n")
+	b.WriteString(renderConfirmPrompt(ds, action))
 
 	return b.String()
 }
 
+// renderProvenance renders the confirm screen's "Built" panel: where the
+// image came from and, if it didn't verify, why.
+func renderProvenance(ds deployState) string {
+	var b strings.Builder
+	b.WriteString("\n")
+	if ds.provenanceLoading {
+		b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Built:   "), dimStyle.Render("Checking provenance...")))
+		return b.String()
+	}
+	if p := ds.provenance; p != nil && ds.provenanceErr == nil {
+		built := shortGitSHA(p.Revision)
+		if p.Branch != "" {
+			built += " on " + p.Branch
+		}
+		if src := strings.TrimPrefix(p.Source, "https://"); src != "" {
+			built += " from " + src
+		}
+		b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Built:   "), built))
+		builder := "unverified (no signed attestation; commit is from image labels)"
+		if p.Attested {
+			builder = p.Builder
+		}
+		b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Builder: "), builder))
+	}
+	for _, problem := range ds.provenanceProblems() {
+		b.WriteString(failureStyle.Render("     ! UNVERIFIED: "+problem) + "\n")
+	}
+	return b.String()
+}
+
+// renderConfirmPrompt renders the line saying how to confirm action, or the
+// reason being typed to override a failed provenance check.
+func renderConfirmPrompt(ds deployState, action string) string {
+	switch {
+	case ds.overriding:
+		return confirmStyle.Render("   Reason for deploying an unverified image (recorded in the audit log): ") +
+			ds.overrideReason + "_\n" +
+			dimStyle.Render("   Enter to deploy, Esc to go back.") + "\n"
+	case !ds.rollback && ds.provenanceLoading:
+		return dimStyle.Render("   Checking provenance... any key cancels.") + "\n"
+	case !ds.rollback && len(ds.provenanceProblems()) > 0:
+		return confirmStyle.Render(fmt.Sprintf("   Press Y (Shift+Y) to %s anyway, giving a reason; any other key cancels.", action)) + "\n"
+	}
+	return confirmStyle.Render(fmt.Sprintf("   Press Y (Shift+Y) to %s, any other key to cancel.", action)) + "\n"
+}
+
+// maxDiffCommits is how many commits the confirm screen lists.
+const maxDiffCommits = 10
+
+// renderReleaseDiff renders the confirm screen's "Changes" panel: the
+// commits the deploy adds (or, for an older image, removes) and any
+// bin/upgrading or DB schema changes among them.
+func renderReleaseDiff(ds deployState, width int) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("   %s\n", labelStyle.Render("Changes:")))
+	switch {
+	case ds.diffLoading:
+		b.WriteString(dimStyle.Render("     Loading commits...") + "\n")
+		return b.String()
+	case ds.diffErr != nil:
+		b.WriteString(dimStyle.Render(fmt.Sprintf("     unavailable: %v", ds.diffErr)) + "\n")
+		return b.String()
+	case ds.diff == nil:
+		return ""
+	case len(ds.diff.Commits) == 0:
+		b.WriteString(dimStyle.Render("     none (same commit as running)") + "\n")
+		return b.String()
+	}
+
+	d := ds.diff
+	count := fmt.Sprintf("%d", len(d.Commits))
+	if d.Truncated {
+		count += "+"
+	}
+	summary := fmt.Sprintf("     %s commits (%s..%s, via %s)", count, shortGitSHA(d.Base), shortGitSHA(d.Head), d.Source)
+	if d.Rollback {
+		b.WriteString(confirmStyle.Render(summary+" -- REMOVED: the image is older than what's running") + "\n")
+	} else {
+		b.WriteString(dimStyle.Render(summary) + "\n")
+	}
+
+	for i, c := range d.Commits {
+		if i == maxDiffCommits {
+			b.WriteString(dimStyle.Render(fmt.Sprintf("     ... %d more", len(d.Commits)-i)) + "\n")
+			break
+		}
+		pr := "-"
+		if c.PR != 0 {
+			pr = fmt.Sprintf("#%d", c.PR)
+		}
+		line := fmt.Sprintf("     %s %s %s ", shortGitSHA(c.SHA), padRight(pr, 6), padRight(truncate(c.Author, 16), 16))
+		b.WriteString(line + truncate(c.Subject, width-len(line)) + "\n")
+	}
+
+	for _, f := range d.Flagged {
+		if f.Kind == "schema" {
+			b.WriteString(failureStyle.Render("     ! DB schema change: "+f.Path) + "\n")
+		} else {
+			b.WriteString(confirmStyle.Render("     ! bin/upgrading change: "+f.Path) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// digestPrefix abbreviates an image digest to the 12 hex characters shown
+// throughout the UI.
+func digestPrefix(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// shortGitSHA abbreviates a git SHA to 7 characters.
+func shortGitSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
 // renderProgressView shows the deploy progress.
 func renderProgressView(ds deployState, width int) string {
 	var b strings.Builder
 
 	serviceName := ds.service.Name
-	if ds.allWorkers {
-		serviceName = "ALL WORKERS (*)"
-	}
 
-	b.WriteString(labelStyle.Render(fmt.Sprintf(" Deploying %s", serviceName)))
+	verb := "Deploying"
+	if ds.rollback {
+		verb = "Rolling back"
+	}
+	b.WriteString(labelStyle.Render(fmt.Sprintf(" %s %s", verb, serviceName)))
 	b.WriteString("\n\n")
 
 	// Show what was triggered
@@ -412,16 +672,33 @@ func renderProgressView(ds deployState, width int) string {
 		}
 	}
 
+	if len(ds.jobs) > 0 {
+		b.WriteString("\n")
+		b.WriteString(renderRunSteps(ds.jobs, spinnerFrames[spinnerFrame(ds.triggered)]))
+	}
+	if ds.failedStep != "" {
+		b.WriteString("\n")
+		b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Failed:"), failureStyle.Render(ds.failedStep)))
+		b.WriteString(renderLogTail(ds.failLog, width, "     "))
+	}
+	if ds.ecs.state != "" || ds.ecs.err != nil {
+		b.WriteString("\n")
+		b.WriteString(renderECSWatch(ds.ecs, ds.images[ds.imageCursor].Digest, spinnerFrames[spinnerFrame(ds.triggered)], width))
+	}
+
 	// Next hint for web deploy order
-	if ds.nextHint != "" && ds.runStatus == "completed" && ds.conclusion == "success" {
+	if ds.nextHint != "" && ds.finished() && ds.conclusion == "success" && ds.ecs.err == nil {
 		b.WriteString("\n")
 		b.WriteString(fmt.Sprintf("   %s\n", successStyle.Render(ds.nextHint)))
 	}
 
 	b.WriteString("\n")
-	if ds.runStatus == "completed" {
+	switch {
+	case ds.finished():
 		b.WriteString(dimStyle.Render("   Press Esc to go back."))
-	} else {
+	case ds.runStatus == "completed":
+		b.WriteString(dimStyle.Render("   Press Esc to go back (the ECS rollout continues)."))
+	default:
 		b.WriteString(dimStyle.Render("   Press Esc to go back (deploy continues on GitHub)."))
 	}
 	b.WriteString("\n")
@@ -429,9 +706,81 @@ func renderProgressView(ds deployState, width int) string {
 	return b.String()
 }
 
+// renderRunSteps lists each job's steps with a status mark and, once
+// finished, how long the step took. Skipped and not-yet-started steps are
+// left out to keep the list to what's happened.
+func renderRunSteps(jobs []model.WorkflowJob, spin string) string {
+	var b strings.Builder
+	for _, j := range jobs {
+		b.WriteString(fmt.Sprintf("   %s\n", labelStyle.Render(j.Name)))
+		for _, s := range j.Steps {
+			var mark, took string
+			switch {
+			case s.Status == "in_progress":
+				mark = spin
+				took = time.Since(s.StartedAt).Round(time.Second).String()
+			case s.Status != "completed" || s.Conclusion == "skipped":
+				continue
+			case s.Conclusion == "success":
+				mark = successStyle.Render("✓")
+				took = s.CompletedAt.Sub(s.StartedAt).Round(time.Second).String()
+			default:
+				mark = failureStyle.Render("✗")
+				took = s.CompletedAt.Sub(s.StartedAt).Round(time.Second).String()
+			}
+			b.WriteString(fmt.Sprintf("     %s %s %s\n", mark, padRight(s.Name, 40), dimStyle.Render(took)))
+		}
+	}
+	return b.String()
+}
+
+// renderECSWatch shows the ECS rollout after a successful run: its state while
+// in progress, the verified image once done, or the error and the service
+// events that explain it.
+func renderECSWatch(w ecsWatch, digest, spin string, width int) string {
+	var b strings.Builder
+	label := labelStyle.Render("ECS:")
+	switch {
+	case w.err != nil:
+		msg := wrapText(w.err.Error(), width-12, strings.Repeat(" ", 12))
+		b.WriteString(fmt.Sprintf("   %s     %s\n", label, failureStyle.Render(msg)))
+		events := w.events
+		if len(events) > 8 {
+			events = events[:8]
+		}
+		var lines []string
+		for i := len(events) - 1; i >= 0; i-- {
+			lines = append(lines, events[i].CreatedAt.Local().Format("15:04:05")+" "+events[i].Message)
+		}
+		b.WriteString(renderLogTail(lines, width, "     "))
+	case w.done:
+		short := strings.TrimPrefix(digest, "sha256:")
+		if len(short) > 12 {
+			short = short[:12]
+		}
+		b.WriteString(fmt.Sprintf("   %s     %s\n", label, successStyle.Render(fmt.Sprintf("%s, all %d tasks on %s", w.state, w.tasks, short))))
+	default:
+		b.WriteString(fmt.Sprintf("   %s     %s %s\n", label, spin, w.state))
+	}
+	return b.String()
+}
+
+// renderLogTail renders log lines dimmed, truncated to fit width.
+func renderLogTail(lines []string, width int, indent string) string {
+	var b strings.Builder
+	room := width - len(indent) - 1
+	for _, line := range lines {
+		if room > 0 && len(line) > room {
+			line = line[:room]
+		}
+		b.WriteString(indent + dimStyle.Render(line) + "\n")
+	}
+	return b.String()
+}
+
 // nextWebService returns a hint for the next web service to deploy, or empty if none.
-func nextWebService(currentService string) string {
-	order := config.WebDeployOrder
+func nextWebService(catalog *config.Catalog, currentService string) string {
+	order := catalog.DeployOrder
 	for i, name := range order {
 		if name == currentService && i+1 < len(order) {
 			return fmt.Sprintf("Next: deploy %s (select it and press d)", order[i+1])
@@ -480,15 +829,24 @@ func renderCategoryConfirmView(ds deployState, width int) string {
 
 	b.WriteString(fmt.Sprintf("   %s  WORKERS: %s\n", labelStyle.Render("Category:"), ds.categoryName))
 
-	// List all workers in the category
-	b.WriteString(fmt.Sprintf("   %s  ", labelStyle.Render("Workers: ")))
-	for i, cr := range ds.categoryRuns {
-		if i > 0 {
-			b.WriteString(", ")
+	if len(ds.waves) > 0 {
+		// List the waves, in the order they'll run
+		b.WriteString(fmt.Sprintf("   %s  %d workers in %d waves of at most %d, %s apart\n",
+			labelStyle.Render("Waves:   "), len(ds.categoryRuns), len(ds.waves), config.DefaultWaveSize, config.DefaultWaveWait))
+		for i, w := range ds.waves {
+			b.WriteString(fmt.Sprintf("   %s  %3d. %-12s %s\n", strings.Repeat(" ", 9), i+1, w.Category, strings.Join(w.Workers, ", ")))
+		}
+	} else {
+		// List all workers in the category
+		b.WriteString(fmt.Sprintf("   %s  ", labelStyle.Render("Workers: ")))
+		for i, cr := range ds.categoryRuns {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(cr.workerName)
 		}
-		b.WriteString(cr.workerName)
+		b.WriteString(fmt.Sprintf(" (%d workers)\n", len(ds.categoryRuns)))
 	}
-	b.WriteString(fmt.Sprintf(" (%d workers)\n", len(ds.categoryRuns)))
 
 	// Image info
 	img := ds.images[ds.imageCursor]
@@ -517,9 +875,10 @@ func renderCategoryConfirmView(ds deployState, width int) string {
 	b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Workflow:"), target.Workflow))
 	b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Source:  "), target.ImageBase))
 
+	b.WriteString(renderProvenance(ds))
+
 	b.WriteString("\n")
-	b.WriteString(confirmStyle.Render("   Press Y (Shift+Y) to deploy, any other key to cancel."))
-	b.WriteString("\n")
+	b.WriteString(renderConfirmPrompt(ds, "deploy"))
 
 	return b.String()
 }
@@ -543,8 +902,18 @@ func renderCategoryProgressView(ds deployState, width int) string {
 	b.WriteString(fmt.Sprintf("   %s  %s\n", labelStyle.Render("Image:"), shortDigest))
 	b.WriteString("\n")
 
-	// Per-worker status table
-	for _, cr := range ds.categoryRuns {
+	// Per-worker status table, under a heading per wave
+	for i, cr := range ds.categoryRuns {
+		if len(ds.waves) > 0 && (i == 0 || ds.categoryRuns[i-1].wave != cr.wave) {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			heading := fmt.Sprintf("   Wave %d/%d: %s", cr.wave+1, len(ds.waves), ds.waves[cr.wave].Category)
+			if cr.wave > ds.wave {
+				heading = dimStyle.Render(heading)
+			}
+			b.WriteString(heading + "\n")
+		}
 		name := padRight(cr.workerName, 30)
 		var status string
 		if cr.err != nil {
@@ -553,7 +922,17 @@ func renderCategoryProgressView(ds deployState, width int) string {
 		} else if cr.status == "completed" {
 			switch cr.conclusion {
 			case "success":
-				status = successStyle.Render("SUCCESS")
+				switch {
+				case cr.ecs.err != nil:
+					errMsg := fmt.Sprintf("ECS: %v", cr.ecs.err)
+					status = failureStyle.Render(wrapText(errMsg, width-34, strings.Repeat(" ", 34)))
+				case cr.ecs.done:
+					status = successStyle.Render("SUCCESS")
+				case cr.ecs.state != "":
+					status = fmt.Sprintf("%s ECS %s", spinnerFrames[spinnerFrame(ds.triggered)], cr.ecs.state)
+				default:
+					status = fmt.Sprintf("%s Waiting for ECS...", spinnerFrames[spinnerFrame(ds.triggered)])
+				}
 			case "failure":
 				status = failureStyle.Render("FAILED")
 			case "cancelled":
@@ -561,6 +940,8 @@ func renderCategoryProgressView(ds deployState, width int) string {
 			default:
 				status = fmt.Sprintf("%s (%s)", cr.status, cr.conclusion)
 			}
+		} else if cr.status == "in_progress" && cr.step != "" {
+			status = fmt.Sprintf("%s %s", spinnerFrames[spinnerFrame(ds.triggered)], cr.step)
 		} else if cr.status == "in_progress" {
 			status = fmt.Sprintf("%s In progress...", spinnerFrames[spinnerFrame(ds.triggered)])
 		} else if cr.status == "queued" {
@@ -571,11 +952,17 @@ func renderCategoryProgressView(ds deployState, width int) string {
 			} else {
 				status = fmt.Sprintf("%s Polling...", spinnerFrames[spinnerFrame(ds.triggered)])
 			}
+		} else if cr.skipped {
+			status = dimStyle.Render("skipped")
 		} else {
 			status = dimStyle.Render("pending")
 		}
 
 		b.WriteString(fmt.Sprintf("   %s %s\n", name, status))
+		if cr.failedStep != "" {
+			b.WriteString(fmt.Sprintf("   %s %s\n", strings.Repeat(" ", 30), failureStyle.Render(cr.failedStep)))
+			b.WriteString(renderLogTail(cr.failLog, width, strings.Repeat(" ", 36)))
+		}
 	}
 
 	b.WriteString("\n")
@@ -583,14 +970,24 @@ func renderCategoryProgressView(ds deployState, width int) string {
 	// Check if all completed
 	allDone := true
 	for _, cr := range ds.categoryRuns {
-		if cr.status != "completed" && cr.err == nil {
+		if !cr.finished() {
 			allDone = false
 			break
 		}
 	}
 
+	switch {
+	case ds.waveStopped:
+		b.WriteString(failureStyle.Render(fmt.Sprintf("   Wave %d failed; the remaining waves were skipped.", ds.wave+1)))
+		b.WriteString("\n\n")
+	case !ds.nextWaveAt.IsZero():
+		b.WriteString(fmt.Sprintf("   Wave %d done. Next wave starts at %s.\n\n", ds.wave+1, ds.nextWaveAt.Format("15:04:05")))
+	}
+
 	if allDone && len(ds.categoryRuns) > 0 {
 		b.WriteString(dimStyle.Render("   Press Esc to go back."))
+	} else if len(ds.waves) > 0 {
+		b.WriteString(dimStyle.Render("   Press Esc to go back (running deploys continue on GitHub; later waves are cancelled)."))
 	} else {
 		b.WriteString(dimStyle.Render("   Press Esc to go back (deploys continue on GitHub)."))
 	}
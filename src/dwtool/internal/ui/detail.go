@@ -8,10 +8,17 @@ import (
 	"dreamwidth.org/dwtool/internal/model"
 )
 
+// How many recently stopped tasks and service events the detail view shows.
+const (
+	detailStoppedTasks = 5
+	detailEvents       = 6
+)
+
 // detailState holds state for the service detail view.
 type detailState struct {
 	service    model.Service
 	tasks      []model.Task
+	stopped    []model.Task // most recently stopped first
 	taskCursor int
 	loading    bool
 	err        error
@@ -73,9 +80,10 @@ func renderDetailView(ds detailState, width, height int) string {
 		b.WriteString("   No running tasks.\n")
 	} else {
 		// Task table header
-		header := fmt.Sprintf("     %s %s %s %s %s",
+		header := fmt.Sprintf("     %s %s %s %s %s %s",
 			padRight("TASK ID", 38),
 			padRight("STATUS", 12),
+			padRight("HEALTH", 10),
 			padRight("STARTED", 12),
 			padRight("IP", 16),
 			padRight("CONTAINER", 16),
@@ -99,23 +107,30 @@ func renderDetailView(ds detailState, width, height int) string {
 				container = "-"
 			}
 
+			health := task.Health
+			if health == "" {
+				health = "-"
+			}
+
 			idCell := padRight(taskID, 38)
 			statusCell := padRight(task.Status, 12)
+			healthCell := padRight(health, 10)
 			startedCell := padRight(started, 12)
 			ipCell := padRight(ip, 16)
 			containerCell := padRight(container, 16)
 
 			if i == ds.taskCursor {
-				line := fmt.Sprintf("   > %s %s %s %s %s",
-					idCell, statusCell, startedCell, ipCell, containerCell)
+				line := fmt.Sprintf("   > %s %s %s %s %s %s",
+					idCell, statusCell, healthCell, startedCell, ipCell, containerCell)
 				if width > 0 && len(line) < width {
 					line += strings.Repeat(" ", width-len(line))
 				}
 				b.WriteString(selectedStyle.Render(line))
 			} else {
-				b.WriteString(fmt.Sprintf("     %s %s %s %s %s",
+				b.WriteString(fmt.Sprintf("     %s %s %s %s %s %s",
 					dimStyle.Render(idCell),
 					colorizeTaskStatus(statusCell, task.Status),
+					colorizeHealth(healthCell, task.Health),
 					dimStyle.Render(startedCell),
 					ipCell,
 					dimStyle.Render(containerCell),
@@ -170,8 +185,49 @@ func renderDetailView(ds detailState, width, height int) string {
 		}
 	}
 
+	// Recently stopped tasks: why they stopped is usually the first clue
+	// when a service is crash-looping.
+	if len(ds.stopped) > 0 {
+		b.WriteString("\n")
+		b.WriteString(labelStyle.Render(" Stopped Tasks"))
+		b.WriteString("\n")
+		for _, task := range ds.stopped {
+			code := task.StopCode
+			if code == "" {
+				code = "-"
+			}
+			b.WriteString(fmt.Sprintf("     %s %s %s\n",
+				dimStyle.Render(padRight(task.ID, 38)),
+				dimStyle.Render(padRight(dwaws.RelativeTime(task.StoppedAt), 12)),
+				failureStyle.Render(code),
+			))
+			why := task.StoppedReason
+			if exits := dwaws.ContainerExits(task); exits != "" {
+				why += " · " + exits
+			}
+			b.WriteString(fmt.Sprintf("       %s\n", truncate(why, width-8)))
+		}
+	}
+
+	// Recent service events, newest first.
+	if len(ds.service.Events) > 0 {
+		b.WriteString("\n")
+		b.WriteString(labelStyle.Render(" Events"))
+		b.WriteString("\n")
+		events := ds.service.Events
+		if len(events) > detailEvents {
+			events = events[:detailEvents]
+		}
+		for _, e := range events {
+			b.WriteString(fmt.Sprintf("     %s %s\n",
+				dimStyle.Render(e.CreatedAt.Local().Format("15:04:05")),
+				truncate(e.Message, width-15),
+			))
+		}
+	}
+
 	b.WriteString("\n")
-	b.WriteString(dimStyle.Render("   j/k:navigate  s:shell  d:deploy  t:traffic  r:refresh  esc:back"))
+	b.WriteString(dimStyle.Render("   j/k:navigate  s:shell  d:deploy  b:rollback  t:traffic  r:refresh  esc:back"))
 	b.WriteString("\n")
 
 	return b.String()
@@ -191,6 +247,18 @@ func colorizeTaskStatus(padded, status string) string {
 	}
 }
 
+// colorizeHealth applies color to a task health cell.
+func colorizeHealth(padded, health string) string {
+	switch health {
+	case "HEALTHY":
+		return taskCountOKStyle.Render(padded)
+	case "UNHEALTHY":
+		return failureStyle.Render(padded)
+	default:
+		return dimStyle.Render(padded)
+	}
+}
+
 // colorizeDeployStatus applies color to a deployment status cell.
 func colorizeDeployStatus(padded, status string) string {
 	switch status {
@@ -216,3 +284,12 @@ func colorizeRollout(padded, state string) string {
 		return padded
 	}
 }
+
+// truncate shortens s to at most width runes, marking the cut with "...".
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if width <= 3 || len(r) <= width {
+		return s
+	}
+	return string(r[:width-3]) + "..."
+}
@@ -25,7 +25,7 @@ func renderHelpOverlay(width, height int) string {
 				{"\u2192", "switch to SQS Queues"},
 				{"enter", "service detail"},
 				{"d", "deploy service"},
-				{"D", "deploy all workers"},
+				{"D", "deploy all workers in waves"},
 				{"ctrl+d", "deploy worker category"},
 				{"t", "traffic weights (web only)"},
 				{"l", "view logs"},
@@ -54,6 +54,7 @@ func renderHelpOverlay(width, height int) string {
 				{"PgUp/Dn", "page up/down"},
 				{"s", "shell into selected task"},
 				{"d", "deploy service"},
+				{"b", "roll back to previous image"},
 				{"t", "traffic weights (web only)"},
 				{"l", "view logs"},
 				{"r", "refresh"},
@@ -11,6 +11,7 @@ type keyMap struct {
 	Deploy         key.Binding
 	DeployAll      key.Binding
 	DeployCategory key.Binding
+	Rollback       key.Binding
 	Logs           key.Binding
 	Shell          key.Binding
 	Filter         key.Binding
@@ -48,12 +49,16 @@ var keys = keyMap{
 	),
 	DeployAll: key.NewBinding(
 		key.WithKeys("D"),
-		key.WithHelp("D", "deploy all workers"),
+		key.WithHelp("D", "deploy all workers in waves"),
 	),
 	DeployCategory: key.NewBinding(
 		key.WithKeys("ctrl+d"),
 		key.WithHelp("ctrl+d", "deploy category"),
 	),
+	Rollback: key.NewBinding(
+		key.WithKeys("b"),
+		key.WithHelp("b", "roll back"),
+	),
 	Logs: key.NewBinding(
 		key.WithKeys("l"),
 		key.WithHelp("l", "logs"),
@@ -22,6 +22,14 @@ import (
 
 func main() {
 	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "catalog", "help", "log-scan", "esn-trace":
+			// These don't deploy or classify services, or load the catalog themselves.
+		default:
+			if !strings.HasPrefix(os.Args[1], "-") {
+				useCatalog("")
+			}
+		}
 		switch os.Args[1] {
 		case "log-scan":
 			runLogScan(os.Args[2:])
@@ -38,12 +46,33 @@ func main() {
 		case "images":
 			runImages(os.Args[2:])
 			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
 		case "deploy":
 			runDeploy(os.Args[2:])
 			return
 		case "deploy-category":
 			runDeployCategory(os.Args[2:])
 			return
+		case "lock":
+			runLock(os.Args[2:])
+			return
+		case "deploy-workers":
+			runDeployWorkers(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "rollback":
+			runRollback(os.Args[2:])
+			return
+		case "rollout":
+			runRollout(os.Args[2:])
+			return
+		case "catalog":
+			runCatalog(os.Args[2:])
+			return
 		case "help", "--help", "-h":
 			printUsage()
 			return
@@ -56,8 +85,11 @@ func main() {
 	flag.StringVar(&cfg.Repo, "repo", config.DefaultRepo, "GitHub repository (owner/name)")
 	flag.StringVar(&cfg.WorkersDir, "workers-json", "", "path to config/workers.json (auto-detected if empty)")
 	flag.StringVar(&cfg.SQSPrefix, "sqs-prefix", config.DefaultSQSPrefix, "SQS queue name prefix for discovery")
+	flag.StringVar(&cfg.CatalogPath, "catalog", "", "path to config/services.json (auto-detected if empty)")
 	flag.Parse()
 
+	useCatalog(cfg.CatalogPath)
+
 	// Load workers config
 	workers, err := config.LoadWorkers(cfg.WorkersDir)
 	if err != nil {
@@ -71,7 +103,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	app := ui.NewApp(cfg, workers, client)
+	app := ui.NewApp(cfg, serviceCatalog(), workers, client)
 	p := tea.NewProgram(app, tea.WithAltScreen())
 
 	if _, err := p.Run(); err != nil {
@@ -88,15 +120,24 @@ Commands:
   services      List ECS services and their rollout state (--json)
   status        Show one service's deployments and running tasks (--json)
   images        List deployable GHCR images for a service (--json)
-  deploy        Deploy an image digest to one service (dry run without --yes)
-  deploy-category  Deploy a digest to every worker in a category (dry run without --yes)
+  images prune  Delete old GHCR images, keeping recent and deployed ones (dry run without --yes)
+  diff          List the commits between a service's running image and another image
+  deploy        Deploy an image to one service (dry run without --yes)
+  deploy-category  Deploy an image to every worker in a category (dry run without --yes)
+  deploy-workers   Deploy an image to every worker category in waves (dry run without --yes)
+  rollback      Redeploy a service's (or category's) previous image (dry run without --yes)
+  rollout       Deploy an image through the web services in order, with health gates
+  lock          List deploy locks, or take or release one
+  history       List past deploys, rollbacks and traffic changes from the audit log
+  catalog check Validate the service catalog and compare it with the services in ECS
   log-scan      Search logs across all Dreamwidth services (via Loki)
   esn-trace     Trace an ESN event through the full notification pipeline
 
 The services/status/images/deploy commands need AWS credentials; images and
-deploy additionally need the 'gh' CLI authenticated. deploy/deploy-category only
-trigger a workflow when given --yes; otherwise they print a plan and exit.
-Loki credentials for log-scan/esn-trace:
+deploy additionally need a GitHub token (GH_TOKEN, or gh's stored login). deploy/deploy-category/deploy-workers/
+rollback/rollout only trigger a workflow when given --yes; otherwise they print a plan and exit.
+Services are described by the catalog in $DWTOOL_CATALOG or $LJHOME/config/services.json;
+every command but catalog check needs one. Loki credentials for log-scan/esn-trace:
 ~/.config/dwtool/config.json or DWTOOL_LOKI_* env vars.
 Run 'dwtool <command> --help' for details on a specific command.
 `)
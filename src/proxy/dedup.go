@@ -0,0 +1,85 @@
+/*
+
+dedup.go
+
+Content-addressed storage of cached bodies. Every body is stored once under
+CACHE_DIR/content/<sha256>, and the per-URL entry CACHE_DIR/<md5(url)> is a
+hard link to it. The link count of the content entry is therefore its
+reference count: when it drops to one, no URL refers to the body any more and
+cleanContentFiles deletes it.
+
+Hard links keep the serving path unchanged (we still serve the per-URL name)
+and let the filesystem keep the reference counts consistent across crashes.
+Linked entries share an inode and so a modification time; when each URL was
+fetched is kept in its metadata sidecar instead.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// contentDir is where bodies are stored by hash.
+func contentDir() string {
+	return filepath.Join(CACHE_DIR, "content")
+}
+
+// linkCount returns the number of hard links to a file, or 1 if it can't be determined.
+func linkCount(info os.FileInfo) int {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(st.Nlink)
+	}
+	return 1
+}
+
+// storeByContent moves a freshly downloaded body at tmp into place at fn. If a body with
+// the same hash is already stored, fn becomes another link to it and tmp is discarded;
+// otherwise tmp becomes the stored body for its hash.
+func storeByContent(tmp, fn, hash string) error {
+	content := filepath.Join(contentDir(), hash)
+	link := tmp + ".link"
+	defer os.Remove(link)
+
+	if err := os.Link(content, link); err == nil {
+		// Hard links share a modification time, so expiry goes by each URL's sidecar
+		// (see fetchedAt) rather than the body's mtime, which we leave alone.
+		log.Printf("Deduplicated %s against existing content %s", filepath.Base(fn), hash)
+		return os.Rename(link, fn)
+	}
+
+	// Not stored yet (or it was cleaned up under us); this download becomes the body.
+	if err := os.Link(tmp, content); err != nil && !os.IsExist(err) {
+		log.Printf("Failed to store content %s, caching without dedup: %s", hash, err)
+	}
+	return os.Rename(tmp, fn)
+}
+
+// cleanContentFiles removes stored bodies that no URL entry links to any more.
+func cleanContentFiles() {
+	infos, err := ioutil.ReadDir(contentDir())
+	if err != nil {
+		log.Printf("Failed to Readdir %s: %s", contentDir(), err)
+		return
+	}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || linkCount(info) > 1 {
+			continue
+		}
+		log.Printf("Removing unreferenced content: %s", info.Name())
+		if err := os.Remove(filepath.Join(contentDir(), info.Name())); err != nil {
+			log.Printf("Error removing content file %s: %s", info.Name(), err)
+		}
+	}
+}
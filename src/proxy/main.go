@@ -19,7 +19,9 @@ the same terms as Perl itself.  For a copy of the license, please reference
 package main
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"errors"
 	"flag"
 	"fmt"
@@ -34,6 +36,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"dreamwidth.org/proxy/signature"
 )
 
 // ProxyFileRequest is a structure sent down a channel to the goroutine that is listening for
@@ -50,6 +54,9 @@ type ProxyFile struct {
 	LocalPath string
 	SourceURL string
 	LastCheck time.Time
+
+	// StreamType is set instead of LocalPath for media that's streamed, not cached.
+	StreamType string
 }
 
 var (
@@ -62,6 +69,29 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "sign":
+			runSign(os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "warmup":
+			runWarmup(os.Args[2:])
+			return
+		case "stats":
+			runStats(os.Args[2:])
+			return
+		case "trace-collector":
+			runTraceCollector(os.Args[2:])
+			return
+		case "scanner-stub":
+			runScannerStub(os.Args[2:])
+			return
+		}
+	}
+
 	var port = flag.Int("port", 6250, "Port to listen on")
 	var listen = flag.String("listen", "0.0.0.0", "IP to listen on")
 	var cacheDir = flag.String("cache_dir", CACHE_DIR, "Directory to cache in")
@@ -71,34 +101,149 @@ func main() {
 	var hotlinkDomain = flag.String("hotlink_domain", HOTLINK_DOMAIN,
 		"Domain to allow hotlinking from")
 	var saltFile = flag.String("salt_file", "", "Path to salt file to use for signatures")
+	var transcode = flag.Bool("transcode", TRANSCODE,
+		"Transcode large PNG/JPEG files to WebP/AVIF for clients that accept them")
+	var transcodeMinSize = flag.Int64("transcode_min_size", TRANSCODE_MIN_SIZE,
+		"Minimum size in bytes of a file to transcode")
+	var transcodeTimeout = flag.Int("transcode_timeout", int(TRANSCODE_TIMEOUT/time.Second),
+		"Seconds an encoder may run on one file before it's killed")
+	var cwebpPath = flag.String("cwebp", "cwebp", "Path to cwebp for WebP variants (empty to disable)")
+	var avifencPath = flag.String("avifenc", "avifenc",
+		"Path to avifenc for AVIF variants (empty to disable)")
+	var adminTokenFile = flag.String("admin_token_file", "",
+		"Path to token file for administrative endpoints (disabled if empty)")
+	var warmupConcurrency = flag.Int("warmup_concurrency", WARMUP_CONCURRENCY,
+		"Maximum concurrent fetches per warmup job")
+	var scanCommand = flag.String("scan_command", "",
+		"Command to scan downloaded files with; given the path, exit 0 allows and 1 denies")
+	var scanURL = flag.String("scan_url", "", "URL of an HTTP scanning service to POST files to")
+	var scanTimeout = flag.Int("scan_timeout", int(SCAN_TIMEOUT/time.Second),
+		"How long to wait for the scanner (seconds)")
+	var scanFailOpen = flag.Bool("scan_fail_open", SCAN_FAIL_OPEN,
+		"Serve files anyway if the scanner is unavailable")
+	var denyListFile = flag.String("deny_list", "",
+		"File of denied content hashes (default: .denylist in the cache directory)")
+	var placeholderDir = flag.String("placeholder_dir", "",
+		"Directory of placeholder images named after failure classes (e.g. too_large.png)")
+	var errorCacheFor = flag.Int("error_cache_for", int(ERROR_CACHE_FOR/time.Second),
+		"How long clients may cache placeholder responses (seconds)")
+	var mediaTypes = flag.String("media_types", "",
+		"Comma-separated audio/video MIME types to proxy, e.g. audio/mpeg,video/mp4 (default none)")
+	var mediaCacheSize = flag.Int64("media_cache_size", MEDIA_CACHE_SIZE,
+		"Media up to this many bytes is cached; larger media is streamed from the origin")
+	var maxMediaSize = flag.Int64("max_media_filesize", MAXIMUM_MEDIA_SIZE,
+		"Max media filesize in bytes to proxy (0 for no limit)")
+	var otlpEndpoint = flag.String("otlp_endpoint", "",
+		"OTLP/HTTP URL to export trace spans to, e.g. http://localhost:4318/v1/traces")
+	var traceService = flag.String("trace_service", TRACE_SERVICE, "service.name to report in traces")
+	var peers = flag.String("peers", "", "Comma-separated host:port list of peer proxies")
+	var peersDNS = flag.String("peers_dns", "", "DNS name resolving to the peer proxies")
+	var peerSelf = flag.String("peer_self", "",
+		"host:port peers reach this proxy at (default: detect from interface addresses)")
 	flag.Parse()
 
 	CACHE_FOR = time.Duration(*cacheFor) * time.Second
 	CACHE_DIR = *cacheDir
 	MAXIMUM_SIZE = *maxSize
 	HOTLINK_DOMAIN = *hotlinkDomain
+	TRANSCODE = *transcode
+	TRANSCODE_MIN_SIZE = *transcodeMinSize
+	TRANSCODE_TIMEOUT = time.Duration(*transcodeTimeout) * time.Second
+	CWEBP_PATH = *cwebpPath
+	AVIFENC_PATH = *avifencPath
 
 	stat, err := os.Stat(CACHE_DIR)
 	if err != nil || !stat.Mode().IsDir() {
 		log.Fatalf("Cache directory not found: %s", CACHE_DIR)
 	}
+	if err := os.MkdirAll(contentDir(), 0755); err != nil {
+		log.Fatalf("Failed to create content directory %s: %s", contentDir(), err)
+	}
 
 	if *saltFile != "" {
-		temp_salt, err := ioutil.ReadFile(*saltFile)
+		temp_salt, err := signature.ReadSaltFile(*saltFile)
 		if err != nil {
 			log.Fatalf("Failed to get salt from file %s: %s", *saltFile, err)
 		}
-		MESSAGE_SALT = string(temp_salt)
+		MESSAGE_SALT = temp_salt
 	}
 
+	if *adminTokenFile != "" {
+		temp_token, err := ioutil.ReadFile(*adminTokenFile)
+		if err != nil {
+			log.Fatalf("Failed to get admin token from file %s: %s", *adminTokenFile, err)
+		}
+		ADMIN_TOKEN = strings.TrimSpace(string(temp_token))
+	}
+	WARMUP_CONCURRENCY = *warmupConcurrency
+
+	for _, peer := range strings.Split(*peers, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			PEERS = append(PEERS, peer)
+		}
+	}
+	PEERS_DNS = *peersDNS
+	PEER_PORT = *port
+	PEER_SELF = *peerSelf
+
+	for _, mimetype := range strings.Split(*mediaTypes, ",") {
+		if mimetype = strings.TrimSpace(mimetype); mimetype != "" {
+			MEDIA_TYPES[mimetype] = true
+		}
+	}
+	MEDIA_CACHE_SIZE = *mediaCacheSize
+	MAXIMUM_MEDIA_SIZE = *maxMediaSize
+
+	OTLP_ENDPOINT = *otlpEndpoint
+	TRACE_SERVICE = *traceService
+
+	PLACEHOLDER_DIR = *placeholderDir
+	ERROR_CACHE_FOR = time.Duration(*errorCacheFor) * time.Second
+	if err := loadPlaceholders(); err != nil {
+		log.Fatalf("Failed to load placeholders from %s: %s", PLACEHOLDER_DIR, err)
+	}
+
+	SCAN_COMMAND = *scanCommand
+	SCAN_URL = *scanURL
+	SCAN_TIMEOUT = time.Duration(*scanTimeout) * time.Second
+	SCAN_FAIL_OPEN = *scanFailOpen
+	DENY_LIST_FILE = *denyListFile
+	if DENY_LIST_FILE == "" {
+		DENY_LIST_FILE = filepath.Join(CACHE_DIR, ".denylist")
+	}
+	if err := loadDenyList(); err != nil {
+		log.Fatalf("Failed to load deny list %s: %s", DENY_LIST_FILE, err)
+	}
+	go watchDenyList()
+
 	PROXY_FILE_REQ = make(chan *ProxyFileRequest, 10)
 	go handleProxyFileRequests()
 	go cleanCacheFiles()
 
+	if peeringEnabled() {
+		go watchPeers()
+	}
+
+	if tracingEnabled() {
+		go exportSpans()
+		log.Printf("Exporting trace spans to %s", OTLP_ENDPOINT)
+	}
+
+	if TRANSCODE {
+		TRANSCODE_REQ = make(chan *TranscodeRequest, 100)
+		go handleTranscodeRequests()
+		log.Printf("Transcoding files over %d bytes to modern formats", TRANSCODE_MIN_SIZE)
+	}
+
 	log.Printf("Listening on %s:%d", *listen, *port)
 	log.Printf("Caching to %s with a max of %d nanoseconds", CACHE_DIR, CACHE_FOR)
 
 	http.HandleFunc("/robots.txt", robotsHandler)
+	if ADMIN_TOKEN != "" {
+		http.HandleFunc("/_warmup", warmupHandler)
+		http.HandleFunc("/_warmup/", warmupHandler)
+		http.HandleFunc("/_stats", statsHandler)
+	}
 	http.HandleFunc("/", defaultHandler)
 	http.ListenAndServe(fmt.Sprintf("%s:%d", *listen, *port), nil)
 }
@@ -119,7 +264,7 @@ func cleanCacheFiles() {
 			if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") {
 				continue
 			}
-			if info.ModTime().Before(time.Now().Add(-CACHE_FOR)) {
+			if fetchedAt(filepath.Join(CACHE_DIR, info.Name()), info).Before(time.Now().Add(-CACHE_FOR)) {
 				// File has expired, remove it
 				// TODO: There is maybe a race here with the handler, if someone requests this
 				// exactly when it expires and we happen to run and ... unlikely, and if this
@@ -130,6 +275,8 @@ func cleanCacheFiles() {
 				}
 			}
 		}
+
+		cleanContentFiles()
 	}
 }
 
@@ -139,21 +286,29 @@ func robotsHandler(w http.ResponseWriter, req *http.Request) {
 }
 
 func defaultHandler(w http.ResponseWriter, req *http.Request) {
+	ctx, span := startRequestSpan(req)
+	defer span.Finish()
+
 	//                        0   /  1  /   2  /   3   /  4
 	// https://proxy.dreamwidth.net/TOKEN/SOURCE/foo.com/url?arg=val
 	// SOURCE is ignored programmatically; it's only for admins
-	parts := strings.SplitN(req.URL.RequestURI(), "/", 5)
-
-	if len(parts) != 5 || parts[0] != "" {
+	token, _, orig_url, err := signature.Parse(req.URL.RequestURI())
+	if err != nil {
 		// Invalid request, treat it as a 404.
 		log.Printf("Invalid request: %s", req.URL.RequestURI())
+		span.SetAttr("proxy.result", "invalid")
 		http.NotFound(w, req)
 		return
 	}
-	token, orig_url := parts[1], "http://"+strings.Join(parts[3:], "/")
+	span.SetAttr("proxy.source_url", orig_url)
 
-	if !validSignature(token, orig_url) {
+	_, sigSpan := startSpan(ctx, "signature.check")
+	valid := validSignature(token, orig_url)
+	sigSpan.SetAttr("valid", valid)
+	sigSpan.Finish()
+	if !valid {
 		log.Printf("Invalid signature in request: %s", req.URL.RequestURI())
+		span.SetAttr("proxy.result", "bad_signature")
 		http.NotFound(w, req)
 		return
 	}
@@ -163,7 +318,8 @@ func defaultHandler(w http.ResponseWriter, req *http.Request) {
 		ref_url, err := url.Parse(referer)
 		if err != nil {
 			log.Printf("Rejecting malformed referer [%s]: %s", referer, err)
-			http.Error(w, "Malformed referer.", 400)
+			span.SetAttr("proxy.result", "bad_referer")
+			http.Error(w, "Bad Referer header.", http.StatusBadRequest)
 			return
 		}
 		host, _, err := net.SplitHostPort(ref_url.Host)
@@ -172,27 +328,58 @@ func defaultHandler(w http.ResponseWriter, req *http.Request) {
 		}
 		if !(host == HOTLINK_DOMAIN || strings.HasSuffix(host, "."+HOTLINK_DOMAIN)) {
 			log.Printf("Rejecting hotlink from: %s", referer)
-			http.Error(w, "Hotlinking is forbidden.", 403)
+			span.SetAttr("proxy.result", FailHotlinked.Name)
+			servePlaceholder(w, req, FailHotlinked)
 			return
 		}
 	}
 
-	path, err := getProxyFile(token, orig_url)
+	path, err := getProxyFile(ctx, token, orig_url, isPeerRequest(req, orig_url))
+	var stream *StreamMedia
+	if errors.As(err, &stream) {
+		span.SetAttr("proxy.result", "stream")
+		streamMedia(w, req.WithContext(ctx), orig_url, stream.MimeType)
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("%s", err), 500)
+		statErrors.Add(1)
+		span.SetAttr("proxy.result", classify(err).Name)
+		span.SetError(err)
+		servePlaceholder(w, req, classify(err))
 		return
 	}
+	span.SetAttr("proxy.result", "ok")
+
+	if TRANSCODE {
+		// Which file we serve depends on the client's Accept header, so caches in front of
+		// us need to know that.
+		w.Header().Set("Vary", "Accept")
+		queueMissingVariants(path, orig_url)
+		if variant, mimetype := pickVariant(req, path); mimetype != "" {
+			w.Header().Set("Content-Type", mimetype)
+			path = variant
+		}
+	}
 
 	http.ServeFile(w, req, path)
 }
 
 func validSignature(token, orig_url string) bool {
-	signature := fmt.Sprintf("%x", md5.Sum([]byte(MESSAGE_SALT+orig_url)))[0:12]
-	log.Printf("Signature check for %s: expect %s", orig_url, signature)
-	return token == signature
+	log.Printf("Signature check for %s: expect %s", orig_url, signature.Sign(MESSAGE_SALT, orig_url))
+	return signature.Valid(MESSAGE_SALT, token, orig_url)
 }
 
-func getProxyFile(token, orig_url string) (string, error) {
+// getProxyFile returns the local path of the cached file for orig_url, fetching it if
+// necessary. fromPeer is set for requests forwarded by another proxy task, which must go
+// straight to the origin.
+func getProxyFile(ctx context.Context, token, orig_url string, fromPeer bool) (string, error) {
+	if fromPeer && peerFetchInProgress(orig_url) {
+		// We hold the fetch lock for this URL while we ask a peer for it, so waiting
+		// for it here would deadlock; the asker falls back to the origin.
+		return "", failure(FailOrigin, errors.New("peer request loop for "+orig_url))
+	}
+
+	_, indexSpan := startSpan(ctx, "index.lookup")
 	respch := make(chan *ProxyFile)
 	PROXY_FILE_REQ <- &ProxyFileRequest{
 		Token:     token,
@@ -200,15 +387,28 @@ func getProxyFile(token, orig_url string) (string, error) {
 		Response:  respch,
 	}
 	pf := <-respch
+	indexSpan.Finish()
 
 	// We have to lock the pf before doing anything on it, to prevent clobbering other people
 	// who might be trying to use it. Start with a read lock.
+	_, lockSpan := startSpan(ctx, "lock.wait")
+	lockSpan.SetAttr("mode", "read")
 	pf.FetchLock.RLock()
+	lockSpan.Finish()
+	if pf.StreamType != "" && time.Since(pf.LastCheck) <= CACHE_FOR {
+		defer pf.FetchLock.RUnlock()
+		return "", &StreamMedia{MimeType: pf.StreamType}
+	}
 	if pf.LocalPath != "" {
 		if time.Since(pf.LastCheck) > CACHE_FOR {
 			// Do nothing. We just want to avoid returning now.
 		} else {
 			defer pf.FetchLock.RUnlock()
+			if cachedDenied(pf.LocalPath) {
+				log.Printf("Refusing cached %s: content is on the deny list", orig_url)
+				return "", ErrBlocked
+			}
+			statHits.Add(1)
 			return pf.LocalPath, nil
 		}
 	}
@@ -216,31 +416,50 @@ func getProxyFile(token, orig_url string) (string, error) {
 	// LocalPath was false, which means we want to try to upgrade to a writer and download it,
 	// since possibly we're the first person to touch it.
 	pf.FetchLock.RUnlock()
+	_, lockSpan = startSpan(ctx, "lock.wait")
+	lockSpan.SetAttr("mode", "write")
 	pf.FetchLock.Lock()
+	lockSpan.Finish()
 	defer pf.FetchLock.Unlock()
 
 	// Of course, the above is racy -- someone else might have beaten us to the lock, so let's
 	// check again and make sure we need to download it.
+	if pf.StreamType != "" && time.Since(pf.LastCheck) <= CACHE_FOR {
+		return "", &StreamMedia{MimeType: pf.StreamType}
+	}
 	if pf.LocalPath != "" {
 		if time.Since(pf.LastCheck) > CACHE_FOR {
 			log.Printf("Expiring local cache for: %s", orig_url)
 		} else {
+			if cachedDenied(pf.LocalPath) {
+				log.Printf("Refusing cached %s: content is on the deny list", orig_url)
+				return "", ErrBlocked
+			}
+			statHits.Add(1)
 			return pf.LocalPath, nil
 		}
 	}
 
 	// Needs downloading and we have the right/write lock.
-	resp, err := http.Get(orig_url)
+	statMisses.Add(1)
+	fetchCtx, fetchSpan := startSpan(ctx, "origin.fetch")
+	fetchSpan.SetKind(spanKindClient)
+	resp, err := fetchSource(fetchCtx, token, orig_url, fromPeer)
+	fetchSpan.SetError(err)
+	if resp != nil {
+		fetchSpan.SetAttr("http.status_code", resp.StatusCode)
+		fetchSpan.SetAttr("http.response_content_length", resp.ContentLength)
+	}
+	fetchSpan.Finish()
 	if err != nil {
 		log.Printf("Failed to fetch %s: %s", orig_url, err)
-		return "", err
+		return "", failure(FailOrigin, err)
 	}
 	defer resp.Body.Close()
 
-	// If it's too large, we don't want it!
-	if resp.ContentLength > MAXIMUM_SIZE {
-		log.Printf("File too large %s: %d", orig_url, resp.ContentLength)
-		return "", errors.New("File exceeds maximum allowable size")
+	if resp.StatusCode >= 400 {
+		log.Printf("Origin returned %s for %s", resp.Status, orig_url)
+		return "", failure(FailOrigin, fmt.Errorf("Origin returned %s", resp.Status))
 	}
 
 	// Make sure the file we requested is an image:
@@ -250,24 +469,55 @@ func getProxyFile(token, orig_url string) (string, error) {
 	firstblock = firstblock[:n]
 
 	// Make sure the file we requested is an image:
-	// 2. See if the content begins with an image MIME type
+	// 2. See if the content begins with an image MIME type (or allowed media type)
 	mimetype := http.DetectContentType(firstblock)
-	if !strings.HasPrefix(mimetype, "image/") {
+	media := isMediaType(mimetype)
+	if !strings.HasPrefix(mimetype, "image/") && !media {
 		log.Printf("Not an image %s: %s", orig_url, mimetype)
-		return "", errors.New("File is not a known image type")
+		return "", failure(FailNotImage, errors.New("File is not a known image type"))
 	}
 
-	// Prepare to write the file out to disk.
+	// If it's too large, we don't want it! Media has its own limit, and anything over the
+	// media cache size is streamed from the origin on each request instead of cached.
+	if media {
+		if MAXIMUM_MEDIA_SIZE > 0 && resp.ContentLength > MAXIMUM_MEDIA_SIZE {
+			log.Printf("Media too large %s: %d", orig_url, resp.ContentLength)
+			return "", failure(FailTooLarge, errors.New("File exceeds maximum allowable size"))
+		}
+		if resp.ContentLength < 0 || resp.ContentLength > MEDIA_CACHE_SIZE {
+			log.Printf("Streaming %s media %s: %d bytes", mimetype, orig_url, resp.ContentLength)
+			pf.LocalPath = ""
+			pf.StreamType = mimetype
+			pf.LastCheck = time.Now()
+			return "", &StreamMedia{MimeType: mimetype}
+		}
+	} else if resp.ContentLength > MAXIMUM_SIZE {
+		log.Printf("File too large %s: %d", orig_url, resp.ContentLength)
+		return "", failure(FailTooLarge, errors.New("File exceeds maximum allowable size"))
+	}
+
+	_, writeSpan := startSpan(ctx, "disk.write")
+	defer writeSpan.Finish()
+
+	// Prepare to write the file out to disk. We write to a temporary dotfile and only move it
+	// into place once it's complete: the final name may be a hard link shared with other
+	// URLs (see storeByContent), so it must never be written to directly.
 	fn := filepath.Join(CACHE_DIR, fmt.Sprintf("%x", md5.Sum([]byte(orig_url))))
-	file, err := os.Create(fn)
+	tmp := filepath.Join(CACHE_DIR, "."+filepath.Base(fn)+".tmp")
+	file, err := os.Create(tmp)
 	if err != nil {
-		log.Printf("Failed to open %s for writing: %s", fn, err)
+		log.Printf("Failed to open %s for writing: %s", tmp, err)
 		return "", err
 	}
 	defer file.Close()
+	defer os.Remove(tmp)
+
+	// Hash the content as we write it, so it can be checked against the deny list.
+	hasher := sha256.New()
+	out := io.MultiWriter(file, hasher)
 
 	// First write the chunk we already read from the response.
-	written1, err := io.WriteString(file, string(firstblock))
+	written1, err := io.WriteString(out, string(firstblock))
 	if err != nil {
 		log.Printf("Failed to cache file %s: %s", orig_url, err)
 		return "", err
@@ -279,18 +529,52 @@ func getProxyFile(token, orig_url string) (string, error) {
 	}
 
 	// Now write out the remainder of the response content.
-	written, err := io.Copy(file, resp.Body)
+	written, err := io.Copy(out, resp.Body)
 	if err != nil {
 		log.Printf("Failed to cache file %s: %s", orig_url, err)
 		return "", err
 	}
 
+	file.Close()
+	writeSpan.SetAttr("bytes", int64(written1)+written)
+	writeSpan.Finish()
+
+	// Give the scanner (if any) a chance to veto the file before anyone can be served it.
+	hash := fmt.Sprintf("%x", hasher.Sum(nil))
+	_, scanSpan := startSpan(ctx, "content.check")
+	err = checkContent(tmp, hash, orig_url, mimetype)
+	scanSpan.SetError(err)
+	scanSpan.Finish()
+	if err != nil {
+		// Anything we had cached for this URL before is no longer trustworthy either.
+		os.Remove(fn)
+		pf.LocalPath = ""
+		return "", err
+	}
+
+	if err := storeByContent(tmp, fn, hash); err != nil {
+		log.Printf("Failed to store %s: %s", fn, err)
+		return "", err
+	}
+
+	if err := writeMeta(fn, CacheMeta{
+		SourceURL:   orig_url,
+		ContentType: mimetype,
+		Size:        int64(written1) + written,
+		SHA256:      hash,
+		FetchedAt:   time.Now(),
+	}); err != nil {
+		log.Printf("Failed to write metadata for %s: %s", fn, err)
+	}
+
 	// Fill in the file structure, since we've got everything.
 	pf.LocalPath = fn
+	pf.StreamType = ""
 	pf.SourceURL = orig_url
 	pf.LastCheck = time.Now()
 
 	log.Printf("Cached %s to %s: %d bytes", pf.SourceURL, pf.LocalPath, int64(written1)+written)
+	queueTranscode(pf.LocalPath, pf.SourceURL, mimetype, int64(written1)+written)
 	return pf.LocalPath, nil
 }
 
@@ -309,13 +593,13 @@ func handleProxyFileRequests() {
 		// See if file is already in cache
 		fn := filepath.Join(CACHE_DIR, fmt.Sprintf("%x", md5.Sum([]byte(req.SourceURL))))
 		if info, err := os.Stat(fn); err == nil && info.Mode().IsRegular() {
-			// See if file is modified more recently than CACHE_FOR, if so return
-			if info.ModTime().After(time.Now().Add(-CACHE_FOR)) {
+			// See if file was fetched more recently than CACHE_FOR, if so return
+			if fetched := fetchedAt(fn, info); fetched.After(time.Now().Add(-CACHE_FOR)) {
 				log.Printf("Returning cached %s: %d bytes", fn, info.Size())
 				resp = &ProxyFile{
 					SourceURL: req.SourceURL,
 					LocalPath: fn,
-					LastCheck: info.ModTime(),
+					LastCheck: fetched,
 				}
 				proxyFiles[req.Token] = resp
 				req.Response <- resp
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"dreamwidth.org/proxy/signature"
+)
+
+var startIndex sync.Once
+
+// withCache gives the test an empty cache directory and a running file index. The index
+// outlives the test, so tests must not share source URLs.
+func withCache(t *testing.T) {
+	t.Helper()
+	oldDir := CACHE_DIR
+	CACHE_DIR = t.TempDir()
+	t.Cleanup(func() { CACHE_DIR = oldDir })
+	if err := os.MkdirAll(contentDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	startIndex.Do(func() {
+		PROXY_FILE_REQ = make(chan *ProxyFileRequest, 10)
+		go handleProxyFileRequests()
+	})
+}
+
+func TestRefererCheck(t *testing.T) {
+	oldDomain := HOTLINK_DOMAIN
+	defer func() { HOTLINK_DOMAIN = oldDomain }()
+	HOTLINK_DOMAIN = "dreamwidth.org"
+
+	orig := "http://foo.com/a.png"
+	path := "/" + signature.Sign(MESSAGE_SALT, orig) + "/-/foo.com/a.png"
+	for _, tt := range []struct {
+		referer string
+		status  int
+	}{
+		{"http://%zz/", http.StatusBadRequest},
+		{"http://evil.example/page", http.StatusForbidden},
+		{"https://notdreamwidth.org/", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Referer", tt.referer)
+		w := httptest.NewRecorder()
+		defaultHandler(w, req)
+		if w.Code != tt.status {
+			t.Errorf("Referer %q: status %d, want %d", tt.referer, w.Code, tt.status)
+		}
+		if cc := w.Header().Get("Cache-Control"); strings.HasPrefix(cc, "public") {
+			t.Errorf("Referer %q: Cache-Control %q lets a shared cache reuse a referer-dependent response", tt.referer, cc)
+		}
+	}
+}
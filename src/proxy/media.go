@@ -0,0 +1,168 @@
+/*
+
+media.go
+
+Opt-in proxying of audio and video. Media types must be explicitly allowed,
+and have their own size policy: small files are cached just like images,
+while anything larger (or of unknown length) is streamed straight through
+from the origin, passing Range requests along so seeking works.
+
+Streamed media is never held in full, so it is not scanned and not checked
+against the deny list (see scan.go): only its type, sniffed again from the
+first bytes of each full response, and MAXIMUM_MEDIA_SIZE, counted on the bytes
+actually sent, are enforced. Raising -media_cache_size to -max_media_filesize
+gets media of known length cached and scanned, but media of unknown length is
+always streamed, so don't allow media types where every file must be scanned.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	MEDIA_TYPES              = make(map[string]bool)
+	MEDIA_CACHE_SIZE   int64 = 20 * 1024 * 1024
+	MAXIMUM_MEDIA_SIZE int64 = 500 * 1024 * 1024
+)
+
+// StreamMedia is returned by getProxyFile for media that is streamed rather than cached.
+type StreamMedia struct {
+	MimeType string
+}
+
+func (s *StreamMedia) Error() string {
+	return fmt.Sprintf("File is %s media to be streamed, not cached", s.MimeType)
+}
+
+// isMediaType reports whether a sniffed MIME type is on the media allowlist.
+func isMediaType(mimetype string) bool {
+	if i := strings.Index(mimetype, ";"); i >= 0 {
+		mimetype = mimetype[:i]
+	}
+	return MEDIA_TYPES[strings.TrimSpace(mimetype)]
+}
+
+// streamMedia passes a request for media through to the origin, including any Range
+// headers, and copies the response to the client as it arrives. The content is not scanned;
+// a full response is sniffed again and the client is cut off past MAXIMUM_MEDIA_SIZE.
+func streamMedia(w http.ResponseWriter, req *http.Request, orig_url, mimetype string) {
+	oreq, err := http.NewRequestWithContext(req.Context(), req.Method, orig_url, nil)
+	if err != nil {
+		servePlaceholder(w, req, FailInternal)
+		return
+	}
+	for _, h := range []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"} {
+		if v := req.Header.Get(h); v != "" {
+			oreq.Header.Set(h, v)
+		}
+	}
+
+	_, span := startSpan(req.Context(), "origin.stream")
+	span.SetKind(spanKindClient)
+	defer span.Finish()
+	resp, err := http.DefaultClient.Do(oreq)
+	span.SetError(err)
+	if err != nil {
+		log.Printf("Failed to stream %s: %s", orig_url, err)
+		servePlaceholder(w, req, FailOrigin)
+		return
+	}
+	defer resp.Body.Close()
+	span.SetAttr("http.status_code", resp.StatusCode)
+
+	switch resp.StatusCode {
+	case 200, 206, 304, 416:
+	default:
+		log.Printf("Origin returned %s streaming %s", resp.Status, orig_url)
+		servePlaceholder(w, req, FailOrigin)
+		return
+	}
+
+	if MAXIMUM_MEDIA_SIZE > 0 && mediaTotalSize(resp) > MAXIMUM_MEDIA_SIZE {
+		log.Printf("Media too large %s: %d", orig_url, mediaTotalSize(resp))
+		servePlaceholder(w, req, FailTooLarge)
+		return
+	}
+
+	// The origin may not be serving what we sniffed when we decided to stream it, so
+	// check the start of a full response again before passing any of it on.
+	body := io.Reader(resp.Body)
+	if resp.StatusCode == 200 && req.Method != "HEAD" {
+		firstblock := make([]byte, 512)
+		n, err := io.ReadFull(resp.Body, firstblock)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			log.Printf("Failed to stream %s: %s", orig_url, err)
+			servePlaceholder(w, req, FailOrigin)
+			return
+		}
+		if sniffed := http.DetectContentType(firstblock[:n]); !isMediaType(sniffed) {
+			log.Printf("Not allowed media %s: now %s", orig_url, sniffed)
+			servePlaceholder(w, req, FailNotImage)
+			return
+		}
+		body = io.MultiReader(bytes.NewReader(firstblock[:n]), resp.Body)
+	}
+
+	// Always use the type we sniffed and allowed, never whatever the origin claims.
+	w.Header().Set("Content-Type", mimetype)
+	for _, h := range []string{"Content-Length", "Content-Range", "Accept-Ranges",
+		"ETag", "Last-Modified"} {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	if req.Method != "HEAD" {
+		// A chunked or lying origin can send more than its headers said, so the cap is
+		// applied to the bytes themselves.
+		if MAXIMUM_MEDIA_SIZE > 0 {
+			body = io.LimitReader(body, MAXIMUM_MEDIA_SIZE)
+		}
+		written, err := io.Copy(w, body)
+		if err != nil {
+			log.Printf("Streaming %s stopped after %d bytes: %s", orig_url, written, err)
+			return
+		}
+		if MAXIMUM_MEDIA_SIZE > 0 && written == MAXIMUM_MEDIA_SIZE {
+			var extra [1]byte
+			if n, _ := io.ReadFull(resp.Body, extra[:]); n > 0 {
+				// The headers are gone, so all we can do is cut the client off.
+				log.Printf("Media too large %s: over %d bytes streamed", orig_url, written)
+				panic(http.ErrAbortHandler)
+			}
+		}
+		log.Printf("Streamed %s: %d bytes (%s)", orig_url, written, resp.Status)
+	}
+}
+
+// mediaTotalSize returns the full size of the resource behind a (possibly partial)
+// response, or -1 if it isn't known.
+func mediaTotalSize(resp *http.Response) int64 {
+	if resp.StatusCode == 206 {
+		// Content-Range: bytes 0-1023/146515
+		cr := resp.Header.Get("Content-Range")
+		if i := strings.LastIndex(cr, "/"); i >= 0 {
+			if n, err := strconv.ParseInt(cr[i+1:], 10, 64); err == nil {
+				return n
+			}
+		}
+		return -1
+	}
+	return resp.ContentLength
+}
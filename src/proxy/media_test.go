@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// mp3 is enough of an MP3 header for http.DetectContentType.
+var mp3 = append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), bytes.Repeat([]byte{0}, 2000)...)
+
+func TestStreamMediaLimit(t *testing.T) {
+	old := MAXIMUM_MEDIA_SIZE
+	MAXIMUM_MEDIA_SIZE = 1000
+	defer func() { MAXIMUM_MEDIA_SIZE = old }()
+	MEDIA_TYPES["audio/mpeg"] = true
+	defer delete(MEDIA_TYPES, "audio/mpeg")
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Flushing before the end forces a chunked response with no Content-Length.
+		w.Write(mp3[:100])
+		w.(http.Flusher).Flush()
+		w.Write(mp3[100:])
+	}))
+	defer origin.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		streamMedia(w, req, origin.URL+req.URL.Path, "audio/mpeg")
+	}))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil || int64(len(body)) > MAXIMUM_MEDIA_SIZE {
+		t.Errorf("read %d bytes, err %v; want the stream cut off at %d", len(body), err, MAXIMUM_MEDIA_SIZE)
+	}
+}
+
+func TestStreamMediaSniffed(t *testing.T) {
+	MEDIA_TYPES["audio/mpeg"] = true
+	defer delete(MEDIA_TYPES, "audio/mpeg")
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("<html><script>alert(1)</script></html>"))
+	}))
+	defer origin.Close()
+
+	w := httptest.NewRecorder()
+	streamMedia(w, httptest.NewRequest("GET", "/x", nil), origin.URL, "audio/mpeg")
+	if bytes.Contains(w.Body.Bytes(), []byte("<script>")) {
+		t.Errorf("streamed content that is no longer media: %q", w.Body.String())
+	}
+}
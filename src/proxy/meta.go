@@ -0,0 +1,73 @@
+/*
+
+meta.go
+
+Sidecar metadata for cached files. Next to each cached body "<md5>" we keep
+"<md5>.json" describing where it came from, so the cache can be inspected
+without access to the logs.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MetaSuffix is appended to a cached file's name to get its sidecar's name.
+const MetaSuffix = ".json"
+
+// CacheMeta is the sidecar metadata stored alongside a cached file.
+type CacheMeta struct {
+	SourceURL   string    `json:"source_url"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// writeMeta stores the sidecar for localPath. It's written to a dotfile and renamed into
+// place so readers never see a partial sidecar.
+func writeMeta(localPath string, meta CacheMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	fn := localPath + MetaSuffix
+	tmp := filepath.Join(filepath.Dir(fn), "."+filepath.Base(fn)+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+// fetchedAt returns when the cached copy at localPath was fetched from the origin. Bodies
+// are hard links shared by every URL with the same content, so their modification time
+// isn't per URL; the sidecar's FetchedAt is. Files without a sidecar fall back to the
+// modification time in info.
+func fetchedAt(localPath string, info os.FileInfo) time.Time {
+	if meta, err := readMeta(localPath); err == nil && !meta.FetchedAt.IsZero() {
+		return meta.FetchedAt
+	}
+	return info.ModTime()
+}
+
+// readMeta loads the sidecar for localPath.
+func readMeta(localPath string) (CacheMeta, error) {
+	var meta CacheMeta
+	data, err := os.ReadFile(localPath + MetaSuffix)
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
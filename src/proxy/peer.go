@@ -0,0 +1,270 @@
+/*
+
+peer.go
+
+Optional peer-to-peer cache sharing between proxy tasks. Peers come from a
+static list and/or a DNS name, and a consistent hash ring assigns every cache
+key an owning peer. On a miss we ask the owner first (which fetches from the
+origin itself if it has to), so each popular image is fetched from the origin
+by one task instead of all of them.
+
+Requests between peers use the ordinary signed proxy paths, since all tasks
+share the salt, and carry PEER_HEADER so the owner never forwards them again.
+The header's value is an HMAC of the source URL keyed with the salt, so a
+client can't set it to skip forwarding and the fetch lock.
+A peer request for a URL we are ourselves asking a peer for fails at once:
+it's either our own request come back (self-detection missed) or a peer with
+a different view of the ring asking us, and waiting on the fetch lock would
+deadlock both until the timeout.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PEER_HEADER marks a request as coming from another proxy task; see peerHeaderValue.
+const PEER_HEADER = "X-Dreamwidth-Proxy-Peer"
+
+// peerVirtualNodes is how many points each peer gets on the ring; more points spread keys
+// more evenly when peers join or leave.
+const peerVirtualNodes = 100
+
+// PeerRing is a consistent hash ring over a set of peer addresses ("host:port").
+type PeerRing struct {
+	Peers  []string
+	points []uint32
+	owners map[uint32]string
+	self   map[string]bool // peers that are this task, worked out when the ring is built
+}
+
+var (
+	PEERS         []string
+	PEERS_DNS     string
+	PEER_PORT     int
+	PEER_SELF     string
+	PEER_TIMEOUT  time.Duration = 10 * time.Second
+	PEER_INTERVAL time.Duration = 30 * time.Second
+
+	peerRing atomic.Pointer[PeerRing]
+
+	// PEER_TIMEOUT bounds connecting to a peer and waiting for its response headers, not
+	// the whole transfer, so large files can take as long as they need.
+	peerClient = &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: PEER_TIMEOUT}).DialContext,
+		ResponseHeaderTimeout: PEER_TIMEOUT,
+		MaxIdleConnsPerHost:   10,
+	}}
+
+	// peerFetches holds the source URLs we're currently asking a peer for.
+	peerFetches sync.Map
+)
+
+// NewPeerRing builds a ring over the given peers.
+func NewPeerRing(peers []string) *PeerRing {
+	ring := &PeerRing{Peers: peers, owners: make(map[uint32]string), self: make(map[string]bool)}
+	for _, peer := range peers {
+		ring.self[peer] = isSelf(peer)
+		for i := 0; i < peerVirtualNodes; i++ {
+			point := crc32.ChecksumIEEE([]byte(peer + "#" + strconv.Itoa(i)))
+			ring.points = append(ring.points, point)
+			ring.owners[point] = peer
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring
+}
+
+// Owner returns the peer responsible for a cache key, or "" if the ring is empty.
+func (ring *PeerRing) Owner(key string) string {
+	if ring == nil || len(ring.points) == 0 {
+		return ""
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(ring.points), func(i int) bool { return ring.points[i] >= h })
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.owners[ring.points[i]]
+}
+
+// IsSelf reports whether peer is this task.
+func (ring *PeerRing) IsSelf(peer string) bool {
+	return ring != nil && ring.self[peer]
+}
+
+// peeringEnabled reports whether any peers are configured.
+func peeringEnabled() bool {
+	return len(PEERS) > 0 || PEERS_DNS != ""
+}
+
+// refreshPeers rebuilds the ring from the static list and the DNS name.
+func refreshPeers() {
+	seen := make(map[string]bool)
+	var peers []string
+	add := func(peer string) {
+		if !seen[peer] {
+			seen[peer] = true
+			peers = append(peers, peer)
+		}
+	}
+	for _, peer := range PEERS {
+		add(peer)
+	}
+	if PEERS_DNS != "" {
+		addrs, err := net.LookupHost(PEERS_DNS)
+		if err != nil {
+			// Keep the ring we have rather than dropping to no peers on a DNS blip.
+			log.Printf("Failed to look up peers from %s: %s", PEERS_DNS, err)
+			if peerRing.Load() != nil {
+				return
+			}
+		}
+		for _, addr := range addrs {
+			add(net.JoinHostPort(addr, strconv.Itoa(PEER_PORT)))
+		}
+	}
+	sort.Strings(peers)
+
+	if old := peerRing.Load(); old == nil || strings.Join(old.Peers, ",") != strings.Join(peers, ",") {
+		log.Printf("Peer ring: %s", strings.Join(peers, ", "))
+	}
+	peerRing.Store(NewPeerRing(peers))
+}
+
+// watchPeers keeps the ring up to date with DNS.
+func watchPeers() {
+	refreshPeers()
+	if PEERS_DNS == "" {
+		return
+	}
+	timer := time.NewTicker(PEER_INTERVAL)
+	defer timer.Stop()
+	for range timer.C {
+		refreshPeers()
+	}
+}
+
+// isSelf reports whether a peer address refers to this task. With -peer_self that's an
+// exact match; otherwise we resolve the peer's host and compare against our own interface
+// addresses and port.
+func isSelf(peer string) bool {
+	if PEER_SELF != "" {
+		return peer == PEER_SELF
+	}
+	host, port, err := net.SplitHostPort(peer)
+	if err != nil || port != strconv.Itoa(PEER_PORT) {
+		return false
+	}
+	hostIPs, err := net.LookupIP(host)
+	if err != nil {
+		log.Printf("Failed to resolve peer %s: %s", peer, err)
+		return false
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		for _, ip := range hostIPs {
+			if ipnet.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// peerHeaderValue is the PEER_HEADER value for a peer request for orig_url: an HMAC of
+// the URL keyed with the salt every task shares, so only another task can produce it.
+func peerHeaderValue(orig_url string) string {
+	mac := hmac.New(sha256.New, []byte(MESSAGE_SALT))
+	mac.Write([]byte(PEER_HEADER + "\x00" + orig_url))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// isPeerRequest reports whether req came from another proxy task, i.e. carries a valid
+// PEER_HEADER for orig_url. A missing or forged header makes it an ordinary request.
+func isPeerRequest(req *http.Request, orig_url string) bool {
+	value := req.Header.Get(PEER_HEADER)
+	return value != "" && hmac.Equal([]byte(value), []byte(peerHeaderValue(orig_url)))
+}
+
+// peerFetchInProgress reports whether we're asking a peer for orig_url right now.
+func peerFetchInProgress(orig_url string) bool {
+	_, ok := peerFetches.Load(orig_url)
+	return ok
+}
+
+// fetchFromPeer asks the peer that owns orig_url for it. It returns nil if we own the key
+// ourselves, peering is off, or the peer couldn't help; the caller then goes to the origin.
+func fetchFromPeer(ctx context.Context, token, orig_url string) *http.Response {
+	ring := peerRing.Load()
+	owner := ring.Owner(fmt.Sprintf("%x", md5.Sum([]byte(orig_url))))
+	if owner == "" || ring.IsSelf(owner) {
+		return nil
+	}
+
+	peerURL := "http://" + owner + "/" + token + "/-/" + strings.TrimPrefix(orig_url, "http://")
+	req, err := http.NewRequestWithContext(ctx, "GET", peerURL, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set(PEER_HEADER, peerHeaderValue(orig_url))
+	injectTraceparent(ctx, req)
+	// Only until the headers arrive: by then the peer has the file, so it can't be
+	// waiting on our lock.
+	peerFetches.Store(orig_url, true)
+	resp, err := peerClient.Do(req)
+	peerFetches.Delete(orig_url)
+	if err != nil {
+		log.Printf("Peer %s failed for %s: %s", owner, orig_url, err)
+		return nil
+	}
+	if resp.StatusCode != 200 {
+		log.Printf("Peer %s returned %s for %s", owner, resp.Status, orig_url)
+		resp.Body.Close()
+		return nil
+	}
+	log.Printf("Fetching %s from peer %s", orig_url, owner)
+	return resp
+}
+
+// fetchSource gets the body of orig_url, from its owning peer if possible and otherwise
+// from the origin. Requests that came from a peer always go to the origin.
+func fetchSource(ctx context.Context, token, orig_url string, fromPeer bool) (*http.Response, error) {
+	if peeringEnabled() && !fromPeer {
+		if resp := fetchFromPeer(ctx, token, orig_url); resp != nil {
+			return resp, nil
+		}
+	}
+	return http.Get(orig_url)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// withPeers makes peers the ring for the rest of the test, with self as this task.
+func withPeers(t *testing.T, self string, peers ...string) {
+	t.Helper()
+	oldSelf, oldRing := PEER_SELF, peerRing.Load()
+	PEER_SELF = self
+	peerRing.Store(NewPeerRing(peers))
+	t.Cleanup(func() {
+		PEER_SELF = oldSelf
+		peerRing.Store(oldRing)
+	})
+}
+
+func TestPeerRingOwner(t *testing.T) {
+	ring := NewPeerRing([]string{"10.0.0.1:6250", "10.0.0.2:6250", "10.0.0.3:6250"})
+	owners := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		owner := ring.Owner(key)
+		if owner != ring.Owner(key) {
+			t.Fatalf("Owner(%q) isn't stable", key)
+		}
+		owners[owner]++
+	}
+	if len(owners) != 3 {
+		t.Errorf("keys went to %d peers, want 3: %v", len(owners), owners)
+	}
+
+	// Dropping a peer only moves the keys it owned.
+	smaller := NewPeerRing([]string{"10.0.0.1:6250", "10.0.0.2:6250"})
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if before := ring.Owner(key); before != "10.0.0.3:6250" && smaller.Owner(key) != before {
+			t.Errorf("key %q moved from %s to %s", key, before, smaller.Owner(key))
+		}
+	}
+
+	if (*PeerRing)(nil).Owner("x") != "" || NewPeerRing(nil).Owner("x") != "" {
+		t.Error("an empty ring has an owner")
+	}
+}
+
+func TestIsSelfResolvesHostnames(t *testing.T) {
+	oldSelf, oldPort := PEER_SELF, PEER_PORT
+	defer func() { PEER_SELF, PEER_PORT = oldSelf, oldPort }()
+	PEER_SELF, PEER_PORT = "", 6250
+
+	for peer, want := range map[string]bool{
+		"127.0.0.1:6250":   true,
+		"localhost:6250":   true,
+		"localhost:6251":   false,
+		"192.0.2.1:6250":   false,
+		"no-port-for-this": false,
+	} {
+		if got := isSelf(peer); got != want {
+			t.Errorf("isSelf(%q) = %v, want %v", peer, got, want)
+		}
+	}
+
+	PEER_SELF = "proxy-a:6250"
+	if !isSelf("proxy-a:6250") || isSelf("127.0.0.1:6250") {
+		t.Error("isSelf doesn't go by -peer_self when it's set")
+	}
+}
+
+func TestFetchFromPeer(t *testing.T) {
+	var gotPath, gotHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotPath, gotHeader = req.URL.RequestURI(), req.Header.Get(PEER_HEADER)
+		if strings.Contains(req.URL.Path, "missing") {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write([]byte("peer body"))
+	}))
+	defer srv.Close()
+	peer := strings.TrimPrefix(srv.URL, "http://")
+	withPeers(t, "self:6250", peer)
+
+	resp := fetchFromPeer(context.Background(), "tok", "http://foo.com/a.png?x=1")
+	if resp == nil {
+		t.Fatal("fetchFromPeer returned nil")
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "peer body" {
+		t.Errorf("body = %q", body)
+	}
+	if gotPath != "/tok/-/foo.com/a.png?x=1" || gotHeader != peerHeaderValue("http://foo.com/a.png?x=1") {
+		t.Errorf("peer got %s with %s %q", gotPath, PEER_HEADER, gotHeader)
+	}
+	if peerFetchInProgress("http://foo.com/a.png?x=1") {
+		t.Error("peer fetch still marked in progress")
+	}
+
+	if resp := fetchFromPeer(context.Background(), "tok", "http://foo.com/missing.png"); resp != nil {
+		resp.Body.Close()
+		t.Error("fetchFromPeer returned a 404 response")
+	}
+}
+
+func TestFetchFromPeerSkipsSelf(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+	peer := strings.TrimPrefix(srv.URL, "http://")
+	withPeers(t, peer, peer)
+
+	if resp := fetchFromPeer(context.Background(), "tok", "http://foo.com/a.png"); resp != nil {
+		resp.Body.Close()
+		t.Error("fetchFromPeer asked itself")
+	}
+	if called {
+		t.Error("the peer was called")
+	}
+}
+
+func TestFetchFromPeerUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := l.Addr().String()
+	l.Close()
+	withPeers(t, "self:6250", peer)
+
+	if resp := fetchFromPeer(context.Background(), "tok", "http://foo.com/a.png"); resp != nil {
+		resp.Body.Close()
+		t.Error("fetchFromPeer returned a response from a closed port")
+	}
+}
+
+func TestPeerLoopFailsFast(t *testing.T) {
+	// A peer request that comes back to us while we're asking a peer for the same URL
+	// must not wait for the fetch lock we hold.
+	released := make(chan struct{})
+	var loopStatus int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, err := getProxyFile(req.Context(), "tok", "http://foo.com/loop.png", isPeerRequest(req, "http://foo.com/loop.png"))
+		loopStatus = classify(err).Status
+		w.WriteHeader(loopStatus)
+		close(released)
+	}))
+	defer srv.Close()
+	withPeers(t, "self:6250", strings.TrimPrefix(srv.URL, "http://"))
+
+	if resp := fetchFromPeer(context.Background(), "tok", "http://foo.com/loop.png"); resp != nil {
+		resp.Body.Close()
+		t.Error("fetchFromPeer returned the looped response")
+	}
+	<-released
+	if loopStatus != http.StatusBadGateway {
+		t.Errorf("looped request got status %d, want %d", loopStatus, http.StatusBadGateway)
+	}
+}
+
+func TestIsPeerRequest(t *testing.T) {
+	orig := "http://foo.com/a.png"
+	for _, tt := range []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"1", false},
+		{peerHeaderValue("http://foo.com/other.png"), false},
+		{peerHeaderValue(orig), true},
+	} {
+		req := httptest.NewRequest("GET", "/tok/-/foo.com/a.png", nil)
+		if tt.header != "" {
+			req.Header.Set(PEER_HEADER, tt.header)
+		}
+		if got := isPeerRequest(req, orig); got != tt.want {
+			t.Errorf("%s: %q: isPeerRequest = %v, want %v", PEER_HEADER, tt.header, got, tt.want)
+		}
+	}
+}
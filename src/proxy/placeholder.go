@@ -0,0 +1,139 @@
+/*
+
+placeholder.go
+
+User-facing failure responses. When we can't serve a file, the journal page
+still shows an image, so rather than an error page we serve a placeholder
+image for the class of failure, with a suitable status code and a short
+cache lifetime. Internal error details only ever go to the log.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// FailureClass is a kind of failure we show the user a distinct placeholder for.
+type FailureClass struct {
+	Name   string
+	Status int
+}
+
+var (
+	FailTooLarge  = &FailureClass{"too_large", http.StatusRequestEntityTooLarge}
+	FailNotImage  = &FailureClass{"not_image", http.StatusUnsupportedMediaType}
+	FailOrigin    = &FailureClass{"origin_unavailable", http.StatusBadGateway}
+	FailBlocked   = &FailureClass{"blocked", http.StatusForbidden}
+	FailHotlinked = &FailureClass{"hotlinked", http.StatusForbidden}
+	FailInternal  = &FailureClass{"error", http.StatusInternalServerError}
+
+	failureClasses = []*FailureClass{
+		FailTooLarge, FailNotImage, FailOrigin, FailBlocked, FailHotlinked, FailInternal,
+	}
+)
+
+// ProxyError is an error from fetching a file, tagged with its failure class.
+type ProxyError struct {
+	Class *FailureClass
+	Err   error
+}
+
+func (e *ProxyError) Error() string { return e.Err.Error() }
+func (e *ProxyError) Unwrap() error { return e.Err }
+
+// failure tags an error with a failure class.
+func failure(class *FailureClass, err error) error {
+	return &ProxyError{Class: class, Err: err}
+}
+
+// classify returns the failure class for an error from getProxyFile.
+func classify(err error) *FailureClass {
+	var perr *ProxyError
+	if errors.As(err, &perr) {
+		return perr.Class
+	}
+	if errors.Is(err, ErrBlocked) {
+		return FailBlocked
+	}
+	return FailInternal
+}
+
+// Placeholder is an image served in place of a file we couldn't proxy.
+type Placeholder struct {
+	ContentType string
+	Data        []byte
+}
+
+var (
+	PLACEHOLDER_DIR string
+	ERROR_CACHE_FOR time.Duration = 5 * time.Minute
+	placeholders                  = make(map[string]Placeholder)
+	// A 1x1 transparent GIF, used for any class without a configured placeholder.
+	defaultPlaceholder = Placeholder{
+		ContentType: "image/gif",
+		Data: []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\x00\x00\x00" +
+			"!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;"),
+	}
+)
+
+// loadPlaceholders reads PLACEHOLDER_DIR/<class>.<ext> (e.g. too_large.png) for each
+// failure class.
+func loadPlaceholders() error {
+	if PLACEHOLDER_DIR == "" {
+		return nil
+	}
+	for _, class := range failureClasses {
+		matches, _ := filepath.Glob(filepath.Join(PLACEHOLDER_DIR, class.Name+".*"))
+		if len(matches) == 0 {
+			continue
+		}
+		data, err := ioutil.ReadFile(matches[0])
+		if err != nil {
+			return err
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(matches[0]))
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		placeholders[class.Name] = Placeholder{ContentType: contentType, Data: data}
+		log.Printf("Loaded %s placeholder from %s", class.Name, matches[0])
+	}
+	return nil
+}
+
+// servePlaceholder responds with the placeholder for a failure class.
+func servePlaceholder(w http.ResponseWriter, req *http.Request, class *FailureClass) {
+	ph, ok := placeholders[class.Name]
+	if !ok {
+		ph = defaultPlaceholder
+	}
+	w.Header().Set("Content-Type", ph.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(ph.Data)))
+	if class == FailHotlinked {
+		// Whether a request is a hotlink depends on its Referer, so a shared cache must
+		// not hand this to same-site viewers of the same URL.
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ERROR_CACHE_FOR/time.Second)))
+	}
+	w.Header().Set("X-Proxy-Error", class.Name)
+	w.WriteHeader(class.Status)
+	if req.Method != "HEAD" {
+		w.Write(ph.Data)
+	}
+}
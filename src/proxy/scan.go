@@ -0,0 +1,290 @@
+/*
+
+scan.go
+
+Optional content scanning of downloaded files before they are cached. A scanner
+is either an external command (given the file path; exit 0 allows, exit 1
+denies) or a local HTTP service that is POSTed the file body and answers with
+a JSON verdict. Denied content is deleted, never served, and its SHA-256 is
+recorded in a deny list so it's refused without scanning next time. Cache hits
+are checked against the deny list too, so content denied after it was cached
+(under another URL, or by editing the deny list file) stops being served.
+Streamed media is never held in full and so is neither scanned nor checked
+against the deny list; see media.go.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScanVerdict is the answer a scanning service returns for a file.
+type ScanVerdict struct {
+	Verdict string `json:"verdict"` // "allow" or "deny"
+	Reason  string `json:"reason,omitempty"`
+}
+
+var (
+	SCAN_COMMAND   string
+	SCAN_URL       string
+	SCAN_TIMEOUT   time.Duration = 30 * time.Second
+	SCAN_FAIL_OPEN bool          = false
+	DENY_LIST_FILE string
+
+	// ErrBlocked is returned for content that a scanner denied, or that is on the deny list.
+	ErrBlocked = errors.New("File has been blocked")
+
+	denyListLock    sync.RWMutex
+	denyList        = make(map[string]bool)
+	denyListModTime time.Time // of DENY_LIST_FILE when it was last loaded
+)
+
+// scanningEnabled reports whether any scanner is configured.
+func scanningEnabled() bool {
+	return SCAN_COMMAND != "" || SCAN_URL != ""
+}
+
+// loadDenyList reads the deny list file into memory, replacing whatever was loaded before.
+// Each line starts with a hex SHA-256; anything after the first space is a note for humans.
+func loadDenyList() error {
+	if DENY_LIST_FILE == "" {
+		return nil
+	}
+	file, err := os.Open(DENY_LIST_FILE)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			loaded[fields[0]] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	denyListLock.Lock()
+	defer denyListLock.Unlock()
+	denyList = loaded
+	denyListModTime = info.ModTime()
+	log.Printf("Loaded %d entries from deny list %s", len(denyList), DENY_LIST_FILE)
+	return nil
+}
+
+// watchDenyList reloads the deny list whenever DENY_LIST_FILE changes, so hashes added to
+// it by hand take effect without a restart.
+func watchDenyList() {
+	for range time.Tick(30 * time.Second) {
+		info, err := os.Stat(DENY_LIST_FILE)
+		if err != nil {
+			continue
+		}
+		denyListLock.RLock()
+		changed := !info.ModTime().Equal(denyListModTime)
+		denyListLock.RUnlock()
+		if changed {
+			if err := loadDenyList(); err != nil {
+				log.Printf("Failed to reload deny list %s: %s", DENY_LIST_FILE, err)
+			}
+		}
+	}
+}
+
+// isDenied reports whether a content hash is on the deny list.
+func isDenied(hash string) bool {
+	denyListLock.RLock()
+	defer denyListLock.RUnlock()
+	return denyList[hash]
+}
+
+// cachedDenied reports whether the cached file at localPath holds content that is on the
+// deny list, going by the hash in its sidecar. Content can be denied after it was cached:
+// the scanner may deny the same bytes fetched from another URL, or the hash may be added
+// to DENY_LIST_FILE by hand. Files cached before sidecars existed have no hash to check.
+func cachedDenied(localPath string) bool {
+	denyListLock.RLock()
+	empty := len(denyList) == 0
+	denyListLock.RUnlock()
+	if empty {
+		return false
+	}
+	meta, err := readMeta(localPath)
+	return err == nil && meta.SHA256 != "" && isDenied(meta.SHA256)
+}
+
+// recordDenied adds a content hash to the deny list, in memory and on disk.
+func recordDenied(hash, orig_url, reason string) {
+	denyListLock.Lock()
+	defer denyListLock.Unlock()
+	if denyList[hash] {
+		return
+	}
+	denyList[hash] = true
+
+	if DENY_LIST_FILE == "" {
+		return
+	}
+	file, err := os.OpenFile(DENY_LIST_FILE, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Failed to open deny list %s: %s", DENY_LIST_FILE, err)
+		return
+	}
+	defer file.Close()
+	fmt.Fprintf(file, "%s %s %s %s\n", hash, time.Now().UTC().Format(time.RFC3339),
+		orig_url, strings.ReplaceAll(reason, "\n", " "))
+}
+
+// checkContent decides whether a downloaded file may be cached and served. hash is the
+// hex SHA-256 of the file's content. A nil return means the file is allowed; ErrBlocked
+// means it must be discarded.
+func checkContent(path, hash, orig_url, mimetype string) error {
+	if isDenied(hash) {
+		log.Printf("Refusing %s: content %s is on the deny list", orig_url, hash)
+		return ErrBlocked
+	}
+	if !scanningEnabled() {
+		return nil
+	}
+
+	allowed, reason, err := runScanner(path, hash, orig_url, mimetype)
+	if err != nil {
+		log.Printf("Scanner failed for %s: %s", orig_url, err)
+		if SCAN_FAIL_OPEN {
+			return nil
+		}
+		return errors.New("Content scanner unavailable")
+	}
+	if !allowed {
+		log.Printf("Scanner denied %s (%s): %s", orig_url, hash, reason)
+		recordDenied(hash, orig_url, reason)
+		return ErrBlocked
+	}
+	return nil
+}
+
+// runScanner asks the configured scanner about a file.
+func runScanner(path, hash, orig_url, mimetype string) (allowed bool, reason string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SCAN_TIMEOUT)
+	defer cancel()
+
+	if SCAN_COMMAND != "" {
+		fields := strings.Fields(SCAN_COMMAND)
+		cmd := exec.CommandContext(ctx, fields[0], append(fields[1:], path)...)
+		cmd.Env = append(os.Environ(),
+			"PROXY_SOURCE_URL="+orig_url,
+			"PROXY_CONTENT_SHA256="+hash,
+			"PROXY_CONTENT_TYPE="+mimetype,
+		)
+		out, err := cmd.Output()
+		reason = strings.TrimSpace(string(out))
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return false, reason, nil
+		} else if err != nil {
+			return false, "", err
+		}
+		return true, reason, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, "", err
+	}
+	defer file.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", SCAN_URL, file)
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", mimetype)
+	req.Header.Set("X-Source-URL", orig_url)
+	req.Header.Set("X-Content-SHA256", hash)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return false, "", fmt.Errorf("scanner returned %s", resp.Status)
+	}
+
+	var verdict ScanVerdict
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return false, "", fmt.Errorf("parsing scanner response: %s", err)
+	}
+	switch verdict.Verdict {
+	case "allow":
+		return true, verdict.Reason, nil
+	case "deny":
+		return false, verdict.Reason, nil
+	}
+	return false, "", fmt.Errorf("unknown scanner verdict %q", verdict.Verdict)
+}
+
+// runScannerStub implements `proxy scanner-stub`, a stand-in scanning service for testing
+// the scan flow locally. It denies files whose SHA-256 is in -deny or whose content
+// contains -deny_marker, and allows everything else.
+func runScannerStub(args []string) {
+	fs := flag.NewFlagSet("scanner-stub", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:6251", "Address to listen on")
+	deny := fs.String("deny", "", "Comma-separated SHA-256 hashes to deny")
+	marker := fs.String("deny_marker", "", "Deny any file containing this string")
+	fs.Parse(args)
+
+	denied := make(map[string]bool)
+	for _, hash := range strings.Split(*deny, ",") {
+		if hash = strings.TrimSpace(hash); hash != "" {
+			denied[hash] = true
+		}
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		verdict := ScanVerdict{Verdict: "allow"}
+		if denied[req.Header.Get("X-Content-SHA256")] {
+			verdict = ScanVerdict{Verdict: "deny", Reason: "hash on stub deny list"}
+		} else if *marker != "" && strings.Contains(string(body), *marker) {
+			verdict = ScanVerdict{Verdict: "deny", Reason: "content contains deny marker"}
+		}
+		log.Printf("Scanned %s (%d bytes): %s", req.Header.Get("X-Source-URL"), len(body), verdict.Verdict)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(verdict)
+	})
+
+	log.Printf("Scanner stub listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withScanner points the scan hook at a test scanning service for the rest of the test.
+func withScanner(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	oldURL, oldCmd, oldOpen, oldFile := SCAN_URL, SCAN_COMMAND, SCAN_FAIL_OPEN, DENY_LIST_FILE
+	SCAN_URL, SCAN_COMMAND, SCAN_FAIL_OPEN = srv.URL, "", false
+	DENY_LIST_FILE = filepath.Join(t.TempDir(), "denylist")
+	t.Cleanup(func() {
+		srv.Close()
+		SCAN_URL, SCAN_COMMAND, SCAN_FAIL_OPEN, DENY_LIST_FILE = oldURL, oldCmd, oldOpen, oldFile
+		denyListLock.Lock()
+		denyList = make(map[string]bool)
+		denyListLock.Unlock()
+	})
+}
+
+func writeScanFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckContentClean(t *testing.T) {
+	var got struct{ body, url, hash, mimetype string }
+	withScanner(t, func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		got.body, got.url = string(body), req.Header.Get("X-Source-URL")
+		got.hash, got.mimetype = req.Header.Get("X-Content-SHA256"), req.Header.Get("Content-Type")
+		json.NewEncoder(w).Encode(ScanVerdict{Verdict: "allow"})
+	})
+
+	path := writeScanFile(t, "clean image")
+	if err := checkContent(path, "aaaa", "http://foo.com/a.png", "image/png"); err != nil {
+		t.Fatalf("checkContent: %v", err)
+	}
+	if got.body != "clean image" || got.url != "http://foo.com/a.png" || got.hash != "aaaa" || got.mimetype != "image/png" {
+		t.Errorf("scanner was sent %+v", got)
+	}
+	if isDenied("aaaa") {
+		t.Error("clean content was added to the deny list")
+	}
+}
+
+func TestCheckContentInfected(t *testing.T) {
+	scans := 0
+	withScanner(t, func(w http.ResponseWriter, req *http.Request) {
+		scans++
+		json.NewEncoder(w).Encode(ScanVerdict{Verdict: "deny", Reason: "test signature"})
+	})
+
+	path := writeScanFile(t, "infected image")
+	if err := checkContent(path, "bbbb", "http://foo.com/b.png", "image/png"); err != ErrBlocked {
+		t.Fatalf("checkContent = %v, want ErrBlocked", err)
+	}
+	if !isDenied("bbbb") {
+		t.Error("denied content isn't on the deny list")
+	}
+	data, err := os.ReadFile(DENY_LIST_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "bbbb ") || !strings.Contains(string(data), "test signature") {
+		t.Errorf("deny list file = %q", data)
+	}
+
+	// The same content again is refused from the deny list without a scan.
+	if err := checkContent(path, "bbbb", "http://bar.com/b.png", "image/png"); err != ErrBlocked {
+		t.Fatalf("second checkContent = %v, want ErrBlocked", err)
+	}
+	if scans != 1 {
+		t.Errorf("scanner called %d times, want 1", scans)
+	}
+}
+
+func TestCheckContentScannerFailure(t *testing.T) {
+	withScanner(t, func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "scanner broke", 500)
+	})
+	path := writeScanFile(t, "some image")
+
+	err := checkContent(path, "cccc", "http://foo.com/c.png", "image/png")
+	if err == nil || err == ErrBlocked {
+		t.Fatalf("checkContent = %v, want a scanner error", err)
+	}
+	if isDenied("cccc") {
+		t.Error("content was denied because the scanner failed")
+	}
+
+	SCAN_FAIL_OPEN = true
+	if err := checkContent(path, "cccc", "http://foo.com/c.png", "image/png"); err != nil {
+		t.Errorf("checkContent with SCAN_FAIL_OPEN = %v, want nil", err)
+	}
+}
+
+func TestCheckContentBadVerdict(t *testing.T) {
+	withScanner(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"verdict": "maybe"}`))
+	})
+	path := writeScanFile(t, "some image")
+	if err := checkContent(path, "dddd", "http://foo.com/d.png", "image/png"); err == nil || err == ErrBlocked {
+		t.Errorf("checkContent = %v, want a scanner error", err)
+	}
+}
+
+func TestCachedContentDenied(t *testing.T) {
+	withCache(t)
+	withScanner(t, func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(ScanVerdict{Verdict: "allow"})
+	})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n" + strings.Repeat("d", 1000)))
+	}))
+	defer origin.Close()
+
+	// Two URLs with the same content share one file; denying it must stop both.
+	first, err := getProxyFile(context.Background(), "tok-denied", origin.URL+"/one.png", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getProxyFile(context.Background(), "tok-denied", origin.URL+"/two.png", false); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := readMeta(first)
+	if err != nil || meta.SHA256 == "" {
+		t.Fatalf("readMeta = %+v, %v", meta, err)
+	}
+
+	recordDenied(meta.SHA256, origin.URL+"/elsewhere.png", "test")
+	for _, u := range []string{"/one.png", "/two.png"} {
+		if _, err := getProxyFile(context.Background(), "tok-denied", origin.URL+u, false); err != ErrBlocked {
+			t.Errorf("cache hit for %s after its content was denied: err = %v, want ErrBlocked", u, err)
+		}
+	}
+}
+
+func TestLoadDenyListReplaces(t *testing.T) {
+	withScanner(t, func(w http.ResponseWriter, req *http.Request) {})
+	if err := os.WriteFile(DENY_LIST_FILE, []byte("aaaa first\nbbbb second\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadDenyList(); err != nil {
+		t.Fatal(err)
+	}
+	if !isDenied("aaaa") || !isDenied("bbbb") {
+		t.Fatal("entries weren't loaded")
+	}
+
+	// An entry removed by hand is dropped on reload.
+	if err := os.WriteFile(DENY_LIST_FILE, []byte("bbbb second\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadDenyList(); err != nil {
+		t.Fatal(err)
+	}
+	if isDenied("aaaa") || !isDenied("bbbb") {
+		t.Errorf("after reload, aaaa denied = %v, bbbb denied = %v", isDenied("aaaa"), isDenied("bbbb"))
+	}
+}
@@ -0,0 +1,97 @@
+/*
+
+signature/signature.go
+
+Package signature implements the token format used by the Dreamwidth content
+proxy. It is the Go counterpart of DW::Proxy in cgi-bin: a proxy URL looks like
+
+    https://proxy.dreamwidth.net/TOKEN/SOURCE/foo.com/url?arg=val
+
+where TOKEN is the first 12 hex characters of md5(salt + "http://foo.com/url?arg=val")
+and SOURCE is informational only ("-" or "USERID-DITEMID").
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package signature
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TokenLength is the number of hex characters of the MD5 digest used as a token.
+const TokenLength = 12
+
+// ReadSaltFile loads a salt from disk. The whole file is used verbatim, including any
+// trailing newline, to match how DW::Proxy reads $LJ::PROXY_SALT_FILE.
+func ReadSaltFile(path string) (string, error) {
+	salt, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(salt), nil
+}
+
+// Sign returns the token for a source URL.
+func Sign(salt, origURL string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(salt+origURL)))[0:TokenLength]
+}
+
+// Valid reports whether token is the correct signature for a source URL.
+func Valid(salt, token, origURL string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(Sign(salt, origURL))) == 1
+}
+
+// URL builds a complete proxy URL for a source URL, the same way DW::Proxy::get_proxy_url
+// does. base is the proxy's root (e.g. "https://proxy.dreamwidth.net") and source is the
+// informational SOURCE component; an empty source becomes "-".
+func URL(base, salt, source, origURL string) (string, error) {
+	if !strings.HasPrefix(origURL, "http://") {
+		return "", errors.New("only http:// URLs can be proxied")
+	}
+	if source == "" {
+		source = "-"
+	}
+
+	// DW::Proxy replaces spaces before calculating the checksum; do the same so the
+	// two sides agree.
+	origURL = strings.ReplaceAll(origURL, " ", "%20")
+
+	return strings.Join([]string{
+		strings.TrimSuffix(base, "/"), Sign(salt, origURL), source, origURL[len("http://"):],
+	}, "/"), nil
+}
+
+// Parse splits a proxy request URI ("/TOKEN/SOURCE/foo.com/url?arg=val") into its token,
+// source and the source URL it refers to. Full http:// and https:// proxy URLs are
+// accepted as well, so that operators can paste whatever they have; "://" anywhere else
+// (e.g. in the source URL's query) is left alone.
+func Parse(requestURI string) (token, source, origURL string, err error) {
+	lower := strings.ToLower(requestURI)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		rest := requestURI[strings.Index(requestURI, "://")+3:]
+		if j := strings.Index(rest, "/"); j >= 0 {
+			requestURI = rest[j:]
+		} else {
+			requestURI = "/"
+		}
+	}
+
+	//  0   /  1  /   2  /   3   /  4
+	//     /TOKEN/SOURCE/foo.com/url?arg=val
+	parts := strings.SplitN(requestURI, "/", 5)
+	if len(parts) != 5 || parts[0] != "" {
+		return "", "", "", errors.New("malformed proxy path")
+	}
+	return parts[1], parts[2], "http://" + strings.Join(parts[3:], "/"), nil
+}
@@ -0,0 +1,65 @@
+package signature
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		uri, token, source, origURL string
+	}{
+		{"/abc123/-/foo.com/img.png", "abc123", "-", "http://foo.com/img.png"},
+		{"/abc123/1-2/foo.com/a/b.png?x=1", "abc123", "1-2", "http://foo.com/a/b.png?x=1"},
+		{"https://proxy.dreamwidth.net/abc123/-/foo.com/img.png", "abc123", "-", "http://foo.com/img.png"},
+		{"HTTP://proxy.example/abc123/-/foo.com/img.png", "abc123", "-", "http://foo.com/img.png"},
+
+		// "://" in the path or query belongs to the source URL.
+		{"/abc123/-/foo.com/redirect?to=http://bar.com/x.png", "abc123", "-", "http://foo.com/redirect?to=http://bar.com/x.png"},
+		{"/abc123/-/foo.com/http://bar.com/x.png", "abc123", "-", "http://foo.com/http://bar.com/x.png"},
+	}
+	for _, tt := range tests {
+		token, source, origURL, err := Parse(tt.uri)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.uri, err)
+			continue
+		}
+		if token != tt.token || source != tt.source || origURL != tt.origURL {
+			t.Errorf("Parse(%q) = %q, %q, %q; want %q, %q, %q",
+				tt.uri, token, source, origURL, tt.token, tt.source, tt.origURL)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, uri := range []string{"", "/", "/abc123", "/abc123/-", "abc123/-/foo.com/x", "https://proxy.example"} {
+		if _, _, _, err := Parse(uri); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", uri)
+		}
+	}
+}
+
+func TestURLRoundTrip(t *testing.T) {
+	const salt = "salt\n"
+	orig := "http://foo.com/a b.png?next=http://bar.com/"
+	u, err := URL("https://proxy.dreamwidth.net/", salt, "", orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, source, origURL, err := Parse(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != "-" || origURL != "http://foo.com/a%20b.png?next=http://bar.com/" {
+		t.Errorf("Parse(%q) = source %q, url %q", u, source, origURL)
+	}
+	if !Valid(salt, token, origURL) {
+		t.Errorf("token %q isn't valid for %q", token, origURL)
+	}
+	if Valid("other salt", token, origURL) {
+		t.Errorf("token %q is valid under another salt", token)
+	}
+}
+
+func TestURLRejectsHTTPS(t *testing.T) {
+	if _, err := URL("https://proxy.dreamwidth.net", "salt", "-", "https://foo.com/x.png"); err == nil {
+		t.Error("URL accepted an https:// source URL")
+	}
+}
@@ -0,0 +1,345 @@
+/*
+
+stats.go
+
+Cache statistics. The "stats" subcommand walks CACHE_DIR (and the sidecar
+metadata) to report sizes, ages, top origins and leftover files; the running
+proxy additionally exposes its hit/miss counters on /_stats for the
+subcommand to include.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	// Request counters for the running proxy, reported on /_stats.
+	statHits   atomic.Int64
+	statMisses atomic.Int64
+	statErrors atomic.Int64
+	statsSince = time.Now()
+)
+
+// ServerStats are the live counters of a running proxy.
+type ServerStats struct {
+	Since   time.Time `json:"since"`
+	Hits    int64     `json:"hits"`
+	Misses  int64     `json:"misses"`
+	Errors  int64     `json:"errors"`
+	HitRate float64   `json:"hit_rate"`
+}
+
+// AgeBucket counts cached files younger than a given age.
+type AgeBucket struct {
+	Label string        `json:"label"`
+	Upto  time.Duration `json:"-"`
+	Files int           `json:"files"`
+	Bytes int64         `json:"bytes"`
+}
+
+// HostStats totals the cached files from one origin host.
+type HostStats struct {
+	Host  string `json:"host"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// CacheStats is the report produced by `proxy stats`.
+type CacheStats struct {
+	Dir          string       `json:"dir"`
+	Files        int          `json:"files"`
+	Bytes        int64        `json:"bytes"`
+	Expired      int          `json:"expired"`
+	WithMeta     int          `json:"with_meta"`
+	StoredBytes  int64        `json:"stored_bytes"`
+	DedupRatio   float64      `json:"dedup_ratio"`
+	Unreferenced int          `json:"unreferenced"`
+	Variants     int          `json:"variants"`
+	VariantBytes int64        `json:"variant_bytes"`
+	Ages         []AgeBucket  `json:"ages"`
+	TopHosts     []HostStats  `json:"top_hosts"`
+	Orphaned     []string     `json:"orphaned"`
+	Partial      []string     `json:"partial"`
+	Server       *ServerStats `json:"server,omitempty"`
+}
+
+// currentServerStats snapshots the live counters.
+func currentServerStats() ServerStats {
+	stats := ServerStats{
+		Since:  statsSince,
+		Hits:   statHits.Load(),
+		Misses: statMisses.Load(),
+		Errors: statErrors.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// statsHandler serves GET /_stats with the live counters.
+func statsHandler(w http.ResponseWriter, req *http.Request) {
+	if !authorizedAdmin(req) {
+		http.Error(w, "Forbidden.", 403)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentServerStats())
+}
+
+// isCacheKey reports whether a file name looks like a cached body (a hex MD5).
+func isCacheKey(name string) bool {
+	if len(name) != 32 {
+		return false
+	}
+	for _, c := range name {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
+
+// collectCacheStats walks a cache directory and builds the report.
+func collectCacheStats(dir string, cacheFor time.Duration, top int) (*CacheStats, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &CacheStats{
+		Dir: dir,
+		Ages: []AgeBucket{
+			{Label: "< 1h", Upto: time.Hour},
+			{Label: "< 6h", Upto: 6 * time.Hour},
+			{Label: "< 1d", Upto: 24 * time.Hour},
+			{Label: "< 7d", Upto: 7 * 24 * time.Hour},
+			{Label: ">= 7d"},
+		},
+		Orphaned: []string{},
+		Partial:  []string{},
+	}
+
+	present := make(map[string]bool)
+	for _, info := range infos {
+		present[info.Name()] = true
+	}
+
+	hosts := make(map[string]*HostStats)
+	inodes := make(map[uint64]bool)
+	now := time.Now()
+	for _, info := range infos {
+		name := info.Name()
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasPrefix(name, ".") {
+			if strings.HasSuffix(name, ".tmp") {
+				stats.Partial = append(stats.Partial, name)
+			}
+			continue
+		}
+
+		base, ext := name, ""
+		if i := strings.Index(name, "."); i >= 0 {
+			base, ext = name[:i], name[i:]
+		}
+		if !isCacheKey(base) {
+			continue
+		}
+		if ext != "" {
+			// Sidecars and variants belong to a body; without one they're orphans.
+			if !present[base] {
+				stats.Orphaned = append(stats.Orphaned, name)
+			} else if ext != MetaSuffix {
+				stats.Variants++
+				stats.VariantBytes += info.Size()
+			}
+			continue
+		}
+
+		stats.Files++
+		stats.Bytes += info.Size()
+
+		// Deduplicated entries are hard links to one body; count its storage once.
+		if st, ok := info.Sys().(*syscall.Stat_t); !ok || !inodes[st.Ino] {
+			stats.StoredBytes += info.Size()
+			if ok {
+				inodes[st.Ino] = true
+			}
+		}
+		age := now.Sub(fetchedAt(filepath.Join(dir, name), info))
+		if age > cacheFor {
+			stats.Expired++
+		}
+		for i := range stats.Ages {
+			if stats.Ages[i].Upto == 0 || age < stats.Ages[i].Upto {
+				stats.Ages[i].Files++
+				stats.Ages[i].Bytes += info.Size()
+				break
+			}
+		}
+
+		host := "(unknown)"
+		if meta, err := readMeta(filepath.Join(dir, name)); err == nil {
+			stats.WithMeta++
+			if u, err := url.Parse(meta.SourceURL); err == nil && u.Host != "" {
+				host = u.Host
+			}
+			if meta.Size != info.Size() {
+				// The body doesn't match what we recorded: a write was interrupted.
+				stats.Partial = append(stats.Partial, name)
+			}
+		}
+		if hosts[host] == nil {
+			hosts[host] = &HostStats{Host: host}
+		}
+		hosts[host].Files++
+		hosts[host].Bytes += info.Size()
+	}
+
+	if stats.StoredBytes > 0 {
+		stats.DedupRatio = float64(stats.Bytes) / float64(stats.StoredBytes)
+	}
+	if contents, err := ioutil.ReadDir(filepath.Join(dir, "content")); err == nil {
+		for _, info := range contents {
+			if info.Mode().IsRegular() && linkCount(info) <= 1 {
+				stats.Unreferenced++
+			}
+		}
+	}
+
+	for _, h := range hosts {
+		stats.TopHosts = append(stats.TopHosts, *h)
+	}
+	sort.Slice(stats.TopHosts, func(i, j int) bool {
+		if stats.TopHosts[i].Bytes != stats.TopHosts[j].Bytes {
+			return stats.TopHosts[i].Bytes > stats.TopHosts[j].Bytes
+		}
+		return stats.TopHosts[i].Host < stats.TopHosts[j].Host
+	})
+	if len(stats.TopHosts) > top {
+		stats.TopHosts = stats.TopHosts[:top]
+	}
+	return stats, nil
+}
+
+// fetchServerStats asks a running proxy for its live counters.
+func fetchServerStats(server, tokenFile string) (*ServerStats, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", strings.TrimSuffix(server, "/")+"/_stats", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	var stats ServerStats
+	return &stats, json.NewDecoder(resp.Body).Decode(&stats)
+}
+
+// humanBytes formats a byte count for display.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// runStats implements `proxy stats`.
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	cacheDir := fs.String("cache_dir", CACHE_DIR, "Directory the proxy caches in")
+	cacheFor := fs.Int("cache_for", int(CACHE_FOR/time.Second), "How long files are cached for (seconds)")
+	top := fs.Int("top", 10, "How many origin hosts to list")
+	jsonOut := fs.Bool("json", false, "Output JSON")
+	server := fs.String("server", "", "URL of a running proxy to include hit/miss counters from")
+	tokenFile := fs.String("admin_token_file", "", "Path to the proxy's admin token file (with -server)")
+	fs.Parse(args)
+
+	stats, err := collectCacheStats(*cacheDir, time.Duration(*cacheFor)*time.Second, *top)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", *cacheDir, err)
+		os.Exit(1)
+	}
+	if *server != "" {
+		if stats.Server, err = fetchServerStats(*server, *tokenFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not get counters from %s: %s\n", *server, err)
+		}
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		enc.Encode(stats)
+		return
+	}
+
+	fmt.Printf("Cache %s\n", stats.Dir)
+	fmt.Printf("  files:    %d (%s), %d expired, %d with metadata\n",
+		stats.Files, humanBytes(stats.Bytes), stats.Expired, stats.WithMeta)
+	fmt.Printf("  stored:   %s after deduplication (ratio %.2f), %d unreferenced bodies\n",
+		humanBytes(stats.StoredBytes), stats.DedupRatio, stats.Unreferenced)
+	fmt.Printf("  variants: %d (%s)\n", stats.Variants, humanBytes(stats.VariantBytes))
+	if stats.Server != nil {
+		fmt.Printf("  requests: %d hits, %d misses, %d errors since %s (hit rate %.1f%%)\n",
+			stats.Server.Hits, stats.Server.Misses, stats.Server.Errors,
+			stats.Server.Since.Format(time.RFC3339), stats.Server.HitRate*100)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\n  AGE\tFILES\tSIZE")
+	for _, b := range stats.Ages {
+		fmt.Fprintf(w, "  %s\t%d\t%s\n", b.Label, b.Files, humanBytes(b.Bytes))
+	}
+	fmt.Fprintln(w, "\n  HOST\tFILES\tSIZE")
+	for _, h := range stats.TopHosts {
+		fmt.Fprintf(w, "  %s\t%d\t%s\n", h.Host, h.Files, humanBytes(h.Bytes))
+	}
+	w.Flush()
+
+	if len(stats.Orphaned) > 0 {
+		fmt.Printf("\n  orphaned: %s\n", strings.Join(stats.Orphaned, ", "))
+	}
+	if len(stats.Partial) > 0 {
+		fmt.Printf("\n  partial:  %s\n", strings.Join(stats.Partial, ", "))
+	}
+}
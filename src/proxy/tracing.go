@@ -0,0 +1,375 @@
+/*
+
+tracing.go
+
+Request tracing with OpenTelemetry-compatible spans. Each request joins the
+trace named by an incoming W3C "traceparent" header (or starts a new one),
+and the interesting phases of serving it are recorded as child spans. Ended
+spans are batched and exported as OTLP/HTTP JSON to -otlp_endpoint, which can
+be an OpenTelemetry collector or the "trace-collector" subcommand.
+
+This deliberately implements only the small part of OpenTelemetry we need, so
+the proxy keeps building with nothing but the standard library.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP span kinds and status codes.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	statusCodeError = 2
+)
+
+// Span is a single timed operation within a trace. A nil *Span is valid and does nothing,
+// which is what callers get when tracing is off.
+type Span struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	ParentID   [8]byte
+	Name       string
+	Kind       int
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Err        string
+
+	mu sync.Mutex
+}
+
+type spanContextKey struct{}
+
+var (
+	OTLP_ENDPOINT string
+	TRACE_SERVICE string = "dw-proxy"
+
+	traceLock    sync.Mutex
+	tracePending []*Span
+	traceFlush   = make(chan struct{}, 1)
+)
+
+// tracingEnabled reports whether spans are being collected.
+func tracingEnabled() bool {
+	return OTLP_ENDPOINT != ""
+}
+
+// randomID fills b with random bytes.
+func randomID(b []byte) {
+	rand.Read(b)
+}
+
+// parseTraceparent extracts the trace and parent span IDs from a W3C traceparent header,
+// e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func parseTraceparent(header string) (traceID [16]byte, parentID [8]byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, false
+	}
+	return traceID, parentID, traceID != [16]byte{} && parentID != [8]byte{}
+}
+
+// startRequestSpan starts the root span for an incoming request, continuing the caller's
+// trace if it sent a traceparent header.
+func startRequestSpan(req *http.Request) (context.Context, *Span) {
+	if !tracingEnabled() {
+		return req.Context(), nil
+	}
+	span := &Span{
+		Name:       "proxy.request",
+		Kind:       spanKindServer,
+		Start:      time.Now(),
+		Attributes: map[string]string{"http.method": req.Method},
+	}
+	if traceID, parentID, ok := parseTraceparent(req.Header.Get("traceparent")); ok {
+		span.TraceID, span.ParentID = traceID, parentID
+	} else {
+		randomID(span.TraceID[:])
+	}
+	randomID(span.SpanID[:])
+	return context.WithValue(req.Context(), spanContextKey{}, span), span
+}
+
+// startSpan starts a child of the span in ctx. If ctx has no span, tracing is off for this
+// request and the returned span is nil.
+func startSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent, _ := ctx.Value(spanContextKey{}).(*Span)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		TraceID:    parent.TraceID,
+		ParentID:   parent.SpanID,
+		Name:       name,
+		Kind:       spanKindInternal,
+		Start:      time.Now(),
+		Attributes: make(map[string]string),
+	}
+	randomID(span.SpanID[:])
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// injectTraceparent adds the traceparent header for the span in ctx to an outgoing request.
+func injectTraceparent(ctx context.Context, req *http.Request) {
+	if span, _ := ctx.Value(spanContextKey{}).(*Span); span != nil {
+		req.Header.Set("traceparent", fmt.Sprintf("00-%x-%x-01", span.TraceID, span.SpanID))
+	}
+}
+
+// SetAttr records an attribute on the span.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Attributes[key] = fmt.Sprintf("%v", value)
+	s.mu.Unlock()
+}
+
+// SetKind marks what kind of span this is (e.g. a client call to another service).
+func (s *Span) SetKind(kind int) {
+	if s != nil {
+		s.Kind = kind
+	}
+}
+
+// SetError marks the span as failed, if err is non-nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Err = err.Error()
+	s.mu.Unlock()
+}
+
+// Finish ends the span and queues it for export. Only the first call counts, so a span
+// can be finished early on the main path and by a defer on the others.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.End.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	traceLock.Lock()
+	tracePending = append(tracePending, s)
+	full := len(tracePending) >= 100
+	traceLock.Unlock()
+	if full {
+		select {
+		case traceFlush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// OTLP/HTTP JSON encoding, as accepted on a collector's /v1/traces endpoint.
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpExport struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// toOTLP converts a finished span to its OTLP JSON form.
+func (s *Span) toOTLP() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.SpanID[:]),
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+	}
+	if s.ParentID != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+	}
+	for k, v := range s.Attributes {
+		out.Attributes = append(out.Attributes, otlpAttribute{Key: k, Value: otlpValue{v}})
+	}
+	if s.Err != "" {
+		out.Status = otlpStatus{Code: statusCodeError, Message: s.Err}
+	}
+	return out
+}
+
+// exportSpans sends queued spans to the collector every few seconds, or sooner if a batch
+// fills up. Export failures drop the batch: tracing must never back up the proxy.
+func exportSpans() {
+	timer := time.NewTicker(5 * time.Second)
+	defer timer.Stop()
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	for {
+		select {
+		case <-timer.C:
+		case <-traceFlush:
+		}
+
+		if batch := takePendingSpans(); len(batch) > 0 {
+			if err := exportBatch(client, batch); err != nil {
+				log.Printf("Failed to export %d spans: %s", len(batch), err)
+			}
+		}
+	}
+}
+
+// takePendingSpans returns the spans finished since the last call.
+func takePendingSpans() []*Span {
+	traceLock.Lock()
+	defer traceLock.Unlock()
+	batch := tracePending
+	tracePending = nil
+	return batch
+}
+
+// exportBatch posts a batch of spans to OTLP_ENDPOINT.
+func exportBatch(client *http.Client, batch []*Span) error {
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpAttribute{{Key: "service.name", Value: otlpValue{TRACE_SERVICE}}}
+	var ss otlpScopeSpans
+	ss.Scope.Name = "dreamwidth.org/proxy"
+	for _, span := range batch {
+		ss.Spans = append(ss.Spans, span.toOTLP())
+	}
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+	export := otlpExport{ResourceSpans: []otlpResourceSpans{rs}}
+
+	body, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(OTLP_ENDPOINT, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// runTraceCollector implements `proxy trace-collector`, a stand-in for an OpenTelemetry
+// collector that accepts OTLP/HTTP JSON and prints each span, for looking at traces locally.
+func runTraceCollector(args []string) {
+	fs := flag.NewFlagSet("trace-collector", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:4318", "Address to listen on")
+	fs.Parse(args)
+
+	http.HandleFunc("/v1/traces", func(w http.ResponseWriter, req *http.Request) {
+		var export otlpExport
+		if err := json.NewDecoder(req.Body).Decode(&export); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		for _, rs := range export.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					start, _ := strconv.ParseInt(span.StartTimeUnixNano, 10, 64)
+					end, _ := strconv.ParseInt(span.EndTimeUnixNano, 10, 64)
+					var attrs []string
+					for _, a := range span.Attributes {
+						attrs = append(attrs, a.Key+"="+a.Value.StringValue)
+					}
+					status := "ok"
+					if span.Status.Code == statusCodeError {
+						status = "error: " + span.Status.Message
+					}
+					fmt.Fprintf(os.Stdout, "%s %s parent=%s %-16s %10s %s [%s]\n",
+						span.TraceID, span.SpanID, dashIfEmpty(span.ParentSpanID), span.Name,
+						time.Duration(end-start), status, strings.Join(attrs, " "))
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+	})
+
+	log.Printf("Trace collector listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
+
+// dashIfEmpty returns "-" for an empty string.
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
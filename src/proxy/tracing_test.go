@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTracing turns tracing on for the rest of the test, with finished spans left in
+// memory for takePendingSpans.
+func withTracing(t *testing.T, endpoint string) {
+	t.Helper()
+	old := OTLP_ENDPOINT
+	OTLP_ENDPOINT = endpoint
+	takePendingSpans()
+	t.Cleanup(func() {
+		OTLP_ENDPOINT = old
+		takePendingSpans()
+	})
+}
+
+func TestFetchSpans(t *testing.T) {
+	withTracing(t, "http://collector.invalid/v1/traces")
+	withCache(t)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n" + strings.Repeat("x", 1000)))
+	}))
+	defer origin.Close()
+	withScanner(t, func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		json.NewEncoder(w).Encode(ScanVerdict{Verdict: "allow"})
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := startRequestSpan(req)
+	if _, err := getProxyFile(ctx, "tok-spans", origin.URL+"/spans.png", false); err != nil {
+		t.Fatalf("getProxyFile: %v", err)
+	}
+	root.Finish()
+
+	spans := make(map[string]*Span)
+	for _, span := range takePendingSpans() {
+		name := span.Name
+		if mode := span.Attributes["mode"]; mode != "" {
+			name += "/" + mode
+		}
+		if spans[name] != nil {
+			t.Errorf("span %s finished twice", name)
+		}
+		spans[name] = span
+	}
+	for _, name := range []string{"proxy.request", "index.lookup", "lock.wait/read", "lock.wait/write", "origin.fetch", "disk.write", "content.check"} {
+		span := spans[name]
+		if span == nil {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if span.TraceID != root.TraceID {
+			t.Errorf("%s isn't in the request's trace", name)
+		}
+		if name != "proxy.request" && span.ParentID != root.SpanID {
+			t.Errorf("%s isn't a child of the request span", name)
+		}
+		if span.End.Before(span.Start) {
+			t.Errorf("%s ends before it starts", name)
+		}
+	}
+	if root.ParentID != [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7} {
+		t.Errorf("request span didn't continue the incoming trace")
+	}
+
+	write, check := spans["disk.write"], spans["content.check"]
+	if write != nil && check != nil {
+		if write.End.After(check.Start) {
+			t.Errorf("disk.write (ends %s) overlaps content.check (starts %s)", write.End, check.Start)
+		}
+		if write.Attributes["bytes"] != "1008" {
+			t.Errorf("disk.write bytes = %q, want 1008", write.Attributes["bytes"])
+		}
+	}
+	if fetch := spans["origin.fetch"]; fetch != nil && (fetch.Kind != spanKindClient || fetch.Attributes["http.status_code"] != "200") {
+		t.Errorf("origin.fetch = kind %d, attributes %v", fetch.Kind, fetch.Attributes)
+	}
+}
+
+func TestExportBatch(t *testing.T) {
+	var got otlpExport
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewDecoder(req.Body).Decode(&got)
+	}))
+	defer collector.Close()
+	withTracing(t, collector.URL)
+
+	ctx, root := startRequestSpan(httptest.NewRequest("GET", "/", nil))
+	_, child := startSpan(ctx, "child")
+	child.SetError(errTest("went wrong"))
+	child.Finish()
+	root.Finish()
+	if err := exportBatch(http.DefaultClient, takePendingSpans()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("export = %+v", got)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "proxy.request" {
+		t.Fatalf("spans = %+v", spans)
+	}
+	if spans[0].ParentSpanID != spans[1].SpanID || spans[1].ParentSpanID != "" {
+		t.Errorf("parent IDs = %q, %q", spans[0].ParentSpanID, spans[1].ParentSpanID)
+	}
+	if spans[0].Status.Code != statusCodeError || spans[0].Status.Message != "went wrong" {
+		t.Errorf("child status = %+v", spans[0].Status)
+	}
+
+	collector.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "nope", 503)
+	})
+	if err := exportBatch(http.DefaultClient, []*Span{root}); err == nil {
+		t.Error("exportBatch succeeded against a failing collector")
+	}
+}
+
+type errTest string
+
+func (e errTest) Error() string { return string(e) }
@@ -0,0 +1,259 @@
+/*
+
+transcode.go
+
+Background transcoding of cached PNG/JPEG images into modern formats (WebP and
+AVIF). The first request for an image is always served from the original file;
+once a variant has been encoded it is served to clients whose Accept header
+allows it. Files served from the disk cache are queued too if they're missing
+a variant, e.g. because they were cached before transcoding was enabled.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TranscodeRequest asks the transcoder to produce modern-format variants of a cached file.
+type TranscodeRequest struct {
+	LocalPath string
+	SourceURL string
+}
+
+// VariantFormat describes one modern format we can transcode into. Formats are listed in
+// order of preference; the first one the client accepts (and that exists on disk) wins.
+type VariantFormat struct {
+	Extension string
+	MimeType  string
+	Command   func(ctx context.Context, src, dst string) *exec.Cmd
+}
+
+var (
+	TRANSCODE_REQ      chan *TranscodeRequest
+	TRANSCODE          bool          = false
+	TRANSCODE_MIN_SIZE int64         = 64 * 1024
+	TRANSCODE_TIMEOUT  time.Duration = 60 * time.Second
+	CWEBP_PATH         string
+	AVIFENC_PATH       string
+
+	// transcodeInFlight tracks local paths currently being encoded, so a burst of fetches
+	// for the same file doesn't queue duplicate work.
+	transcodeInFlight sync.Map
+
+	// transcodeTried maps a local path to the cachedAt time of the copy we last queued,
+	// so a file whose variants weren't worth keeping isn't re-encoded on every hit.
+	transcodeTried sync.Map
+)
+
+// variantFormats returns the formats we have an encoder configured for, most preferred first.
+func variantFormats() []VariantFormat {
+	var formats []VariantFormat
+	if AVIFENC_PATH != "" {
+		formats = append(formats, VariantFormat{
+			Extension: ".avif",
+			MimeType:  "image/avif",
+			Command: func(ctx context.Context, src, dst string) *exec.Cmd {
+				return exec.CommandContext(ctx, AVIFENC_PATH, "--speed", "8", src, dst)
+			},
+		})
+	}
+	if CWEBP_PATH != "" {
+		formats = append(formats, VariantFormat{
+			Extension: ".webp",
+			MimeType:  "image/webp",
+			Command: func(ctx context.Context, src, dst string) *exec.Cmd {
+				return exec.CommandContext(ctx, CWEBP_PATH, "-quiet", "-q", "80", src, "-o", dst)
+			},
+		})
+	}
+	return formats
+}
+
+// queueTranscode hands a freshly cached file to the transcoder if it's a candidate. This
+// never blocks: if the queue is full, the file is simply served in its original format.
+func queueTranscode(localPath, sourceURL, mimetype string, size int64) {
+	if !TRANSCODE || TRANSCODE_REQ == nil {
+		return
+	}
+	if mimetype != "image/png" && mimetype != "image/jpeg" {
+		return
+	}
+	if size < TRANSCODE_MIN_SIZE {
+		return
+	}
+
+	if _, loaded := transcodeInFlight.LoadOrStore(localPath, true); loaded {
+		return
+	}
+	select {
+	case TRANSCODE_REQ <- &TranscodeRequest{LocalPath: localPath, SourceURL: sourceURL}:
+		transcodeTried.Store(localPath, cachedAt(localPath))
+	default:
+		transcodeInFlight.Delete(localPath)
+		log.Printf("Transcode queue full, skipping %s", sourceURL)
+	}
+}
+
+// queueMissingVariants queues a file being served from the cache for transcoding if any
+// configured variant of it is missing or stale, unless we've already tried this copy.
+func queueMissingVariants(localPath, sourceURL string) {
+	if !TRANSCODE || TRANSCODE_REQ == nil {
+		return
+	}
+	fetched := cachedAt(localPath)
+	if tried, ok := transcodeTried.Load(localPath); ok && tried.(time.Time).Equal(fetched) {
+		return
+	}
+	missing := false
+	for _, format := range variantFormats() {
+		if !freshVariant(localPath+format.Extension, fetched) {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return
+	}
+
+	// The sidecar knows the type and size; files cached before it existed are sniffed.
+	var mimetype string
+	var size int64
+	if meta, err := readMeta(localPath); err == nil {
+		mimetype, size = meta.ContentType, meta.Size
+	} else {
+		file, err := os.Open(localPath)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		firstblock := make([]byte, 512)
+		n, _ := io.ReadFull(file, firstblock)
+		mimetype = http.DetectContentType(firstblock[:n])
+		if info, err := file.Stat(); err == nil {
+			size = info.Size()
+		}
+	}
+	queueTranscode(localPath, sourceURL, mimetype, size)
+}
+
+// cachedAt returns when the cached copy at localPath was fetched from the origin.
+func cachedAt(localPath string) time.Time {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return time.Time{}
+	}
+	return fetchedAt(localPath, info)
+}
+
+// freshVariant reports whether the variant at path was encoded from the copy fetched at
+// fetched; a variant older than that belongs to a previous fetch.
+func freshVariant(path string, fetched time.Time) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && !info.ModTime().Before(fetched)
+}
+
+// handleTranscodeRequests encodes each queued file into every configured format. Output is
+// written to a dotfile (which cleanCacheFiles ignores) and renamed into place when complete,
+// so a half-written variant is never served. An encoder that runs longer than
+// TRANSCODE_TIMEOUT is killed, so a file that hangs it can't tie up the worker.
+func handleTranscodeRequests() {
+	for req := range TRANSCODE_REQ {
+		for _, format := range variantFormats() {
+			dst := req.LocalPath + format.Extension
+			tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+			if out, err := encodeVariant(format, req.LocalPath, tmp); err != nil {
+				log.Printf("Failed to transcode %s to %s: %s: %s",
+					req.SourceURL, format.MimeType, err, strings.TrimSpace(string(out)))
+				os.Remove(tmp)
+				continue
+			}
+
+			// Only keep the variant if it actually saves bytes.
+			orig, err1 := os.Stat(req.LocalPath)
+			info, err2 := os.Stat(tmp)
+			if err1 != nil || err2 != nil || info.Size() >= orig.Size() {
+				os.Remove(tmp)
+				continue
+			}
+			if err := os.Rename(tmp, dst); err != nil {
+				log.Printf("Failed to store variant %s: %s", dst, err)
+				os.Remove(tmp)
+				continue
+			}
+			log.Printf("Transcoded %s to %s: %d -> %d bytes",
+				req.SourceURL, format.MimeType, orig.Size(), info.Size())
+		}
+		transcodeInFlight.Delete(req.LocalPath)
+	}
+}
+
+// encodeVariant runs format's encoder on src, writing dst, and returns its output.
+func encodeVariant(format VariantFormat, src, dst string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TRANSCODE_TIMEOUT)
+	defer cancel()
+	out, err := format.Command(ctx, src, dst).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", TRANSCODE_TIMEOUT)
+	}
+	return out, err
+}
+
+// pickVariant returns the path and MIME type of the best variant of localPath that the
+// client accepts. If there is no usable variant, it returns the original path and "".
+func pickVariant(req *http.Request, localPath string) (string, string) {
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return localPath, ""
+	}
+	fetched := cachedAt(localPath)
+	if fetched.IsZero() {
+		return localPath, ""
+	}
+	for _, format := range variantFormats() {
+		if acceptsMimeType(accept, format.MimeType) && freshVariant(localPath+format.Extension, fetched) {
+			return localPath + format.Extension, format.MimeType
+		}
+	}
+	return localPath, ""
+}
+
+// acceptsMimeType reports whether an Accept header explicitly lists mimetype with a
+// non-zero quality. Wildcards don't count: browsers send "image/*" without supporting
+// every format, so we only serve a variant when it's named.
+func acceptsMimeType(accept, mimetype string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), mimetype) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q <= 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeVariantTimeout(t *testing.T) {
+	old := TRANSCODE_TIMEOUT
+	TRANSCODE_TIMEOUT = 100 * time.Millisecond
+	defer func() { TRANSCODE_TIMEOUT = old }()
+
+	hang := VariantFormat{
+		Extension: ".webp",
+		MimeType:  "image/webp",
+		Command: func(ctx context.Context, src, dst string) *exec.Cmd {
+			return exec.CommandContext(ctx, "sleep", "10")
+		},
+	}
+	start := time.Now()
+	_, err := encodeVariant(hang, "in.png", "out.webp")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("a hung encoder held the worker for %s", elapsed)
+	}
+}
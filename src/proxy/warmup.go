@@ -0,0 +1,311 @@
+/*
+
+warmup.go
+
+Cache warmup: an authenticated endpoint that takes a list of signed proxy paths
+or source URLs and fetches them into the cache in the background, plus the
+"warmup" subcommand that drives it.
+
+Copyright (c) 2026 by Dreamwidth Studios, LLC.
+
+This program is free software; you may redistribute it and/or modify it under
+the same terms as Perl itself.  For a copy of the license, please reference
+'perldoc perlartistic' or 'perldoc perlgpl'.
+
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"dreamwidth.org/proxy/signature"
+)
+
+// WarmupFailure records one item of a warmup job that could not be cached.
+type WarmupFailure struct {
+	Item  string `json:"item"`
+	Error string `json:"error"`
+}
+
+// WarmupStatus is the progress report for a warmup job, as returned by the endpoint.
+type WarmupStatus struct {
+	ID       string          `json:"id"`
+	Total    int             `json:"total"`
+	Done     int             `json:"done"`
+	Failed   int             `json:"failed"`
+	Failures []WarmupFailure `json:"failures"`
+	Started  time.Time       `json:"started"`
+	Finished *time.Time      `json:"finished,omitempty"`
+}
+
+// WarmupJob tracks the progress of a single bulk warmup request.
+type WarmupJob struct {
+	mu     sync.Mutex
+	status WarmupStatus
+}
+
+var (
+	ADMIN_TOKEN        string
+	WARMUP_CONCURRENCY int = 4
+	WARMUP_MAX_ITEMS   int = 1000
+
+	warmupJobsLock sync.Mutex
+	warmupJobs     = make(map[string]*WarmupJob)
+)
+
+// snapshot returns a copy of the job's status that is safe to use without holding the lock.
+func (job *WarmupJob) snapshot() WarmupStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	status := job.status
+	status.Failures = append([]WarmupFailure{}, job.status.Failures...)
+	return status
+}
+
+// authorizedAdmin checks the bearer token on an administrative request.
+func authorizedAdmin(req *http.Request) bool {
+	if ADMIN_TOKEN == "" {
+		return false
+	}
+	given := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(ADMIN_TOKEN)) == 1
+}
+
+// warmupHandler serves POST /_warmup (start a job) and GET /_warmup/ID (job progress).
+func warmupHandler(w http.ResponseWriter, req *http.Request) {
+	if !authorizedAdmin(req) {
+		log.Printf("Rejecting unauthorized warmup request from %s", req.RemoteAddr)
+		http.Error(w, "Forbidden.", 403)
+		return
+	}
+
+	if req.Method == "GET" {
+		id := strings.TrimPrefix(req.URL.Path, "/_warmup/")
+		warmupJobsLock.Lock()
+		job, ok := warmupJobs[id]
+		warmupJobsLock.Unlock()
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job.snapshot())
+		return
+	}
+	if req.Method != "POST" || req.URL.Path != "/_warmup" {
+		http.Error(w, "Method not allowed.", 405)
+		return
+	}
+
+	items, err := readWarmupItems(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	status := startWarmup(items).snapshot()
+	log.Printf("Started warmup job %s with %d items", status.ID, len(items))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(202)
+	json.NewEncoder(w).Encode(status)
+}
+
+// readWarmupItems parses a warmup request body: one signed proxy path, proxy URL or
+// http:// source URL per line. Blank lines and lines starting with # are ignored.
+func readWarmupItems(body io.Reader) ([]string, error) {
+	var items []string
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no items given")
+	}
+	if len(items) > WARMUP_MAX_ITEMS {
+		return nil, fmt.Errorf("too many items: %d (max %d)", len(items), WARMUP_MAX_ITEMS)
+	}
+	return items, nil
+}
+
+// startWarmup registers a new job and starts fetching its items in the background with at
+// most WARMUP_CONCURRENCY fetches at once.
+func startWarmup(items []string) *WarmupJob {
+	idBytes := make([]byte, 8)
+	rand.Read(idBytes)
+	job := &WarmupJob{status: WarmupStatus{
+		ID:      fmt.Sprintf("%x", idBytes),
+		Total:   len(items),
+		Started: time.Now(),
+	}}
+
+	warmupJobsLock.Lock()
+	// Forget about jobs that finished a while ago, so this doesn't grow forever.
+	for id, old := range warmupJobs {
+		if snap := old.snapshot(); snap.Finished != nil && time.Since(*snap.Finished) > time.Hour {
+			delete(warmupJobs, id)
+		}
+	}
+	warmupJobs[job.status.ID] = job
+	warmupJobsLock.Unlock()
+
+	go func() {
+		sem := make(chan struct{}, WARMUP_CONCURRENCY)
+		var wg sync.WaitGroup
+		for _, item := range items {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(item string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				err := warmupItem(item)
+
+				job.mu.Lock()
+				job.status.Done++
+				if err != nil {
+					job.status.Failed++
+					job.status.Failures = append(job.status.Failures,
+						WarmupFailure{Item: item, Error: err.Error()})
+				}
+				job.mu.Unlock()
+			}(item)
+		}
+		wg.Wait()
+
+		job.mu.Lock()
+		now := time.Now()
+		job.status.Finished = &now
+		id, total, failed := job.status.ID, job.status.Total, job.status.Failed
+		job.mu.Unlock()
+		log.Printf("Finished warmup job %s: %d items, %d failed", id, total, failed)
+	}()
+	return job
+}
+
+// warmupItem fetches a single item into the cache. Source URLs are signed with our own
+// salt (the request is already authenticated); proxy paths must carry a valid token.
+func warmupItem(item string) error {
+	var token, origURL string
+	if strings.HasPrefix(item, "http://") {
+		origURL = strings.ReplaceAll(item, " ", "%20")
+		token = signature.Sign(MESSAGE_SALT, origURL)
+	} else {
+		var err error
+		token, _, origURL, err = signature.Parse(item)
+		if err != nil {
+			return err
+		}
+		if !validSignature(token, origURL) {
+			return errors.New("invalid signature")
+		}
+	}
+	_, err := getProxyFile(context.Background(), token, origURL, false)
+	return err
+}
+
+// runWarmup implements `proxy warmup`, submitting a list of items to a running proxy and
+// reporting progress until the job completes. Exits non-zero if any item failed.
+func runWarmup(args []string) {
+	fs := flag.NewFlagSet("warmup", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:6250", "Base URL of the proxy to warm")
+	tokenFile := fs.String("admin_token_file", "", "Path to the proxy's admin token file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: proxy warmup [options] [file]\n\n")
+		fmt.Fprintf(os.Stderr, "Reads proxy paths, proxy URLs or http:// source URLs, one per line, from\n")
+		fmt.Fprintf(os.Stderr, "file (or stdin) and asks the proxy to fetch them into its cache.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *tokenFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: -admin_token_file is required\n")
+		os.Exit(1)
+	}
+	token, err := os.ReadFile(*tokenFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read admin token from %s: %s\n", *tokenFile, err)
+		os.Exit(1)
+	}
+
+	input := io.Reader(os.Stdin)
+	if fs.NArg() > 0 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		input = f
+	}
+	body, err := io.ReadAll(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	base := strings.TrimSuffix(*server, "/")
+	call := func(method, path string, body io.Reader) (WarmupStatus, error) {
+		var job WarmupStatus
+		req, err := http.NewRequest(method, base+path, body)
+		if err != nil {
+			return job, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return job, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			msg, _ := io.ReadAll(resp.Body)
+			return job, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		}
+		return job, json.NewDecoder(resp.Body).Decode(&job)
+	}
+
+	job, err := call("POST", "/_warmup", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting warmup: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Warmup job %s: %d items\n", job.ID, job.Total)
+
+	for job.Finished == nil {
+		time.Sleep(2 * time.Second)
+		job, err = call("GET", "/_warmup/"+job.ID, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error polling warmup job: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("  %d/%d done, %d failed\n", job.Done, job.Total, job.Failed)
+	}
+
+	for _, f := range job.Failures {
+		fmt.Printf("  FAILED %s: %s\n", f.Item, f.Error)
+	}
+	if job.Failed > 0 {
+		os.Exit(1)
+	}
+}